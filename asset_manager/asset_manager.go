@@ -8,6 +8,7 @@ import (
 
 	"github.com/moisespsena-go/aorm"
 	"github.com/ecletus/admin"
+	"github.com/ecletus/media"
 	"github.com/ecletus/media/oss"
 	"github.com/ecletus/core/resource"
 )
@@ -25,7 +26,7 @@ func (*AssetManager) ConfigureResource(res resource.Resourcer) {
 		router.Post("/upload", func(context *admin.Context) {
 			result := AssetManager{}
 			result.File.Scan(context.Request.MultipartForm.File["file"])
-			context.DB().Save(&result)
+			media.WithContext(context.DB(), context.Request.Context()).Save(&result)
 			bytes, _ := json.Marshal(map[string]string{"filelink": result.File.URL(), "filename": result.File.GetFileName()})
 			context.Writer.Write(bytes)
 		})
@@ -45,7 +46,7 @@ func (*AssetManager) ConfigureResource(res resource.Resourcer) {
 					result := &AssetManager{}
 					if err = context.DB().Find(result, matches[1]).Error; err == nil {
 						if err = result.File.Scan(buf.Bytes()); err == nil {
-							if err = context.DB().Save(result).Error; err == nil {
+							if err = media.WithContext(context.DB(), context.Request.Context()).Save(result).Error; err == nil {
 								bytes, _ := json.Marshal(map[string]string{"url": result.File.URL(), "filename": result.File.GetFileName()})
 								context.Writer.Write(bytes)
 								return
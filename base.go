@@ -1,12 +1,11 @@
 package media
 
 import (
-	"bytes"
+	"context"
 	"database/sql/driver"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"hash/fnv"
 	"io"
 	"mime/multipart"
 	"os"
@@ -15,20 +14,15 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-	"text/template"
-	"time"
 
 	errwrap "github.com/moisespsena-go/error-wrap"
 
-	"github.com/dustin/go-humanize"
 	"github.com/ecletus/admin"
 	"github.com/ecletus/core"
 	"github.com/ecletus/core/helpers"
 	"github.com/ecletus/core/resource"
 	"github.com/ecletus/core/utils"
 	"github.com/ecletus/oss"
-	"github.com/gosimple/slug"
-	"github.com/jinzhu/inflection"
 	"github.com/moisespsena-go/aorm"
 )
 
@@ -78,7 +72,20 @@ type fileWrapper struct {
 }
 
 func (fileWrapper *fileWrapper) Open() (multipart.File, error) {
-	return fileWrapper.File, nil
+	if _, err := fileWrapper.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &reusableFile{fileWrapper.File}, nil
+}
+
+// reusableFile rewinds the wrapped file instead of close it, so it could be opened again
+type reusableFile struct {
+	*os.File
+}
+
+func (f *reusableFile) Close() error {
+	_, err := f.Seek(0, io.SeekStart)
+	return err
 }
 
 // Base defined a base struct for storages
@@ -86,6 +93,9 @@ type Base struct {
 	FileName    string
 	Url         string
 	FileSize    int64
+	ContentType string     `json:",omitempty"`
+	SHA256      string     `json:",omitempty"`
+	StyleUrl    string     `json:",omitempty"` // the URL of styles, if the URL template has `{{style}}`
 	Delete      bool       `json:"-"`
 	FileHeader  FileHeader `json:"-"`
 	Reader      io.Reader  `json:"-"`
@@ -94,6 +104,10 @@ type Base struct {
 	field       *aorm.Field
 	fieldOption *Option
 	old         []string
+	// urlTemplateErr is the URL template error found by ValidateURLTemplate
+	urlTemplateErr error
+	// validated is set when the file was validated with the field option
+	validated bool
 }
 
 func (Base) AormDataType(dialect aorm.Dialector) string {
@@ -137,20 +151,7 @@ func (b *Base) Remove(url string) (found bool, err error) {
 }
 
 func (b *Base) RemoveAll(media Media) (found bool, err error) {
-	if found, err = media.Remove(media.URL()); err != nil {
-		return found, errwrap.Wrap(err, "Remove %q", media.GetFileName())
-	}
-
-	for _, key := range append(media.SystemNames(), media.Names()...) {
-		var f bool
-		if f, err = media.Remove(media.URL(key)); err != nil {
-			return f, errwrap.Wrap(err, "Remove style %q", key)
-		}
-		if f {
-			found = true
-		}
-	}
-	return
+	return RemoveAll(context.Background(), media)
 }
 
 func (b *Base) SetStorage(storage oss.NamedStorageInterface) {
@@ -177,11 +178,27 @@ func (b *Base) setFile(fileName string, fileSize int64, fileHeader FileHeader) {
 	b.FileName = fileName
 	b.FileHeader = fileHeader
 	b.FileSize = fileSize
+	b.ContentType = ""
+	b.SHA256 = ""
+}
+
+// detectContentType sets the content type from the first bytes of the uploaded file
+func (b *Base) detectContentType() (err error) {
+	if b.FileHeader == nil {
+		return
+	}
+	var typ FileType
+	if typ, err = DetectFileHeaderType(b.FileHeader); err != nil {
+		return errwrap.Wrap(err, "Detect file type of %q", b.FileName)
+	}
+	b.ContentType = typ.WithName(b.FileName).MIME
+	return
 }
 
 func (b *Base) setZero() {
 	b.setFile("", 0, nil)
 	b.Url = ""
+	b.StyleUrl = ""
 }
 
 func (b *Base) AllNames(m Media) []string {
@@ -190,11 +207,6 @@ func (b *Base) AllNames(m Media) []string {
 
 func (b *Base) Set(ctx *Context, data interface{}) (err error) {
 	var (
-		fileName string
-		fileType string
-		size     uint64
-		check    []func()
-
 		currentFileName = b.FileName
 		currentFileSize = b.FileSize
 
@@ -204,7 +216,7 @@ func (b *Base) Set(ctx *Context, data interface{}) (err error) {
 	if m.HasFile() {
 		var currentUrls = []string{b.Url}
 		for _, key := range m.AllNames(m) {
-			if url := m.URL(key); url != "" {
+			if url := StorageURL(m, key); url != "" {
 				currentUrls = append(currentUrls, url)
 			}
 		}
@@ -218,97 +230,82 @@ func (b *Base) Set(ctx *Context, data interface{}) (err error) {
 		}()
 	}
 
-	if t, ok := m.(AcceptTypes); ok {
-		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(fileName), "."))
-		check = append(check, func() {
-			if fileType != "" {
-				for _, typ := range t.FileTypes() {
-					if typ == ext {
-						return
-					}
-				}
-				err = fmt.Errorf("Invalid file type %q", ext)
-			}
-		})
-	}
-
-	if e, ok := m.(AcceptExts); ok {
-		check = append(check, func() {
-			ext := strings.ToLower(filepath.Ext(fileName)[1:])
-			for _, typ := range e.FileExts() {
-				if ext[0] == '.' {
-					ext = ext[1:]
-				}
-				if typ == ext {
-					return
-				}
-			}
-			err = fmt.Errorf("Invalid file extension %q", ext)
-		})
+	var validators []Validator
+	if validators, err = Validators(m); err != nil {
+		return
 	}
 
-	if ms, ok := m.(MaxSize); ok {
-		check = append(check, func() {
-			maxSize := ms.MaxSize()
-			if size > maxSize {
-				err = fmt.Errorf("Very large file. The expected maximum size is %s, but obtained %s.",
-					humanize.Bytes(maxSize), humanize.Bytes(size))
-			}
-		})
-	}
+	if validators != nil {
+		validate := func(data interface{}, fileName string, size uint64) error {
+			return validateUpload(m, validators, data, fileName, size)
+		}
 
-	if check != nil {
 		switch values := data.(type) {
 		case *os.File:
-			fileName = values.Name()
 			var stat os.FileInfo
 			if stat, err = values.Stat(); err != nil {
 				return
 			}
-			size = uint64(stat.Size())
+			err = validate(values, values.Name(), uint64(stat.Size()))
 		case *multipart.FileHeader:
-			fileName = values.Filename
-			size = uint64(values.Size)
-			fileType = values.Header.Get("Content-Type")
+			err = validate(values, values.Filename, uint64(values.Size))
 		case []*multipart.FileHeader:
 			if len(values) == 1 {
-				if file := values[0]; file.Size > 0 {
-					fileName = file.Filename
-					size = uint64(file.Size)
-				}
-			} else if len(values) > 1 {
+				err = validate(values[0], values[0].Filename, uint64(values[0].Size))
+			} else {
 				for i, file := range values {
-					if file.Size > 0 {
-						fileName = file.Filename
-						size = uint64(file.Size)
-						fileType = file.Header.Get("Content-Type")
-						for _, cb := range check {
-							cb()
-							if err != nil {
-								return fmt.Errorf("File #%d: %v", i, err)
-							}
-						}
+					if err = validate(file, file.Filename, uint64(file.Size)); err != nil {
+						return errwrap.Wrap(err, "File #%d", i)
 					}
 				}
-				check = []func(){}
 			}
 		}
 
-		if fileName != "" && size > 0 {
-			for _, cb := range check {
-				cb()
-				if err != nil {
-					return err
-				}
-			}
+		if err != nil {
+			return
 		}
 	}
+	b.validated = m.FieldOption() != nil
 
 	return m.MediaScan(ctx, data)
 }
 
+// ValidateFile validates the file of media if it was scanned without field option, like the uploads of new
+// records scanned before Init, so the validators enabled by field tag are run. It's called by the save callbacks.
+func (b *Base) ValidateFile(m Media) (err error) {
+	if b.validated || b.FileHeader == nil || m.FieldOption() == nil {
+		return
+	}
+	var validators []Validator
+	if validators, err = Validators(m); err != nil {
+		return
+	}
+	if err = validateUpload(m, validators, b.FileHeader, b.FileName, uint64(b.FileSize)); err == nil {
+		b.validated = true
+	}
+	return
+}
+
+func validateUpload(m Media, validators []Validator, data interface{}, fileName string, size uint64) (err error) {
+	if fileName == "" || size == 0 {
+		return
+	}
+	upload := &Upload{Media: m, FileName: fileName, Size: size, Data: data}
+	var typ FileType
+	if typ, err = DetectDataFileType(data); err != nil {
+		return
+	}
+	upload.FileType = typ.WithName(fileName)
+	for _, v := range validators {
+		if err = v.Validate(upload); err != nil {
+			return
+		}
+	}
+	return
+}
+
 func (b *Base) ContextScan(ctx *core.Context, data interface{}) (err error) {
-	return b.Set(NewContext(b), data)
+	return TranslateError(ctx, b.Set(NewContext(b), data))
 }
 
 func (b *Base) ScanBytes(ctx *Context, data []byte) (err error) {
@@ -341,8 +338,10 @@ func (b *Base) MediaScan(ctx *Context, data interface{}) (err error) {
 			return err
 		}
 		b.setFile(filepath.Base(values.Name()), stat.Size(), &fileWrapper{values})
+		return b.detectContentType()
 	case *multipart.FileHeader:
 		b.setFile(values.Filename, values.Size, values)
+		return b.detectContentType()
 	case []*multipart.FileHeader:
 		if len(values) > 0 {
 			return b.Scan(values[0])
@@ -390,7 +389,7 @@ func (b Base) URL(styles ...string) string {
 		return ""
 	}
 	if b.Url != "" && len(styles) > 0 && styles[0] != "" {
-		return MediaStyleURL(b.Url, styles[0])
+		return StyleURL(b.Url, b.StyleUrl, styles[0])
 	}
 	return b.Url
 }
@@ -431,8 +430,20 @@ func (b Base) GetFileHeader() FileHeader {
 
 // GetURLTemplate get url template
 func (b Base) GetURLTemplate(option *Option) (path string) {
-	if path = b.fieldOption.Get("URL"); path == "" {
-		path = URLTemplate
+	if option == nil {
+		option = b.fieldOption
+	}
+	if option != nil {
+		if path = option.Get(OPT_URL); path == "" {
+			path = option.Get("URL")
+		}
+	}
+	if path == "" {
+		if b.ContentAddressed() {
+			path = ContentHashURLTemplate
+		} else {
+			path = URLTemplate
+		}
 	}
 	return
 }
@@ -455,74 +466,59 @@ func (b Base) FullURLU(ctx *core.Context, styles ...string) (url string) {
 	if b.IsZero() {
 		return ""
 	}
-	return b.FullURL(ctx, styles...) + "?_=" + strconv.Itoa(time.Now().Nanosecond())
+	return b.FullURL(ctx, styles...) + "?_=" + b.CacheBuster()
 }
 
-var urlReplacer = regexp.MustCompile("(\\s|\\+)+")
-
-func getFuncMap(scope *aorm.Scope, field *aorm.Field, filename string) template.FuncMap {
-	hash := func() string { return strings.Replace(time.Now().Format("20060102150506.000000000"), ".", "", -1) }
-	slugFileName := func() string {
-		return slug.Make(strings.TrimSuffix(path.Base(filename), path.Ext(filename)))
-	}
-	return template.FuncMap{
-		"class":       func() string { return inflection.Plural(utils.ToParamString(scope.Struct().Type.Name())) },
-		"primary_key": func() string { return fmt.Sprintf("%v", scope.PrimaryKey()) },
-		"primary_key_path": func() string {
-			var b = base64.RawURLEncoding.EncodeToString(scope.Instance().ID().Bytes())
-			var parts = []string{}
-			for i := 0; len(b) > (2+i) && len(parts) < 3; i++ {
-				parts = append(parts, b[0:2+i])
-				b = b[2+i:]
-			}
-			if len(b) > 0 {
-				parts = append(parts, b)
-			}
-			return strings.Join(parts, "/")
-		},
-		"column":   func() string { return strings.ToLower(field.Name) },
-		"filename": func() string { return filename },
-		"filename_slug": func() string {
-			return urlReplacer.ReplaceAllString(slugFileName()+path.Ext(filename), "-")
-		},
-		"basename": func() string { return strings.TrimSuffix(path.Base(filename), path.Ext(filename)) },
-		"hash":     hash,
-		"filename_with_hash": func() string {
-			return urlReplacer.ReplaceAllString(fmt.Sprintf("%s.%v%v", slugFileName(), hash(), path.Ext(filename)), "-")
-		},
-		"extension": func() string { return strings.TrimPrefix(path.Ext(filename), ".") },
-	}
-}
-
-// GetURL get default URL for a model based on its options
-func (b Base) GetURL(scope *aorm.Scope, field *aorm.Field, templater URLTemplater) string {
-	if pth := templater.GetURLTemplate(b.fieldOption); pth != "" {
-		tmpl := template.New("").Funcs(getFuncMap(scope, field, b.GetFileName()))
-		if tmpl, err := tmpl.Parse(pth); err == nil {
-			var result = bytes.NewBufferString("")
-			if err := tmpl.Execute(result, scope.Value); err == nil {
-				return result.String()
-			}
-		}
+// CacheBuster return a token that changes when the stored file changes
+func (b Base) CacheBuster() string {
+	if len(b.SHA256) >= 16 {
+		return b.SHA256[:16]
 	}
-	return ""
+	h := fnv.New64a()
+	h.Write([]byte(b.Url + "\x00" + b.ContentType + "\x00" + strconv.FormatInt(b.FileSize, 10)))
+	return strconv.FormatUint(h.Sum64(), 36)
 }
 
+var urlReplacer = regexp.MustCompile("(\\s|\\+)+")
+
 // Retrieve retrieve file content with url
 func (b Base) Retrieve(url string) (*os.File, error) {
 	return nil, errors.New("not implemented")
 }
 
+// GetContentType return the MIME type detected from the uploaded content
+func (b Base) GetContentType() string {
+	return b.ContentType
+}
+
+// GetFileType return the file type detected from the uploaded content.
+// Files stored before the detection fall back to the URL extension.
+func (b Base) GetFileType() FileType {
+	if b.ContentType != "" {
+		return FileType{MIME: b.ContentType, Ext: normalizeExt(path.Ext(b.FileName))}
+	}
+	return FileTypeFromName(b.URL())
+}
+
 // IsImage return if it is an image
 func (b Base) IsImage() bool {
+	if b.ContentType != "" {
+		return b.GetFileType().IsImage()
+	}
 	return IsImageFormat(b.URL())
 }
 
 func (b Base) IsVideo() bool {
+	if b.ContentType != "" {
+		return b.GetFileType().IsVideo()
+	}
 	return IsVideoFormat(b.URL())
 }
 
 func (b Base) IsSVG() bool {
+	if b.ContentType != "" {
+		return b.GetFileType().IsSVG()
+	}
 	return IsSVGFormat(b.URL())
 }
 
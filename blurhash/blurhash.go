@@ -0,0 +1,200 @@
+// Package blurhash encodes and decodes BlurHash (https://blurha.sh) placeholders.
+package blurhash
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+)
+
+const characters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+var ErrInvalidHash = errors.New("invalid blurhash")
+
+func encode83(b *strings.Builder, value, length int) {
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		b.WriteByte(characters[digit])
+	}
+}
+
+func decode83(s string) (value int, err error) {
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(characters, s[i])
+		if digit < 0 {
+			return 0, ErrInvalidHash
+		}
+		value = value*83 + digit
+	}
+	return
+}
+
+func sRGBToLinear(value uint8) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
+
+// Encode return the BlurHash of img with xComponents and yComponents, from 1 to 9.
+// Use a small copy of image, like 64 pixels wide: the cost is proportional to the pixels count.
+func Encode(xComponents, yComponents int, img image.Image) (string, error) {
+	if xComponents < 1 || xComponents > 9 || yComponents < 1 || yComponents > 9 {
+		return "", fmt.Errorf("blurhash components must be from 1 to 9")
+	}
+	var (
+		bounds        = img.Bounds()
+		width, height = bounds.Dx(), bounds.Dy()
+	)
+	if width == 0 || height == 0 {
+		return "", fmt.Errorf("blurhash of empty image")
+	}
+
+	// linear colors
+	pixels := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			pixels[y*width+x] = [3]float64{sRGBToLinear(c.R), sRGBToLinear(c.G), sRGBToLinear(c.B)}
+		}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			var (
+				f             [3]float64
+				normalisation = 2.0
+			)
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			for y := 0; y < height; y++ {
+				cy := math.Cos(math.Pi * float64(j) * float64(y) / float64(height))
+				for x := 0; x < width; x++ {
+					basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) * cy
+					p := pixels[y*width+x]
+					f[0] += basis * p[0]
+					f[1] += basis * p[1]
+					f[2] += basis * p[2]
+				}
+			}
+			scale := normalisation / float64(width*height)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var (
+		b       strings.Builder
+		dc, ac  = factors[0], factors[1:]
+		maximum = 1.0
+	)
+	encode83(&b, (xComponents-1)+(yComponents-1)*9, 1)
+	if len(ac) > 0 {
+		var actualMax float64
+		for _, f := range ac {
+			actualMax = math.Max(actualMax, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maximum = float64(quantisedMax+1) / 166
+		encode83(&b, quantisedMax, 1)
+	} else {
+		encode83(&b, 0, 1)
+	}
+	encode83(&b, linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4)
+	for _, f := range ac {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximum, 0.5)*9+9.5))))
+		}
+		encode83(&b, quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2)
+	}
+	return b.String(), nil
+}
+
+// Components return the x and y components of hash
+func Components(hash string) (x, y int, err error) {
+	if len(hash) < 6 {
+		return 0, 0, ErrInvalidHash
+	}
+	sizeFlag, err := decode83(hash[:1])
+	if err != nil {
+		return
+	}
+	x, y = sizeFlag%9+1, sizeFlag/9+1
+	if len(hash) != 4+2*x*y {
+		return 0, 0, ErrInvalidHash
+	}
+	return
+}
+
+// Decode return the image of width and height of hash. The punch increases the contrast, use 1 by default.
+func Decode(hash string, width, height int, punch float64) (image.Image, error) {
+	numX, numY, err := Components(hash)
+	if err != nil {
+		return nil, err
+	}
+	quantisedMax, err := decode83(hash[1:2])
+	if err != nil {
+		return nil, err
+	}
+	if punch <= 0 {
+		punch = 1
+	}
+	maximum := float64(quantisedMax+1) / 166 * punch
+
+	colors := make([][3]float64, numX*numY)
+	for i := range colors {
+		if i == 0 {
+			value, err := decode83(hash[2:6])
+			if err != nil {
+				return nil, err
+			}
+			colors[i] = [3]float64{sRGBToLinear(uint8(value >> 16)), sRGBToLinear(uint8(value >> 8)), sRGBToLinear(uint8(value))}
+			continue
+		}
+		value, err := decode83(hash[4+i*2 : 6+i*2])
+		if err != nil {
+			return nil, err
+		}
+		colors[i] = [3]float64{
+			signPow(float64(value/(19*19)-9)/9, 2) * maximum,
+			signPow(float64((value/19)%19-9)/9, 2) * maximum,
+			signPow(float64(value%19-9)/9, 2) * maximum,
+		}
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var c [3]float64
+			for j := 0; j < numY; j++ {
+				cy := math.Cos(math.Pi * float64(y) * float64(j) / float64(height))
+				for i := 0; i < numX; i++ {
+					basis := math.Cos(math.Pi*float64(x)*float64(i)/float64(width)) * cy
+					f := colors[i+j*numX]
+					c[0] += f[0] * basis
+					c[1] += f[1] * basis
+					c[2] += f[2] * basis
+				}
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(linearToSRGB(c[0])), G: uint8(linearToSRGB(c[1])), B: uint8(linearToSRGB(c[2])), A: 255})
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,70 @@
+package blurhash
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	// left half red, right half blue
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			if x < 16 {
+				img.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+			} else {
+				img.SetNRGBA(x, y, color.NRGBA{B: 255, A: 255})
+			}
+		}
+	}
+	hash, err := Encode(4, 3, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, y, err := Components(hash); err != nil || x != 4 || y != 3 || len(hash) != 28 {
+		t.Fatalf("Components(%q) == %d, %d, %v", hash, x, y, err)
+	}
+
+	decoded, err := Decode(hash, 32, 16, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	left := color.NRGBAModel.Convert(decoded.At(2, 8)).(color.NRGBA)
+	right := color.NRGBAModel.Convert(decoded.At(29, 8)).(color.NRGBA)
+	if left.R < 200 || left.R <= left.B || right.B < 200 || right.B <= right.R {
+		t.Errorf("decoded colors left == %v, right == %v", left, right)
+	}
+}
+
+func TestSolidColor(t *testing.T) {
+	img := image.NewUniform(color.NRGBA{R: 10, G: 120, B: 240, A: 255})
+	hash, err := Encode(1, 1, &boundedUniform{img, image.Rect(0, 0, 4, 4)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(hash, 1, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := color.NRGBAModel.Convert(decoded.At(0, 0)).(color.NRGBA); c != (color.NRGBA{R: 10, G: 120, B: 240, A: 255}) {
+		t.Errorf("decoded color == %v", c)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, hash := range []string{"", "LEHV6nWB2yk8", "LEHV6nWB2yk8pyo0adR*.7kCMdnj!"} {
+		if _, err := Decode(hash, 4, 4, 1); err == nil {
+			t.Errorf("Decode(%q) must fail", hash)
+		}
+	}
+}
+
+type boundedUniform struct {
+	*image.Uniform
+	bounds image.Rectangle
+}
+
+func (b *boundedUniform) Bounds() image.Rectangle {
+	return b.bounds
+}
@@ -45,16 +45,27 @@ func deleteField(field *aorm.Field, scope *aorm.Scope) (changed bool) {
 		if media, ok := field.Field.Addr().Interface().(Media); ok {
 			media.Init(core.GetSiteFromDB(scope.DB()), field)
 
+			// content addressed files could be shared by other records
+			if ca, ok := media.(ContentAddresser); ok && ca.ContentAddressed() {
+				if media.Deletable() {
+					field.Field.Set(reflect.New(field.Struct.Type).Elem())
+					return true
+				}
+				return false
+			}
+
+			ctx := ScopeContext(scope)
+
 			for _, url := range media.OlderURL() {
 				if url == "" {continue}
-				if _, err := media.Remove(url); err != nil {
+				if _, err := Remove(ctx, media, url); err != nil {
 					scope.Err(errwrap.Wrap(err, "Remove OLD media %q", url))
 					return false
 				}
 			}
 
 			if media.Deletable() {
-				_, err := media.RemoveAll(media)
+				_, err := RemoveAll(ctx, media)
 				if err != nil {
 					scope.Err(errwrap.Wrap(err, "Remove media"))
 				} else {
@@ -87,4 +98,5 @@ func deleteCallback(scope *aorm.Scope) {
 func RegisterCallbacks(db *aorm.DB) {
 	db.Callback().Update().Before("gorm:before_update").Register(E_DELETE, deleteCallback)
 	db.Callback().Delete().Before("gorm:before_delete").Register(E_DELETE, deleteCallback)
+	registerStorageTxCallbacks(db)
 }
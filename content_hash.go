@@ -0,0 +1,87 @@
+package media
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"mime/multipart"
+	"path"
+
+	errwrap "github.com/moisespsena-go/error-wrap"
+)
+
+// ContentHashURLTemplate default URL template of content addressed medias
+var ContentHashURLTemplate = "/system/{{class}}/{{column}}/{{content_hash_path}}.{{extension}}"
+
+// ContentAddresser is implemented by medias stored under a path derived from its content
+type ContentAddresser interface {
+	ContentAddressed() bool
+	GetSHA256() string
+	SetSHA256(sum string)
+	ComputeSHA256() error
+}
+
+// ContentHashPath return the storage path of content hash, splitted into two levels of directories
+func ContentHashPath(sum string) string {
+	if len(sum) < 4 {
+		return sum
+	}
+	return path.Join(sum[0:2], sum[2:4], sum)
+}
+
+// HashReader return the hex encoded SHA-256 of reader content
+func HashReader(reader io.Reader) (sum string, err error) {
+	h := sha256.New()
+	if _, err = io.Copy(h, reader); err != nil {
+		return
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashingReader computes the SHA-256 of content while it is read
+type HashingReader struct {
+	io.Reader
+	hash hash.Hash
+}
+
+func NewHashingReader(reader io.Reader) *HashingReader {
+	h := sha256.New()
+	return &HashingReader{io.TeeReader(reader, h), h}
+}
+
+// Sum return the hex encoded SHA-256 of content read
+func (r *HashingReader) Sum() string {
+	return hex.EncodeToString(r.hash.Sum(nil))
+}
+
+// ContentAddressed return if the file is stored under a path derived from its content
+func (b *Base) ContentAddressed() bool {
+	return b.fieldOption != nil && b.fieldOption.Get(OPT_CONTENT_HASH) != ""
+}
+
+// GetSHA256 return the hex encoded SHA-256 of the file content
+func (b *Base) GetSHA256() string {
+	return b.SHA256
+}
+
+func (b *Base) SetSHA256(sum string) {
+	b.SHA256 = sum
+}
+
+// ComputeSHA256 hashes the uploaded file as is. Medias storing a transformed content, like the oss images with
+// stripped metadata, sets the hash of stored content with `SetSHA256`.
+func (b *Base) ComputeSHA256() (err error) {
+	if b.FileHeader == nil {
+		return
+	}
+	var file multipart.File
+	if file, err = b.FileHeader.Open(); err != nil {
+		return
+	}
+	defer file.Close()
+	if b.SHA256, err = HashReader(file); err != nil {
+		return errwrap.Wrap(err, "Hash %q", b.FileName)
+	}
+	return
+}
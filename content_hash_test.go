@@ -0,0 +1,21 @@
+package media
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestContentHash(t *testing.T) {
+	const sum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	if got, err := HashReader(strings.NewReader("hello world")); err != nil || got != sum {
+		t.Errorf("HashReader == %q, %v", got, err)
+	}
+	r := NewHashingReader(strings.NewReader("hello world"))
+	if data, _ := ioutil.ReadAll(r); string(data) != "hello world" || r.Sum() != sum {
+		t.Errorf("HashingReader read %q with sum %q", data, r.Sum())
+	}
+	if got, want := ContentHashPath(sum), "b9/4d/"+sum; got != want {
+		t.Errorf("ContentHashPath == %q, want %q", got, want)
+	}
+}
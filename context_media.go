@@ -1,3 +1,218 @@
 package media
 
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"os"
 
+	"github.com/ecletus/core"
+	"github.com/moisespsena-go/aorm"
+	errwrap "github.com/moisespsena-go/error-wrap"
+)
+
+var (
+	DB_CONTEXT      = PKG + ".context"
+	DB_CORE_CONTEXT = PKG + ".core_context"
+)
+
+// StoreContexter is implemented by medias that store honouring ctx cancellation
+type StoreContexter interface {
+	StoreContext(ctx context.Context, url string, reader io.Reader) error
+}
+
+// RetrieveContexter is implemented by medias that retrieve honouring ctx cancellation
+type RetrieveContexter interface {
+	RetrieveContext(ctx context.Context, url string) (*os.File, error)
+}
+
+// RemoveContexter is implemented by medias that remove honouring ctx cancellation
+type RemoveContexter interface {
+	RemoveContext(ctx context.Context, url string) (found bool, err error)
+}
+
+// MediaHandlerContext is implemented by handlers that honour ctx cancellation
+type MediaHandlerContext interface {
+	MediaHandler
+	HandleContext(ctx context.Context, media Media, file multipart.File, option *Option) error
+}
+
+// WithContext sets ctx into db, so media callbacks of db operations are cancelled with ctx
+func WithContext(db *aorm.DB, ctx context.Context) *aorm.DB {
+	return db.Set(DB_CONTEXT, ctx)
+}
+
+// WithRequestContext sets the request context into context DB, so the media callbacks of saves by ctx are
+// cancelled with the request and translate its validation errors. Call it where the record is saved, before the
+// save:
+//
+//	media.WithRequestContext(ctx).DB().Save(record)
+func WithRequestContext(ctx *core.Context) *core.Context {
+	if ctx == nil {
+		return ctx
+	}
+	if db := ctx.DB(); db != nil {
+		db = db.Set(DB_CORE_CONTEXT, ctx)
+		if ctx.Request != nil {
+			db = WithContext(db, ctx.Request.Context())
+		}
+		ctx.SetRawDB(db)
+	}
+	return ctx
+}
+
+// CoreContextOf returns the context set by WithRequestContext into scope, or nil if not set
+func CoreContextOf(scope *aorm.Scope) *core.Context {
+	if v, ok := scope.Get(DB_CORE_CONTEXT); ok {
+		ctx, _ := v.(*core.Context)
+		return ctx
+	}
+	return nil
+}
+
+// ContextOf returns the context of *aorm.DB or *aorm.Scope, or the background context if not set
+func ContextOf(v interface{}) context.Context {
+	var (
+		value interface{}
+		ok    bool
+	)
+	switch t := v.(type) {
+	case *aorm.DB:
+		value, ok = t.Get(DB_CONTEXT)
+	case *aorm.Scope:
+		value, ok = t.Get(DB_CONTEXT)
+	}
+	if ok {
+		if ctx, ok := value.(context.Context); ok && ctx != nil {
+			return ctx
+		}
+	}
+	return context.Background()
+}
+
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (n int, err error) {
+	if err = r.ctx.Err(); err != nil {
+		return
+	}
+	return r.reader.Read(p)
+}
+
+// NewContextReader returns a reader that fails with ctx error after ctx is done
+func NewContextReader(ctx context.Context, reader io.Reader) io.Reader {
+	if ctx.Done() == nil {
+		return reader
+	}
+	return &contextReader{ctx, reader}
+}
+
+// Store stores reader into media url honouring ctx cancellation.
+// If ctx has a storage transaction, the reader is staged until the transaction commits.
+func Store(ctx context.Context, media Media, url string, reader io.Reader) error {
+	if tx := StorageTxFromContext(ctx); tx != nil {
+		return tx.Store(ctx, media, url, reader)
+	}
+	return storeNow(ctx, media, url, reader)
+}
+
+func storeNow(ctx context.Context, media Media, url string, reader io.Reader) error {
+	if s, ok := media.(StoreContexter); ok {
+		return s.StoreContext(ctx, url, reader)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return media.Store(url, NewContextReader(ctx, reader))
+}
+
+// Retrieve retrieves the media url content honouring ctx cancellation
+func Retrieve(ctx context.Context, media Media, url string) (*os.File, error) {
+	if r, ok := media.(RetrieveContexter); ok {
+		return r.RetrieveContext(ctx, url)
+	}
+	return RunContext(ctx, func() (*os.File, error) {
+		return media.Retrieve(url)
+	})
+}
+
+// Remove removes the media url honouring ctx cancellation.
+// If ctx has a storage transaction, the removal is deferred until the transaction commits.
+func Remove(ctx context.Context, media Media, url string) (found bool, err error) {
+	if tx := StorageTxFromContext(ctx); tx != nil {
+		return tx.Remove(media, url)
+	}
+	return removeNow(ctx, media, url)
+}
+
+func removeNow(ctx context.Context, media Media, url string) (found bool, err error) {
+	if r, ok := media.(RemoveContexter); ok {
+		return r.RemoveContext(ctx, url)
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return media.Remove(url)
+}
+
+// RemoveAll removes the media file and its styles honouring ctx cancellation
+func RemoveAll(ctx context.Context, media Media) (found bool, err error) {
+	if found, err = Remove(ctx, media, media.URL()); err != nil {
+		return found, errwrap.Wrap(err, "Remove %q", media.GetFileName())
+	}
+	for _, key := range media.AllNames(media) {
+		var f bool
+		if f, err = Remove(ctx, media, StorageURL(media, key)); err != nil {
+			return f, errwrap.Wrap(err, "Remove style %q", key)
+		}
+		if f {
+			found = true
+		}
+	}
+	return
+}
+
+// CallHandler calls handler, using `HandleContext` if handler implements MediaHandlerContext
+func CallHandler(ctx context.Context, handler MediaHandler, media Media, file multipart.File, option *Option) error {
+	if h, ok := handler.(MediaHandlerContext); ok {
+		return h.HandleContext(ctx, media, file, option)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return handler.Handle(media, file, option)
+}
+
+// RunContext runs get and returns its file, or ctx error if ctx is done before get returns.
+// The file returned after ctx is done will be closed.
+func RunContext(ctx context.Context, get func() (*os.File, error)) (*os.File, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ctx.Done() == nil {
+		return get()
+	}
+	type result struct {
+		file *os.File
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		file, err := get()
+		done <- result{file, err}
+	}()
+	select {
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.file != nil {
+				r.file.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	case r := <-done:
+		return r.file, r.err
+	}
+}
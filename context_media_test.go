@@ -0,0 +1,71 @@
+package media
+
+import (
+	"context"
+	"io/ioutil"
+	"mime/multipart"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testContextKey struct{}
+
+type contextHandler struct {
+	testHandler
+	ctx context.Context
+}
+
+func (h *contextHandler) HandleContext(ctx context.Context, media Media, file multipart.File, option *Option) error {
+	h.ctx = ctx
+	return nil
+}
+
+func TestContextReader(t *testing.T) {
+	if r := strings.NewReader("data"); NewContextReader(context.Background(), r) != r {
+		t.Errorf("reader of context without cancellation should not be wrapped")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewContextReader(ctx, strings.NewReader("data"))
+	buf := make([]byte, 2)
+	if n, err := r.Read(buf); n != 2 || err != nil {
+		t.Errorf("Read() == %d, %v", n, err)
+	}
+	cancel()
+	if _, err := ioutil.ReadAll(r); err != context.Canceled {
+		t.Errorf("Read() after cancel == %v", err)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	file, err := RunContext(context.Background(), func() (*os.File, error) {
+		return os.Stdin, nil
+	})
+	if file != os.Stdin || err != nil {
+		t.Errorf("RunContext() == %v, %v", file, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	release := make(chan struct{})
+	defer close(release)
+	if _, err = RunContext(ctx, func() (*os.File, error) {
+		<-release
+		return nil, nil
+	}); err != context.DeadlineExceeded {
+		t.Errorf("RunContext() after deadline == %v", err)
+	}
+}
+
+func TestCallHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), testContextKey{}, "value"))
+	h := &contextHandler{}
+	if err := CallHandler(ctx, h, nil, nil, nil); err != nil || h.ctx != ctx {
+		t.Errorf("HandleContext should be called with ctx: %v", err)
+	}
+	cancel()
+	if err := CallHandler(ctx, testHandler{}, nil, nil, nil); err != context.Canceled {
+		t.Errorf("CallHandler() with context done == %v", err)
+	}
+}
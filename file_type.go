@@ -0,0 +1,424 @@
+package media
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp"
+)
+
+// SniffLen is the number of bytes read from the beginning of a file to detect its type
+var SniffLen = 4096
+
+// FileType is the type of a file detected from its content
+type FileType struct {
+	MIME string
+	Ext  string
+}
+
+var mimeExts = map[string][]string{
+	"image/jpeg":                     {"jpg", "jpeg", "jpe"},
+	"image/png":                      {"png"},
+	"image/gif":                      {"gif"},
+	"image/webp":                     {"webp"},
+	"image/bmp":                      {"bmp"},
+	"image/tiff":                     {"tif", "tiff"},
+	"image/heic":                     {"heic"},
+	"image/heif":                     {"heif"},
+	"image/avif":                     {"avif"},
+	"image/x-icon":                   {"ico"},
+	"image/svg+xml":                  {"svg", "svgz"},
+	"video/mp4":                      {"mp4", "m4v", "m4p"},
+	"video/quicktime":                {"mov"},
+	"video/webm":                     {"webm"},
+	"video/x-matroska":               {"mkv"},
+	"video/x-msvideo":                {"avi"},
+	"video/mpeg":                     {"mpeg", "mpg"},
+	"video/mp2t":                     {"ts"},
+	"video/ogg":                      {"ogv", "ogg"},
+	"application/ogg":                {"ogg", "ogv"},
+	"audio/mpeg":                     {"mp3"},
+	"audio/mp4":                      {"m4a"},
+	"audio/wave":                     {"wav"},
+	"application/pdf":                {"pdf"},
+	"application/zip":                {"zip"},
+	"application/gzip":               {"gz"},
+	"application/x-ole-storage":      {"doc", "xls", "ppt", "msg"},
+	"application/x-msdownload":       {"exe", "dll"},
+	"application/x-executable":       {"elf"},
+	"application/x-mach-binary":      {"macho"},
+	"text/x-shellscript":             {"sh"},
+	"text/plain":                     {"txt", "csv"},
+	"text/csv":                       {"csv"},
+	"text/html":                      {"html", "htm"},
+	"text/xml":                       {"xml"},
+	"application/rtf":                {"rtf"},
+	"application/vnd.openxmlformats": {"docx", "xlsx", "pptx"},
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   {"docx"},
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         {"xlsx"},
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": {"pptx"},
+	"application/vnd.oasis.opendocument.text":                                   {"odt"},
+	"application/vnd.oasis.opendocument.spreadsheet":                            {"ods"},
+	"application/vnd.oasis.opendocument.presentation":                           {"odp"},
+}
+
+var extMIMEs = func() map[string]string {
+	m := map[string]string{}
+	for typ, exts := range mimeExts {
+		for _, ext := range exts {
+			if old, ok := m[ext]; !ok || len(typ) < len(old) {
+				m[ext] = typ
+			}
+		}
+	}
+	// preferred types for ambiguous extensions
+	m["ogg"] = "video/ogg"
+	m["ogv"] = "video/ogg"
+	m["csv"] = "text/csv"
+	m["docx"] = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	m["xlsx"] = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	m["pptx"] = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	return m
+}()
+
+var imageMIMEFormats = map[string]imaging.Format{
+	"image/jpeg": imaging.JPEG,
+	"image/png":  imaging.PNG,
+	"image/gif":  imaging.GIF,
+	"image/tiff": imaging.TIFF,
+	"image/bmp":  imaging.BMP,
+	// WebP is decoded by golang.org/x/image/webp, but there is no encoder: the styles are encoded as PNG
+	"image/webp": imaging.PNG,
+}
+
+// imageDecodeOnlyMIMEs are the raster images which format has no encoder
+var imageDecodeOnlyMIMEs = map[string]bool{
+	"image/webp": true,
+}
+
+// IsZero return if the type is unknown
+func (t FileType) IsZero() bool {
+	return t.MIME == ""
+}
+
+// Generic return if the content does not identify a specific type
+func (t FileType) Generic() bool {
+	switch t.MIME {
+	case "", "application/octet-stream", "text/plain":
+		return true
+	}
+	return false
+}
+
+// Exts return the file extensions, without dot, accepted for this type
+func (t FileType) Exts() []string {
+	if exts, ok := mimeExts[t.MIME]; ok {
+		return exts
+	}
+	if t.Ext != "" {
+		return []string{t.Ext}
+	}
+	return nil
+}
+
+// HasExt check if ext is an extension accepted for this type
+func (t FileType) HasExt(ext string) bool {
+	ext = normalizeExt(ext)
+	for _, e := range t.Exts() {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// ImageFormat return the image format of a raster image
+func (t FileType) ImageFormat() (*imaging.Format, error) {
+	if f, ok := imageMIMEFormats[t.MIME]; ok {
+		return &f, nil
+	}
+	return nil, imaging.ErrUnsupportedFormat
+}
+
+// ImageReencodable return if the raster image is encoded again in its own format. WebP is only decoded, so
+// the original is kept as uploaded.
+func (t FileType) ImageReencodable() bool {
+	return t.IsImage() && !imageDecodeOnlyMIMEs[t.MIME]
+}
+
+// IsImage return if it is a raster image supported by the image handlers
+func (t FileType) IsImage() bool {
+	_, err := t.ImageFormat()
+	return err == nil
+}
+
+func (t FileType) IsVideo() bool {
+	return strings.HasPrefix(t.MIME, "video/") || t.MIME == "application/ogg"
+}
+
+func (t FileType) IsSVG() bool {
+	return t.MIME == "image/svg+xml"
+}
+
+// WithName return the type from name extension when the content was not conclusive.
+// Images, videos and SVG are never trusted by name.
+func (t FileType) WithName(name string) FileType {
+	if !t.Generic() {
+		return t
+	}
+	if nt := FileTypeFromName(name); !nt.IsZero() && !nt.IsImage() && !nt.IsVideo() && !nt.IsSVG() {
+		return nt
+	}
+	return t
+}
+
+func (t FileType) String() string {
+	return t.MIME
+}
+
+var urlQueryRegexp = regexp.MustCompile(`(\?.*?$)`)
+
+func normalizeExt(ext string) string {
+	return strings.ToLower(strings.TrimPrefix(ext, "."))
+}
+
+// FileTypeFromName guess the file type from name extension
+func FileTypeFromName(name string) FileType {
+	ext := normalizeExt(filepath.Ext(urlQueryRegexp.ReplaceAllString(name, "")))
+	if ext == "" {
+		return FileType{}
+	}
+	if typ, ok := extMIMEs[ext]; ok {
+		return FileType{MIME: typ, Ext: ext}
+	}
+	if typ := mime.TypeByExtension("." + ext); typ != "" {
+		typ, _, _ = mime.ParseMediaType(typ)
+		return FileType{MIME: typ, Ext: ext}
+	}
+	return FileType{}
+}
+
+type fileSignature struct {
+	mime  string
+	match func(data []byte) bool
+}
+
+func prefix(sig string) func(data []byte) bool {
+	return func(data []byte) bool {
+		return bytes.HasPrefix(data, []byte(sig))
+	}
+}
+
+// isPE return if data is a PE executable: the DOS header "MZ" pointing to the "PE\0\0" signature
+func isPE(data []byte) bool {
+	if len(data) < 0x40 || !bytes.HasPrefix(data, []byte("MZ")) {
+		return false
+	}
+	offset := int(binary.LittleEndian.Uint32(data[0x3C:]))
+	return offset >= 0x40 && offset+4 <= len(data) && string(data[offset:offset+4]) == "PE\x00\x00"
+}
+
+func riff(format string) func(data []byte) bool {
+	return func(data []byte) bool {
+		return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == format
+	}
+}
+
+var fileSignatures = []fileSignature{
+	{"image/tiff", prefix("II*\x00")},
+	{"image/tiff", prefix("MM\x00*")},
+	{"image/webp", riff("WEBP")},
+	{"video/x-msvideo", riff("AVI ")},
+	{"audio/wave", riff("WAVE")},
+	{"video/mpeg", prefix("\x00\x00\x01\xBA")},
+	{"video/mpeg", prefix("\x00\x00\x01\xB3")},
+	{"video/mp2t", func(data []byte) bool {
+		return len(data) > 376 && data[0] == 0x47 && data[188] == 0x47 && data[376] == 0x47
+	}},
+	{"application/x-ole-storage", prefix("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1")},
+	{"application/x-msdownload", isPE},
+	{"application/x-executable", prefix("\x7FELF")},
+	{"application/x-mach-binary", prefix("\xFE\xED\xFA\xCE")},
+	{"application/x-mach-binary", prefix("\xFE\xED\xFA\xCF")},
+	{"application/x-mach-binary", prefix("\xCE\xFA\xED\xFE")},
+	{"application/x-mach-binary", prefix("\xCF\xFA\xED\xFE")},
+	{"text/x-shellscript", prefix("#!")},
+}
+
+var ftypBrands = map[string]string{
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"hevc": "image/heic",
+	"hevx": "image/heic",
+	"heim": "image/heic",
+	"heis": "image/heic",
+	"mif1": "image/heif",
+	"msf1": "image/heif",
+	"avif": "image/avif",
+	"avis": "image/avif",
+	"qt  ": "video/quicktime",
+	"M4A ": "audio/mp4",
+}
+
+func detectFtyp(data []byte) (FileType, bool) {
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return FileType{}, false
+	}
+	brand := string(data[8:12])
+	if typ, ok := ftypBrands[brand]; ok {
+		return FileType{MIME: typ, Ext: mimeExts[typ][0]}, true
+	}
+	if brand == "M4V " {
+		return FileType{MIME: "video/mp4", Ext: "m4v"}, true
+	}
+	return FileType{MIME: "video/mp4", Ext: "mp4"}, true
+}
+
+func detectEBML(data []byte) (FileType, bool) {
+	if !bytes.HasPrefix(data, []byte("\x1A\x45\xDF\xA3")) {
+		return FileType{}, false
+	}
+	if bytes.Contains(data, []byte("webm")) {
+		return FileType{MIME: "video/webm", Ext: "webm"}, true
+	}
+	return FileType{MIME: "video/x-matroska", Ext: "mkv"}, true
+}
+
+func detectZip(data []byte) (FileType, bool) {
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return FileType{}, false
+	}
+	// OpenDocument stores an uncompressed "mimetype" entry first
+	if len(data) > 38 && string(data[30:38]) == "mimetype" {
+		rest := data[38:]
+		for typ := range mimeExts {
+			if strings.HasPrefix(typ, "application/vnd.oasis.opendocument.") && bytes.HasPrefix(rest, []byte(typ)) {
+				return FileType{MIME: typ, Ext: mimeExts[typ][0]}, true
+			}
+		}
+	}
+	if bytes.Contains(data, []byte("[Content_Types].xml")) || bytes.Contains(data, []byte("_rels/.rels")) {
+		for dir, typ := range map[string]string{
+			"word/": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+			"xl/":   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			"ppt/":  "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		} {
+			if bytes.Contains(data, []byte(dir)) {
+				return FileType{MIME: typ, Ext: mimeExts[typ][0]}, true
+			}
+		}
+		return FileType{MIME: "application/vnd.openxmlformats"}, true
+	}
+	return FileType{MIME: "application/zip", Ext: "zip"}, true
+}
+
+var (
+	// the XML declaration and other processing instructions, comments, and DOCTYPE with internal subset
+	xmlPreambleRegexp = regexp.MustCompile(`^(?is)(\s|<\?.*?\?>|<!--.*?-->|<!DOCTYPE[^>\[]*(\[.*?\])?\s*>)*`)
+	// the root svg, with namespace prefix or not
+	svgStartRegexp = regexp.MustCompile(`^<([a-z_][\w.-]*:)?svg[\s>/]`)
+)
+
+func isSVG(data []byte) bool {
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+	data = xmlPreambleRegexp.ReplaceAll(data, nil)
+	return svgStartRegexp.Match(bytes.ToLower(data))
+}
+
+func detectGzip(data []byte) (FileType, bool) {
+	if !bytes.HasPrefix(data, []byte("\x1F\x8B")) {
+		return FileType{}, false
+	}
+	if r, err := gzip.NewReader(bytes.NewReader(data)); err == nil {
+		var buf = make([]byte, SniffLen)
+		n, _ := io.ReadFull(r, buf)
+		if isSVG(buf[:n]) {
+			return FileType{MIME: "image/svg+xml", Ext: "svgz"}, true
+		}
+	}
+	return FileType{MIME: "application/gzip", Ext: "gz"}, true
+}
+
+// DetectFileType detect the file type from the first bytes of content
+func DetectFileType(data []byte) FileType {
+	if len(data) == 0 {
+		return FileType{}
+	}
+	for _, detect := range []func([]byte) (FileType, bool){detectFtyp, detectEBML, detectZip, detectGzip} {
+		if typ, ok := detect(data); ok {
+			return typ
+		}
+	}
+	for _, sig := range fileSignatures {
+		if sig.match(data) {
+			return FileType{MIME: sig.mime, Ext: mimeExts[sig.mime][0]}
+		}
+	}
+	if isSVG(data) {
+		return FileType{MIME: "image/svg+xml", Ext: "svg"}
+	}
+	typ, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	if typ == "image/vnd.microsoft.icon" {
+		typ = "image/x-icon"
+	}
+	var t = FileType{MIME: typ}
+	if exts := mimeExts[typ]; len(exts) > 0 {
+		t.Ext = exts[0]
+	}
+	return t
+}
+
+// DetectFileTypeReaderAt detect the file type without change the reader offset
+func DetectFileTypeReaderAt(r io.ReaderAt) (FileType, error) {
+	var buf = make([]byte, SniffLen)
+	n, err := r.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return FileType{}, err
+	}
+	return DetectFileType(buf[:n]), nil
+}
+
+// DetectFileTypeReader detect the file type of reader. The returned reader replays the sniffed bytes.
+func DetectFileTypeReader(r io.Reader) (FileType, io.Reader, error) {
+	var buf = make([]byte, SniffLen)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return FileType{}, r, err
+	}
+	return DetectFileType(buf[:n]), io.MultiReader(bytes.NewReader(buf[:n]), r), nil
+}
+
+// DetectFileHeaderType detect the file type of file header content
+func DetectFileHeaderType(header FileHeader) (typ FileType, err error) {
+	var file multipart.File
+	if file, err = header.Open(); err != nil {
+		return
+	}
+	defer file.Close()
+	return DetectFileTypeReaderAt(file)
+}
+
+// DetectDataFileType detect the file type of values accepted by `Media.Set`
+func DetectDataFileType(data interface{}) (FileType, error) {
+	switch values := data.(type) {
+	case *os.File:
+		return DetectFileTypeReaderAt(values)
+	case FileHeader:
+		return DetectFileHeaderType(values)
+	case []*multipart.FileHeader:
+		if len(values) > 0 {
+			return DetectFileHeaderType(values[0])
+		}
+	}
+	return FileType{}, nil
+}
@@ -0,0 +1,177 @@
+package media
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func peData(offset uint32) []byte {
+	data := make([]byte, 0x100)
+	copy(data, "MZ")
+	binary.LittleEndian.PutUint32(data[0x3C:], offset)
+	copy(data[0x80:], "PE\x00\x00")
+	return data
+}
+
+func gzipData(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(data))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipData(t *testing.T, names ...string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		if _, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectFileType(t *testing.T) {
+	odt := zipData(t)
+	odt = append(append([]byte(nil), odt[:30]...), []byte("mimetypeapplication/vnd.oasis.opendocument.text")...)
+	copy(odt, "PK\x03\x04")
+
+	cases := []struct {
+		name string
+		data []byte
+		mime string
+		ext  string
+	}{
+		{"empty", nil, "", ""},
+		{"jpeg", []byte("\xFF\xD8\xFF\xE0\x00\x10JFIF\x00"), "image/jpeg", "jpg"},
+		{"png", []byte("\x89PNG\r\n\x1A\n\x00\x00\x00\x0DIHDR"), "image/png", "png"},
+		{"gif", []byte("GIF89a\x01\x00\x01\x00"), "image/gif", "gif"},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), "image/webp", "webp"},
+		{"wav", []byte("RIFF\x24\x00\x00\x00WAVEfmt "), "audio/wave", "wav"},
+		{"avi", []byte("RIFF\x24\x00\x00\x00AVI LIST"), "video/x-msvideo", "avi"},
+		{"tiff le", []byte("II*\x00\x08\x00\x00\x00"), "image/tiff", "tif"},
+		{"tiff be", []byte("MM\x00*\x00\x00\x00\x08"), "image/tiff", "tif"},
+		{"bmp", []byte("BM\x3A\x00\x00\x00\x00\x00\x00\x00\x36\x00\x00\x00"), "image/bmp", "bmp"},
+		{"pdf", []byte("%PDF-1.4\n"), "application/pdf", "pdf"},
+		{"mp4", []byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00"), "video/mp4", "mp4"},
+		{"m4v", []byte("\x00\x00\x00\x18ftypM4V \x00\x00\x02\x00"), "video/mp4", "m4v"},
+		{"mov", []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x02\x00"), "video/quicktime", "mov"},
+		{"heic", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), "image/heic", "heic"},
+		{"avif", []byte("\x00\x00\x00\x18ftypavif\x00\x00\x00\x00"), "image/avif", "avif"},
+		{"webm", []byte("\x1A\x45\xDF\xA3\x9F\x42\x82\x84webm"), "video/webm", "webm"},
+		{"mkv", []byte("\x1A\x45\xDF\xA3\x9F\x42\x82\x88matroska"), "video/x-matroska", "mkv"},
+		{"ole", []byte("\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1\x00"), "application/x-ole-storage", "doc"},
+		{"pe", peData(0x80), "application/x-msdownload", "exe"},
+		{"mz without pe", []byte("MZ is just text"), "text/plain", "txt"},
+		{"mz pe out of range", peData(0xFFFF), "application/octet-stream", ""},
+		{"elf", []byte("\x7FELF\x02\x01\x01"), "application/x-executable", "elf"},
+		{"macho", []byte("\xCF\xFA\xED\xFE\x07\x00"), "application/x-mach-binary", "macho"},
+		{"shell", []byte("#!/bin/sh\necho"), "text/x-shellscript", "sh"},
+		{"html", []byte("<!DOCTYPE html><html>"), "text/html", "html"},
+		{"text", []byte("hello world"), "text/plain", "txt"},
+		{"zip", zipData(t, "a.txt"), "application/zip", "zip"},
+		{"docx", zipData(t, "[Content_Types].xml", "word/document.xml"), "application/vnd.openxmlformats-officedocument.wordprocessingml.document", "docx"},
+		{"xlsx", zipData(t, "[Content_Types].xml", "xl/workbook.xml"), "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx"},
+		{"odt", odt, "application/vnd.oasis.opendocument.text", "odt"},
+		{"gzip", gzipData(t, "hello"), "application/gzip", "gz"},
+		{"svgz", gzipData(t, `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"/>`), "image/svg+xml", "svgz"},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), "image/svg+xml", "svg"},
+		{"svg bom preamble", []byte("\xEF\xBB\xBF<?xml version=\"1.0\"?>\n<!-- c -->\n<!DOCTYPE svg PUBLIC \"-//W3C//DTD SVG 1.1//EN\" \"x.dtd\">\n<SVG>"), "image/svg+xml", "svg"},
+		{"svg prefix of other tag", []byte(`<svgx></svgx>`), "text/plain", "txt"},
+		{"svg namespace prefix", []byte(`<s:svg xmlns:s="http://www.w3.org/2000/svg"><s:script/></s:svg>`), "image/svg+xml", "svg"},
+		{"svg doctype internal subset", []byte("<?xml version=\"1.0\"?><!DOCTYPE svg [\n<!ENTITY x \"<b>\">\n]>\n<svg>&x;</svg>"), "image/svg+xml", "svg"},
+		{"svg stylesheet instruction", []byte(`<?xml-stylesheet href="a.css"?><svg/>`), "image/svg+xml", "svg"},
+		{"svg other instruction", []byte(`<?foo bar?><svg/>`), "image/svg+xml", "svg"},
+		{"svg prefix of other prefixed tag", []byte(`<s:svgx></s:svgx>`), "text/plain", "txt"},
+	}
+	for _, c := range cases {
+		typ := DetectFileType(c.data)
+		if typ.MIME != c.mime || typ.Ext != c.ext {
+			t.Errorf("%s: DetectFileType() == %q %q, want %q %q", c.name, typ.MIME, typ.Ext, c.mime, c.ext)
+		}
+	}
+}
+
+func TestFileTypeWithName(t *testing.T) {
+	var (
+		text = FileType{MIME: "text/plain", Ext: "txt"}
+		png  = FileType{MIME: "image/png", Ext: "png"}
+	)
+	cases := []struct {
+		typ  FileType
+		name string
+		mime string
+	}{
+		{text, "a.csv", "text/csv"},
+		{text, "a.jpg", "text/plain"},
+		{text, "a.mp4", "text/plain"},
+		{text, "a.svg", "text/plain"},
+		{text, "a.SVGZ", "text/plain"},
+		{text, "noext", "text/plain"},
+		{FileType{}, "a.docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{png, "a.csv", "image/png"},
+	}
+	for _, c := range cases {
+		if got := c.typ.WithName(c.name).MIME; got != c.mime {
+			t.Errorf("%s.WithName(%q) == %q, want %q", c.typ, c.name, got, c.mime)
+		}
+	}
+}
+
+func TestFileTypeFromName(t *testing.T) {
+	cases := map[string]string{
+		"/a/b.JPG?x=1": "image/jpeg",
+		"x.ogg":        "video/ogg",
+		"x.svgz":       "image/svg+xml",
+		"x.docx":       "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"noext":        "",
+	}
+	for name, want := range cases {
+		if got := FileTypeFromName(name).MIME; got != want {
+			t.Errorf("FileTypeFromName(%q) == %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestFileTypeImageFormat(t *testing.T) {
+	cases := []struct {
+		mime        string
+		format      imaging.Format
+		reencoded   bool
+		unsupported bool
+	}{
+		{"image/jpeg", imaging.JPEG, true, false},
+		{"image/png", imaging.PNG, true, false},
+		{"image/gif", imaging.GIF, true, false},
+		{"image/tiff", imaging.TIFF, true, false},
+		{"image/bmp", imaging.BMP, true, false},
+		{"image/webp", imaging.PNG, false, false},
+		{"image/svg+xml", 0, false, true},
+		{"text/plain", 0, false, true},
+	}
+	for _, c := range cases {
+		typ := FileType{MIME: c.mime}
+		format, err := typ.ImageFormat()
+		if c.unsupported {
+			if err == nil || typ.IsImage() {
+				t.Errorf("%s.ImageFormat() == %v, want error", c.mime, format)
+			}
+		} else if err != nil || *format != c.format {
+			t.Errorf("%s.ImageFormat() == %v, %v, want %v", c.mime, format, err, c.format)
+		}
+		if got := typ.ImageReencodable(); got != c.reencoded {
+			t.Errorf("%s.ImageReencodable() == %v, want %v", c.mime, got, c.reencoded)
+		}
+	}
+}
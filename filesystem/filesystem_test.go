@@ -24,10 +24,10 @@ type MyFileSystem struct {
 
 func (MyFileSystem) GetSizes() map[string]*oss.Size {
 	return map[string]*oss.Size{
-		"small1": {20, 10},
-		"small2": {20, 10},
-		"square": {30, 30},
-		"big":    {50, 50},
+		"small1": {Width: 20, Height: 10},
+		"small2": {Width: 20, Height: 10},
+		"square": {Width: 30, Height: 30},
+		"big":    {Width: 50, Height: 50},
 	}
 }
 
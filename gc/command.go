@@ -0,0 +1,61 @@
+package gc
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Main parses the command arguments into c, runs it and prints the orphans into out.
+// The flags default to the fields of c, or to DefaultMinAge and DefaultPrefixes.
+//
+//	-delete          delete the orphaned files
+//	-min-age 24h     ignore files modified in the last 24 hours
+//	-prefix /system  comma separated directories to walk
+func Main(ctx context.Context, c *Collector, args []string, out io.Writer) (err error) {
+	if err = parseArgs(c, args, out); err != nil {
+		return
+	}
+
+	report, err := c.Run(ctx)
+	if report != nil {
+		for _, orphan := range report.Orphans {
+			switch {
+			case orphan.Err != nil:
+				fmt.Fprintf(out, "%s\terror: %v\n", orphan.Path, orphan.Err)
+			case orphan.Deleted:
+				fmt.Fprintf(out, "%s\tdeleted\n", orphan.Path)
+			default:
+				fmt.Fprintln(out, orphan.Path)
+			}
+		}
+		fmt.Fprintln(out, report)
+	}
+	return
+}
+
+func parseArgs(c *Collector, args []string, out io.Writer) (err error) {
+	var (
+		flags    = flag.NewFlagSet("media-gc", flag.ContinueOnError)
+		prefixes string
+		minAge   = c.MinAge
+		defaults = c.Prefixes
+	)
+	if minAge == 0 {
+		minAge = DefaultMinAge
+	}
+	if len(defaults) == 0 {
+		defaults = DefaultPrefixes
+	}
+	flags.SetOutput(out)
+	flags.BoolVar(&c.Delete, "delete", c.Delete, "delete the orphaned files")
+	flags.DurationVar(&c.MinAge, "min-age", minAge, "ignore files modified after now - min-age")
+	flags.StringVar(&prefixes, "prefix", strings.Join(defaults, ","), "comma separated directories to walk")
+	if err = flags.Parse(args); err != nil {
+		return
+	}
+	c.Prefixes = strings.Split(prefixes, ",")
+	return
+}
@@ -0,0 +1,236 @@
+// Package gc finds, and optionally deletes, stored files not referenced by any media column.
+package gc
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ecletus/media"
+	"github.com/ecletus/media/media_library"
+	"github.com/ecletus/oss"
+	"github.com/ecletus/serializable_meta"
+	"github.com/moisespsena-go/aorm"
+	errwrap "github.com/moisespsena-go/error-wrap"
+)
+
+// DefaultPrefixes are the directories walked when Collector.Prefixes is empty
+var DefaultPrefixes = []string{"/system"}
+
+// DefaultMinAge is the MinAge used when Collector.MinAge is zero
+var DefaultMinAge = time.Hour
+
+// BatchSize is the number of records loaded per query
+var BatchSize = 500
+
+// Collector finds the orphaned files of Storage
+type Collector struct {
+	Storage oss.StorageInterface
+	DB      *aorm.DB
+	// Models are the models with media columns. QorMediaLibrary is always included.
+	Models []interface{}
+	// Prefixes are the walked directories
+	Prefixes []string
+	// MinAge files modified after now - MinAge are ignored, so files of saves in progress are kept
+	MinAge time.Duration
+	// Delete deletes the orphaned files
+	Delete bool
+}
+
+// Orphan is a file not referenced by any media column
+type Orphan struct {
+	Path         string
+	LastModified *time.Time
+	Deleted      bool
+	Err          error
+}
+
+// Report is the result of a collection
+type Report struct {
+	Scanned    int
+	Referenced int
+	Skipped    int
+	Orphans    []*Orphan
+}
+
+// Deleted return the number of deleted files
+func (r *Report) Deleted() (count int) {
+	for _, o := range r.Orphans {
+		if o.Deleted {
+			count++
+		}
+	}
+	return
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("%d files scanned, %d referenced, %d skipped by age, %d orphans, %d deleted",
+		r.Scanned, r.Referenced, r.Skipped, len(r.Orphans), r.Deleted())
+}
+
+// References is the set of referenced urls
+type References map[string]bool
+
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// Add adds url, external urls are ignored
+func (refs References) Add(url string) {
+	if url == "" || strings.Contains(url, "//") {
+		// empty or external url
+		return
+	}
+	refs[cleanPath(url)] = true
+}
+
+// AddMedia adds the url of m and the urls of all its styles
+func (refs References) AddMedia(m media.Media) {
+	if m.IsZero() {
+		return
+	}
+	refs.Add(m.URL())
+	for _, name := range m.AllNames(m) {
+		refs.Add(media.StorageURL(m, name))
+	}
+}
+
+// Has return if p is referenced
+func (refs References) Has(p string) bool {
+	return refs[cleanPath(p)]
+}
+
+// References collects the urls referenced by the media columns of models
+func (c *Collector) References(ctx context.Context) (refs References, err error) {
+	refs = References{}
+	models := append([]interface{}{&media_library.QorMediaLibrary{}}, c.Models...)
+	for _, model := range models {
+		if err = c.collectModel(ctx, refs, model); err != nil {
+			return nil, errwrap.Wrap(err, "Model %T", model)
+		}
+	}
+	return
+}
+
+func (c *Collector) collectModel(ctx context.Context, refs References, model interface{}) (err error) {
+	var (
+		typ   = reflect.Indirect(reflect.ValueOf(model)).Type()
+		scope = c.DB.NewScope(model)
+		order = scope.Quote(scope.PrimaryKey())
+	)
+	for offset := 0; ; offset += BatchSize {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		records := reflect.New(reflect.SliceOf(reflect.PtrTo(typ)))
+		if err = c.DB.Order(order).Offset(offset).Limit(BatchSize).Find(records.Interface()).Error; err != nil {
+			return
+		}
+		records = records.Elem()
+		for i := 0; i < records.Len(); i++ {
+			collectValue(refs, records.Index(i))
+		}
+		if records.Len() < BatchSize {
+			return
+		}
+	}
+}
+
+func collectValue(refs References, value reflect.Value) {
+	value = reflect.Indirect(value)
+	if !value.IsValid() {
+		return
+	}
+
+	if value.CanAddr() {
+		switch v := value.Addr().Interface().(type) {
+		case media.Media:
+			refs.AddMedia(v)
+			return
+		case *media_library.MediaBox:
+			for _, file := range v.Files {
+				refs.Add(file.Url)
+			}
+			return
+		case serializable_meta.SerializableMetaInterface:
+			// the medias of serialized argument are stored by the oss callbacks too
+			if arg := v.GetSerializableArgument(v); arg != nil {
+				collectValue(refs, reflect.ValueOf(arg))
+			}
+		}
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).PkgPath == "" {
+				collectValue(refs, value.Field(i))
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			collectValue(refs, value.Index(i))
+		}
+	}
+}
+
+// Run walks the prefixes, reports the files not referenced and deletes them if `Delete` is set
+func (c *Collector) Run(ctx context.Context) (report *Report, err error) {
+	var refs References
+	if refs, err = c.References(ctx); err != nil {
+		return
+	}
+	return c.Walk(ctx, refs)
+}
+
+// Walk walks the prefixes, reports the files not in refs and deletes them if `Delete` is set
+func (c *Collector) Walk(ctx context.Context, refs References) (report *Report, err error) {
+	var (
+		prefixes = c.Prefixes
+		minAge   = c.MinAge
+	)
+	if len(prefixes) == 0 {
+		prefixes = DefaultPrefixes
+	}
+	if minAge == 0 {
+		minAge = DefaultMinAge
+	}
+	limit := time.Now().Add(-minAge)
+
+	report = &Report{}
+	for _, prefix := range prefixes {
+		var objects []*oss.Object
+		if objects, err = c.Storage.List(prefix); err != nil {
+			return report, errwrap.Wrap(err, "List %q", prefix)
+		}
+		for _, obj := range objects {
+			if err = ctx.Err(); err != nil {
+				return
+			}
+			report.Scanned++
+			if refs.Has(obj.Path) {
+				report.Referenced++
+				continue
+			}
+			if obj.LastModified != nil && obj.LastModified.After(limit) {
+				report.Skipped++
+				continue
+			}
+			orphan := &Orphan{Path: cleanPath(obj.Path), LastModified: obj.LastModified}
+			if c.Delete {
+				if orphan.Err = c.Storage.Delete(orphan.Path); orphan.Err == nil {
+					orphan.Deleted = true
+				}
+			}
+			report.Orphans = append(report.Orphans, orphan)
+		}
+	}
+	sort.Slice(report.Orphans, func(i, j int) bool {
+		return report.Orphans[i].Path < report.Orphans[j].Path
+	})
+	return
+}
@@ -0,0 +1,135 @@
+package gc
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ecletus/media/media_library"
+	"github.com/ecletus/oss"
+	"github.com/ecletus/serializable_meta"
+)
+
+// memStorage is a storage which objects are kept in memory
+type memStorage struct {
+	oss.StorageInterface
+	objects map[string]time.Time
+}
+
+func (s *memStorage) List(prefix string) (objects []*oss.Object, err error) {
+	for p, modified := range s.objects {
+		if strings.HasPrefix(p, prefix+"/") {
+			modified := modified
+			objects = append(objects, &oss.Object{Path: p, LastModified: &modified})
+		}
+	}
+	return
+}
+
+func (s *memStorage) Delete(p string) error {
+	delete(s.objects, p)
+	return nil
+}
+
+type serializedMeta struct {
+	serializable_meta.SerializableMetaInterface
+	argument interface{}
+}
+
+func (m *serializedMeta) GetSerializableArgument(serializable_meta.SerializableMetaInterface) interface{} {
+	return m.argument
+}
+
+func TestCollectValue(t *testing.T) {
+	type item struct {
+		Box   media_library.MediaBox
+		Boxes []media_library.MediaBox
+	}
+	var (
+		refs  = References{}
+		value = struct {
+			Item  item
+			Items []*item
+			Meta  serializedMeta
+		}{
+			Item:  item{Box: media_library.MediaBox{Files: []media_library.File{{Url: "/system/a.jpg"}}}},
+			Items: []*item{{Boxes: []media_library.MediaBox{{Files: []media_library.File{{Url: "system/b.jpg"}, {Url: "//cdn/c.jpg"}}}}}},
+			Meta:  serializedMeta{argument: &item{Box: media_library.MediaBox{Files: []media_library.File{{Url: "/system/d.jpg"}}}}},
+		}
+	)
+	collectValue(refs, reflect.ValueOf(&value))
+	want := References{"/system/a.jpg": true, "/system/b.jpg": true, "/system/d.jpg": true}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("references == %v, want %v", refs, want)
+	}
+}
+
+func TestCollectorWalk(t *testing.T) {
+	var (
+		now     = time.Now()
+		storage = &memStorage{objects: map[string]time.Time{
+			"/system/a.jpg":   now.Add(-2 * time.Hour),
+			"/system/b.jpg":   now.Add(-2 * time.Hour),
+			"/system/new.jpg": now,
+			"/other/c.jpg":    now.Add(-2 * time.Hour),
+		}}
+		refs = References{}
+		c    = &Collector{Storage: storage}
+	)
+	refs.Add("/system/a.jpg")
+
+	report, err := c.Walk(context.Background(), refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Scanned != 3 || report.Referenced != 1 || report.Skipped != 1 || len(report.Orphans) != 1 ||
+		report.Orphans[0].Path != "/system/b.jpg" || report.Deleted() != 0 {
+		t.Errorf("report == %v %v", report, report.Orphans)
+	}
+	if len(storage.objects) != 4 {
+		t.Errorf("files should be deleted only by Delete")
+	}
+
+	c.Delete = true
+	c.Prefixes = []string{"/system", "/other"}
+	if report, err = c.Walk(context.Background(), refs); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for p := range storage.objects {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	if report.Deleted() != 2 || !reflect.DeepEqual(paths, []string{"/system/a.jpg", "/system/new.jpg"}) {
+		t.Errorf("report == %v, files == %v", report, paths)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	c := &Collector{MinAge: 24 * time.Hour, Prefixes: []string{"/system/private", "/system/public"}}
+	if err := parseArgs(c, nil, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if c.MinAge != 24*time.Hour || !reflect.DeepEqual(c.Prefixes, []string{"/system/private", "/system/public"}) || c.Delete {
+		t.Errorf("defaults of collector == %v %v %v", c.MinAge, c.Prefixes, c.Delete)
+	}
+
+	c = &Collector{}
+	if err := parseArgs(c, nil, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if c.MinAge != DefaultMinAge || !reflect.DeepEqual(c.Prefixes, DefaultPrefixes) {
+		t.Errorf("package defaults == %v %v", c.MinAge, c.Prefixes)
+	}
+
+	if err := parseArgs(c, []string{"-delete", "-min-age", "2h", "-prefix", "/a,/b"}, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if c.MinAge != 2*time.Hour || !reflect.DeepEqual(c.Prefixes, []string{"/a", "/b"}) || !c.Delete {
+		t.Errorf("flags == %v %v %v", c.MinAge, c.Prefixes, c.Delete)
+	}
+}
@@ -1,36 +1,313 @@
 package media
 
 import (
+	"context"
+	"fmt"
 	_ "image/jpeg"
 	"mime/multipart"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/moisespsena-go/error-wrap"
 )
 
-var mediaHandlers = make(map[string]MediaHandler)
-
 // MediaHandler media library handler interface, defined which files could be handled, and the handler
 type MediaHandler interface {
 	CouldHandle(media Media) bool
 	Handle(media Media, file multipart.File, option *Option) error
 }
 
-// RegisterMediaHandler register Media library handler
-func RegisterMediaHandler(name string, handler MediaHandler) {
-	mediaHandlers[name] = handler
+// HandlerOption defines the position of a handler in the pipeline
+type HandlerOption struct {
+	// Priority handlers with lower priority runs first
+	Priority int
+	// Before names of handlers that must run after this handler
+	Before []string
+	// After names of handlers that must run before this handler
+	After []string
+	// Replaces names of handlers disabled by this handler
+	Replaces []string
 }
 
-func MediaHandlers() map[string]MediaHandler {
-	return mediaHandlers
+// RegisteredHandler is a handler registered into HandlerRegistry
+type RegisteredHandler struct {
+	HandlerOption
+	Name    string
+	Handler MediaHandler
 }
 
-func Handle(media Media, cb func(name string, handle MediaHandler) error) (err error) {
-	for name, handler := range mediaHandlers {
-		if handler.CouldHandle(media) {
-			if err = cb(name, handler); err != nil {
-				return errwrap.Wrap(err, "Media Handler %q", name)
+// HandlerResult is the result of a handler execution
+type HandlerResult struct {
+	Name     string
+	Skipped  bool
+	Duration time.Duration
+	Err      error
+}
+
+// HandleReport is the per handler result of a pipeline execution, in the execution order
+type HandleReport []*HandlerResult
+
+// Handled return names of handlers executed
+func (report HandleReport) Handled() (names []string) {
+	for _, r := range report {
+		if !r.Skipped {
+			names = append(names, r.Name)
+		}
+	}
+	return
+}
+
+// Get return the result of handler
+func (report HandleReport) Get(name string) *HandlerResult {
+	for _, r := range report {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+func (report HandleReport) String() string {
+	var parts []string
+	for _, r := range report {
+		switch {
+		case r.Skipped:
+			parts = append(parts, r.Name+": skipped")
+		case r.Err != nil:
+			parts = append(parts, fmt.Sprintf("%s: %v (%s)", r.Name, r.Err, r.Duration))
+		default:
+			parts = append(parts, fmt.Sprintf("%s: ok (%s)", r.Name, r.Duration))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// HandlerRegistry is an ordered set of media handlers
+type HandlerRegistry struct {
+	mu       sync.RWMutex
+	handlers map[string]*RegisteredHandler
+	sorted   []*RegisteredHandler
+}
+
+func NewHandlerRegistry() *HandlerRegistry {
+	return &HandlerRegistry{handlers: map[string]*RegisteredHandler{}}
+}
+
+// MediaHandlerRegistry is the registry used by `RegisterMediaHandler` and `Handle`
+var MediaHandlerRegistry = NewHandlerRegistry()
+
+// Register add handler. Returns error if name already registered.
+func (r *HandlerRegistry) Register(name string, handler MediaHandler, option ...HandlerOption) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.handlers[name]; ok {
+		return fmt.Errorf("media handler %q already registered by %T", name, old.Handler)
+	}
+	h := &RegisteredHandler{Name: name, Handler: handler}
+	for _, opt := range option {
+		h.HandlerOption = opt
+	}
+	r.handlers[name] = h
+	r.sorted = nil
+	return nil
+}
+
+// Unregister remove handler
+func (r *HandlerRegistry) Unregister(name string) (ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok = r.handlers[name]; ok {
+		delete(r.handlers, name)
+		r.sorted = nil
+	}
+	return
+}
+
+// Get return the registered handler
+func (r *HandlerRegistry) Get(name string) *RegisteredHandler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.handlers[name]
+}
+
+// Handlers return all registered handlers, including replaced handlers
+func (r *HandlerRegistry) Handlers() map[string]MediaHandler {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var handlers = make(map[string]MediaHandler, len(r.handlers))
+	for name, h := range r.handlers {
+		handlers[name] = h.Handler
+	}
+	return handlers
+}
+
+// Sorted return active handlers in execution order.
+// Returns error if two handlers replaces the same handler or the dependencies have a cycle.
+func (r *HandlerRegistry) Sorted() (handlers []*RegisteredHandler, err error) {
+	r.mu.RLock()
+	if r.sorted != nil {
+		defer r.mu.RUnlock()
+		return r.sorted, nil
+	}
+	r.mu.RUnlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if handlers, err = sortHandlers(r.handlers); err == nil {
+		r.sorted = handlers
+	}
+	return
+}
+
+func sortHandlers(all map[string]*RegisteredHandler) ([]*RegisteredHandler, error) {
+	var replacedBy = map[string]string{}
+	for _, h := range all {
+		for _, name := range h.Replaces {
+			if other, ok := replacedBy[name]; ok {
+				return nil, fmt.Errorf("media handler %q is replaced by %q and %q", name, other, h.Name)
+			}
+			replacedBy[name] = h.Name
+		}
+	}
+
+	resolve := func(name string) (string, bool) {
+		for i := 0; i <= len(all); i++ {
+			next, ok := replacedBy[name]
+			if !ok {
+				_, ok = all[name]
+				return name, ok
 			}
+			name = next
+		}
+		return "", false
+	}
+
+	var (
+		active   = map[string]*RegisteredHandler{}
+		edges    = map[string]map[string]bool{}
+		inDegree = map[string]int{}
+	)
+	for name, h := range all {
+		if _, ok := replacedBy[name]; !ok {
+			active[name] = h
+			edges[name] = map[string]bool{}
+			inDegree[name] = 0
+		}
+	}
+
+	addEdge := func(from, to string) {
+		var ok bool
+		if from, ok = resolve(from); !ok {
+			return
+		}
+		if to, ok = resolve(to); !ok || from == to {
+			return
+		}
+		if !edges[from][to] {
+			edges[from][to] = true
+			inDegree[to]++
+		}
+	}
+
+	for name, h := range active {
+		for _, after := range h.After {
+			addEdge(after, name)
+		}
+		for _, before := range h.Before {
+			addEdge(name, before)
+		}
+	}
+
+	less := func(a, b *RegisteredHandler) bool {
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.Name < b.Name
+	}
+
+	var ready, sorted []*RegisteredHandler
+	for name, h := range active {
+		if inDegree[name] == 0 {
+			ready = append(ready, h)
+		}
+	}
+
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return less(ready[i], ready[j]) })
+		h := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, h)
+		for to := range edges[h.Name] {
+			if inDegree[to]--; inDegree[to] == 0 {
+				ready = append(ready, active[to])
+			}
+		}
+	}
+
+	if len(sorted) != len(active) {
+		var cycle []string
+		for name, degree := range inDegree {
+			if degree > 0 {
+				cycle = append(cycle, name)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("media handlers dependency cycle between %s", strings.Join(cycle, ", "))
+	}
+	return sorted, nil
+}
+
+// Handle calls cb for each handler that could handle media, in execution order.
+// Stops on first error or when ctx is done.
+func (r *HandlerRegistry) Handle(ctx context.Context, media Media, cb func(name string, handler MediaHandler) error) (report HandleReport, err error) {
+	var handlers []*RegisteredHandler
+	if handlers, err = r.Sorted(); err != nil {
+		return
+	}
+	for _, h := range handlers {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		result := &HandlerResult{Name: h.Name}
+		report = append(report, result)
+		if !h.Handler.CouldHandle(media) {
+			result.Skipped = true
+			continue
+		}
+		start := time.Now()
+		result.Err = cb(h.Name, h.Handler)
+		result.Duration = time.Since(start)
+		if result.Err != nil {
+			return report, errwrap.Wrap(result.Err, "Media Handler %q", h.Name)
 		}
 	}
 	return
 }
+
+// RegisterMediaHandler register Media library handler. Panics if name already registered.
+func RegisterMediaHandler(name string, handler MediaHandler, option ...HandlerOption) {
+	if err := MediaHandlerRegistry.Register(name, handler, option...); err != nil {
+		panic(err)
+	}
+}
+
+func MediaHandlers() map[string]MediaHandler {
+	return MediaHandlerRegistry.Handlers()
+}
+
+func Handle(media Media, cb func(name string, handle MediaHandler) error) (err error) {
+	return HandleContext(context.Background(), media, cb)
+}
+
+// HandleContext is like `Handle`, but stops when ctx is done
+func HandleContext(ctx context.Context, media Media, cb func(name string, handle MediaHandler) error) (err error) {
+	_, err = MediaHandlerRegistry.Handle(ctx, media, cb)
+	return
+}
+
+// HandleWithReport is like `HandleContext`, but returns the per handler result
+func HandleWithReport(ctx context.Context, media Media, cb func(name string, handle MediaHandler) error) (report HandleReport, err error) {
+	return MediaHandlerRegistry.Handle(ctx, media, cb)
+}
@@ -90,5 +90,7 @@ func (bimgImageHandler) Handle(media media.Media, file multipart.File, option *m
 }
 
 func init() {
-	media.RegisterMediaHandler("image_handler", bimgImageHandler{})
+	media.RegisterMediaHandler("vips_image_handler", bimgImageHandler{}, media.HandlerOption{
+		Replaces: []string{"image_handler"},
+	})
 }
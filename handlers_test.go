@@ -0,0 +1,135 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"mime/multipart"
+	"strings"
+	"testing"
+)
+
+type testHandler struct{}
+
+func (testHandler) CouldHandle(media Media) bool {
+	return true
+}
+
+func (testHandler) Handle(media Media, file multipart.File, option *Option) error {
+	return nil
+}
+
+type skipHandler struct{}
+
+func (skipHandler) CouldHandle(media Media) bool {
+	return false
+}
+
+func (skipHandler) Handle(media Media, file multipart.File, option *Option) error {
+	return nil
+}
+
+func sortedNames(t *testing.T, r *HandlerRegistry) string {
+	handlers, err := r.Sorted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, h := range handlers {
+		names = append(names, h.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestHandlerRegistryOrder(t *testing.T) {
+	r := NewHandlerRegistry()
+	r.Register("resize", testHandler{})
+	r.Register("exif", testHandler{}, HandlerOption{Before: []string{"resize"}})
+	r.Register("virus_scan", testHandler{}, HandlerOption{Priority: -10})
+	r.Register("audit", testHandler{}, HandlerOption{Priority: 10, After: []string{"missing"}})
+	r.Register("notify", testHandler{}, HandlerOption{Priority: -20, After: []string{"resize"}})
+
+	if got, want := sortedNames(t, r), "virus_scan,exif,resize,notify,audit"; got != want {
+		t.Errorf("Sorted() == %q, want %q", got, want)
+	}
+}
+
+func TestHandlerRegistryConflicts(t *testing.T) {
+	r := NewHandlerRegistry()
+	if err := r.Register("image_handler", testHandler{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("image_handler", testHandler{}); err == nil {
+		t.Errorf("duplicate name should fail")
+	}
+
+	r.Register("exif", testHandler{}, HandlerOption{Before: []string{"image_handler"}})
+	r.Register("vips", testHandler{}, HandlerOption{Replaces: []string{"image_handler"}})
+	if got, want := sortedNames(t, r), "exif,vips"; got != want {
+		t.Errorf("Sorted() == %q, want %q", got, want)
+	}
+
+	r.Register("other", testHandler{}, HandlerOption{Replaces: []string{"image_handler"}})
+	if _, err := r.Sorted(); err == nil {
+		t.Errorf("two replacements of same handler should fail")
+	}
+	r.Unregister("other")
+
+	r.Register("a", testHandler{}, HandlerOption{After: []string{"b"}})
+	r.Register("b", testHandler{}, HandlerOption{After: []string{"a"}})
+	if _, err := r.Sorted(); err == nil {
+		t.Errorf("cycle should fail")
+	}
+}
+
+func TestHandlerRegistryHandle(t *testing.T) {
+	r := NewHandlerRegistry()
+	r.Register("resize", testHandler{})
+	r.Register("exif", testHandler{}, HandlerOption{Before: []string{"resize"}})
+	r.Register("skipped", skipHandler{}, HandlerOption{Priority: -10})
+	r.Register("notify", testHandler{}, HandlerOption{After: []string{"resize"}})
+
+	var called []string
+	report, err := r.Handle(context.Background(), nil, func(name string, handler MediaHandler) error {
+		called = append(called, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(called, ","), "exif,resize,notify"; got != want {
+		t.Errorf("called %q, want %q", got, want)
+	}
+	if got, want := strings.Join(report.Handled(), ","), "exif,resize,notify"; got != want {
+		t.Errorf("Handled() == %q, want %q", got, want)
+	}
+	if result := report.Get("skipped"); result == nil || !result.Skipped {
+		t.Errorf("Get(skipped) == %+v", result)
+	}
+
+	// stops on first error
+	failure := errors.New("failure")
+	called = nil
+	report, err = r.Handle(context.Background(), nil, func(name string, handler MediaHandler) error {
+		called = append(called, name)
+		if name == "resize" {
+			return failure
+		}
+		return nil
+	})
+	if err == nil || report.Get("resize").Err != failure || report.Get("notify") != nil {
+		t.Errorf("Handle() == %v, %v", report, err)
+	}
+	if got, want := strings.Join(called, ","), "exif,resize"; got != want {
+		t.Errorf("called %q, want %q", got, want)
+	}
+
+	// stops when context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = r.Handle(ctx, nil, func(name string, handler MediaHandler) error {
+		t.Errorf("%s called with context done", name)
+		return nil
+	}); err != context.Canceled {
+		t.Errorf("Handle() with context done == %v", err)
+	}
+}
@@ -18,6 +18,8 @@ import (
 const (
 	FIELD_TAG_NAME = "media"
 	OPT_STORAGE    = FIELD_TAG_NAME + ".storage"
+	// OPT_CONTENT_HASH enables the content addressed storage: `media:"content_hash"`
+	OPT_CONTENT_HASH = FIELD_TAG_NAME + ".content_hash"
 )
 
 // Media is an interface including methods that needs for a media library storage
@@ -38,7 +40,7 @@ type Media interface {
 	Set(ctx *Context, data interface{}) (err error)
 
 	Value() (driver.Value, error)
-	GetURL(scope *aorm.Scope, field *aorm.Field, templater URLTemplater) string
+	GetURL(scope *aorm.Scope, field *aorm.Field, templater URLTemplater) (string, error)
 
 	GetFileHeader() FileHeader
 	GetFileName() string
@@ -51,6 +53,7 @@ type Media interface {
 	ScanBytes(ctx *Context, data []byte) error
 
 	IsImage() bool
+	GetFileType() FileType
 
 	GetURLTemplate(option *Option) string
 	URL(style ...string) string
@@ -74,6 +77,26 @@ type URLTemplater interface {
 	GetURLTemplate(*Option) string
 }
 
+// StorageURLer is implemented by medias which `URL` of style isn't always the url of stored style, like the
+// images which URL falls back to original while the styles are pending
+type StorageURLer interface {
+	StorageURL(style string) string
+}
+
+// FileValidator is implemented by medias which file could be validated again after Init, when the field option
+// is known
+type FileValidator interface {
+	ValidateFile(m Media) error
+}
+
+// StorageURL return the url of stored style of media
+func StorageURL(media Media, style string) string {
+	if s, ok := media.(StorageURLer); ok {
+		return s.StorageURL(style)
+	}
+	return media.URL(style)
+}
+
 // Option media library option
 type Option map[string]string
 
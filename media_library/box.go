@@ -127,13 +127,13 @@ func (mediaBox MediaBox) ConfigureQorMeta(metaor resource.Metaor) {
 			config.RemoteDataResource.Resource.AddProcessor(func(record interface{}, metaValues *resource.MetaValues, context *core.Context) error {
 				if mediaLibrary, ok := record.(MediaLibraryInterface); ok {
 					mediaLibrary.Init(context.Site)
-					var filename string
+					var file *multipart.FileHeader
 					var mediaOption MediaOption
 
 					for _, metaValue := range metaValues.Values {
 						if fileHeaders, ok := metaValue.Value.([]*multipart.FileHeader); ok {
 							for _, fileHeader := range fileHeaders {
-								filename = fileHeader.Filename
+								file = fileHeader
 							}
 						}
 					}
@@ -145,10 +145,14 @@ func (mediaBox MediaBox) ConfigureQorMeta(metaor resource.Metaor) {
 
 					if mediaOption.SelectedType == "video_link" {
 						mediaLibrary.SetSelectedType("video_link")
-					} else if filename != "" {
-						if media.IsImageFormat(filename) {
+					} else if file != nil {
+						fileType, err := media.DetectFileHeaderType(file)
+						if err != nil {
+							return err
+						}
+						if fileType = fileType.WithName(file.Filename); fileType.IsImage() {
 							mediaLibrary.SetSelectedType("image")
-						} else if media.IsVideoFormat(filename) {
+						} else if fileType.IsVideo() {
 							mediaLibrary.SetSelectedType("video")
 						} else {
 							mediaLibrary.SetSelectedType("file")
@@ -176,6 +180,9 @@ func (mediaBox MediaBox) ConfigureQorMeta(metaor resource.Metaor) {
 }
 
 func (mediaBox MediaBox) Crop(context *core.Context, res *admin.Resource, db *aorm.DB, mediaOption MediaOption) (err error) {
+	if context != nil && context.Request != nil {
+		db = media.WithContext(db, context.Request.Context())
+	}
 	for _, file := range mediaBox.Files {
 		var ID aorm.ID
 		if ID, err = res.ModelStruct.DefaultID().SetValue(file.ID); err != nil {
@@ -0,0 +1,74 @@
+package media_library
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/ecletus/admin"
+	"github.com/ecletus/core/utils"
+	"github.com/ecletus/media/oss"
+	"github.com/moisespsena-go/aorm"
+)
+
+// colorColumns updates the dominant color columns of processed File
+func (mediaLibrary *QorMediaLibrary) colorColumns(img oss.ImageInterface) map[string]interface{} {
+	mediaLibrary.DominantColor, mediaLibrary.ColorR, mediaLibrary.ColorG, mediaLibrary.ColorB = "", 0, 0, 0
+	var hex string
+	if p, ok := img.(interface{ GetDominantColor() string }); ok {
+		hex = p.GetDominantColor()
+	}
+	if hex != "" {
+		if c, err := oss.ParseColor(hex); err == nil {
+			n := color.NRGBAModel.Convert(c).(color.NRGBA)
+			mediaLibrary.DominantColor = hex
+			mediaLibrary.ColorR, mediaLibrary.ColorG, mediaLibrary.ColorB = int(n.R), int(n.G), int(n.B)
+		}
+	}
+	return map[string]interface{}{
+		"dominant_color": mediaLibrary.DominantColor,
+		"color_r":        mediaLibrary.ColorR,
+		"color_g":        mediaLibrary.ColorG,
+		"color_b":        mediaLibrary.ColorB,
+	}
+}
+
+// NearestColorDistance is the max distance of dominant color of the `DominantColor` filter of media library
+var NearestColorDistance = 80.0
+
+// NearestColor return the scope of media library items with dominant color up to maxDistance of value
+// (euclidean distance of RGB channels, from 0 to 441), the nearest first. The value is a color accepted
+// by `oss.ParseColor`, like "#1e40af" or "blue":
+//
+//	db.Scopes(media_library.NearestColor("blue", 80)).Find(&items)
+func NearestColor(value string, maxDistance float64) func(db *aorm.DB) *aorm.DB {
+	return func(db *aorm.DB) *aorm.DB {
+		c, err := oss.ParseColor(value)
+		if err != nil {
+			db.AddError(err)
+			return db
+		}
+		var (
+			n        = color.NRGBAModel.Convert(c).(color.NRGBA)
+			r, g, b  = int(n.R), int(n.G), int(n.B)
+			d        = int(math.Ceil(maxDistance))
+			distance = fmt.Sprintf("(color_r - %d) * (color_r - %d) + (color_g - %d) * (color_g - %d) + (color_b - %d) * (color_b - %d)", r, r, g, g, b, b)
+		)
+		// the box around the color uses the index, the distance is checked after
+		return db.
+			Where("dominant_color <> ''").
+			Where("color_r BETWEEN ? AND ? AND color_g BETWEEN ? AND ? AND color_b BETWEEN ? AND ?", r-d, r+d, g-d, g+d, b-d, b+d).
+			Where(distance+" <= ?", int(maxDistance*maxDistance)).
+			Order(distance)
+	}
+}
+
+// nearestColorFilter is the `DominantColor` filter of media library, with the items of nearest dominant color
+func nearestColorFilter(db *aorm.DB, arg *admin.FilterArgument) *aorm.DB {
+	if metaValue := arg.Value.Get("Value"); metaValue != nil {
+		if value := utils.ToString(metaValue.Value); value != "" {
+			return NearestColor(value, NearestColorDistance)(db)
+		}
+	}
+	return db
+}
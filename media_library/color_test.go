@@ -0,0 +1,46 @@
+package media_library
+
+import (
+	"testing"
+
+	"github.com/ecletus/core/test/utils"
+)
+
+func TestNearestColor(t *testing.T) {
+	db := utils.TestDB()
+	if err := db.DropTableIfExists(&QorMediaLibrary{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&QorMediaLibrary{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range []*QorMediaLibrary{
+		{DominantColor: "#ff0000", ColorR: 255},
+		{DominantColor: "#0000ff", ColorB: 255},
+		// distance 50 of blue
+		{DominantColor: "#1e28ff", ColorR: 30, ColorG: 40, ColorB: 255},
+		// in the box of distance 80, but distance 101 of blue
+		{DominantColor: "#3c3cc8", ColorR: 60, ColorG: 60, ColorB: 200},
+		{},
+	} {
+		if err := db.Create(item).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var items []*QorMediaLibrary
+	if err := db.Scopes(NearestColor("#0000ff", 80)).Find(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].DominantColor != "#0000ff" || items[1].DominantColor != "#1e28ff" {
+		var colors []string
+		for _, item := range items {
+			colors = append(colors, item.DominantColor)
+		}
+		t.Errorf("NearestColor(#0000ff, 80) == %v, want [#0000ff #1e28ff]", colors)
+	}
+
+	if err := db.Scopes(NearestColor("not a color", 80)).Find(&items).Error; err == nil {
+		t.Errorf("NearestColor() of invalid color should fail")
+	}
+}
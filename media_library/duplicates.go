@@ -0,0 +1,221 @@
+package media_library
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ecletus/media"
+	"github.com/ecletus/media/oss"
+	"github.com/moisespsena-go/aorm"
+	errwrap "github.com/moisespsena-go/error-wrap"
+)
+
+// NearDuplicateDistance is the max Hamming distance of perceptual hashes of near-duplicates checked on upload.
+// If negative, the uploads aren't checked. Up to 3, only the items with an equal hash band are loaded.
+var NearDuplicateDistance = -1
+
+// NearDuplicatePageSize is the count of perceptual hashes loaded by page to find the near-duplicates of distance
+// greater than 3, when all hashes are compared
+var NearDuplicatePageSize = 1000
+
+// OnNearDuplicate is called when the upload of item looks like existing items
+var OnNearDuplicate func(ctx context.Context, item *QorMediaLibrary, duplicates []*NearDuplicate)
+
+// NearDuplicate is a media library item near of a perceptual hash
+type NearDuplicate struct {
+	*QorMediaLibrary
+	// Distance is the Hamming distance of perceptual hashes, from 0 (same) to 64
+	Distance int
+}
+
+// hashBands return the four 16 bits bands of hash in hex. Two hashes up to 3 of distance have at least an
+// equal band, the pigeonhole principle.
+func hashBands(hash string) (bands [4]string) {
+	if len(hash) == 16 {
+		for i := range bands {
+			bands[i] = hash[i*4 : i*4+4]
+		}
+	}
+	return
+}
+
+// nearHashes return the stored perceptual hashes up to maxDistance of hash, with its distances. Up to 3 of
+// distance, the hashes with an equal band, or without bands, are compared. Otherwise all hashes are compared,
+// loaded by page.
+func nearHashes(db *aorm.DB, hash string, maxDistance int) (near map[string]int, err error) {
+	near = map[string]int{}
+	add := func(hashes []string) {
+		for _, h := range hashes {
+			if d, err := oss.HammingDistance(hash, h); err == nil && d <= maxDistance {
+				near[h] = d
+			}
+		}
+	}
+	db = db.Model(&QorMediaLibrary{}).Where("perceptual_hash <> ''")
+
+	if bands := hashBands(hash); maxDistance < len(bands) && bands[0] != "" {
+		var hashes []string
+		if err = db.Where("perceptual_hash_band1 = ? OR perceptual_hash_band2 = ? OR perceptual_hash_band3 = ? "+
+			"OR perceptual_hash_band4 = ? OR COALESCE(perceptual_hash_band1, '') = ''", bands[0], bands[1], bands[2], bands[3]).
+			Pluck("DISTINCT perceptual_hash", &hashes).Error; err != nil {
+			return nil, errwrap.Wrap(err, "Load perceptual hashes")
+		}
+		add(hashes)
+		return
+	}
+
+	var last string
+	for {
+		var hashes []string
+		if err = db.Where("perceptual_hash > ?", last).Order("perceptual_hash").Limit(NearDuplicatePageSize).
+			Pluck("DISTINCT perceptual_hash", &hashes).Error; err != nil {
+			return nil, errwrap.Wrap(err, "Load perceptual hashes")
+		}
+		add(hashes)
+		if len(hashes) == 0 || len(hashes) < NearDuplicatePageSize {
+			return
+		}
+		last = hashes[len(hashes)-1]
+	}
+}
+
+// FindNearDuplicates return the media library items with perceptual hash up to maxDistance of hash,
+// the nearest first
+func FindNearDuplicates(db *aorm.DB, hash string, maxDistance int) (duplicates []*NearDuplicate, err error) {
+	if _, err = oss.HammingDistance(hash, hash); err != nil {
+		return
+	}
+	near, err := nearHashes(db, hash, maxDistance)
+	if err != nil || len(near) == 0 {
+		return
+	}
+	var hashes []string
+	for h := range near {
+		hashes = append(hashes, h)
+	}
+	var items []*QorMediaLibrary
+	if err = db.Where("perceptual_hash IN (?)", hashes).Find(&items).Error; err != nil {
+		return nil, errwrap.Wrap(err, "Load near duplicates")
+	}
+	for _, item := range items {
+		duplicates = append(duplicates, &NearDuplicate{item, near[item.PerceptualHash]})
+	}
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return duplicates[i].Distance < duplicates[j].Distance
+	})
+	return
+}
+
+// FindNearDuplicates return the other media library items up to maxDistance of this item
+func (mediaLibrary *QorMediaLibrary) FindNearDuplicates(db *aorm.DB, maxDistance int) (duplicates []*NearDuplicate, err error) {
+	if mediaLibrary.PerceptualHash == "" {
+		return
+	}
+	var (
+		scope = db.NewScope(mediaLibrary)
+		all   []*NearDuplicate
+	)
+	if all, err = FindNearDuplicates(db, mediaLibrary.PerceptualHash, maxDistance); err != nil {
+		return
+	}
+	id := scope.PrimaryKeyValue()
+	for _, d := range all {
+		if db.NewScope(d.QorMediaLibrary).PrimaryKeyValue() != id {
+			duplicates = append(duplicates, d)
+		}
+	}
+	return
+}
+
+// GroupNearDuplicates groups the perceptual hashes linked by distances up to maxDistance, in order of first hash
+func GroupNearDuplicates(hashes []string, maxDistance int) (groups [][]string) {
+	parent := make([]int, len(hashes))
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			if d, err := oss.HammingDistance(hashes[i], hashes[j]); err == nil && d <= maxDistance {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+	byRoot := map[int]int{}
+	for i, h := range hashes {
+		root := find(i)
+		index, ok := byRoot[root]
+		if !ok {
+			index = len(groups)
+			byRoot[root] = index
+			groups = append(groups, nil)
+		}
+		groups[index] = append(groups[index], h)
+	}
+	return
+}
+
+// NearDuplicateGroups return the groups of two or more media library items with perceptual hashes up to
+// maxDistance, like the re-encoded copies of the same photo
+func NearDuplicateGroups(db *aorm.DB, maxDistance int) (groups [][]*QorMediaLibrary, err error) {
+	var items []*QorMediaLibrary
+	if err = db.Where("perceptual_hash <> ''").Order("perceptual_hash").Find(&items).Error; err != nil {
+		return nil, errwrap.Wrap(err, "Load media library")
+	}
+	var (
+		byHash = map[string][]*QorMediaLibrary{}
+		hashes []string
+	)
+	for _, item := range items {
+		if _, ok := byHash[item.PerceptualHash]; !ok {
+			hashes = append(hashes, item.PerceptualHash)
+		}
+		byHash[item.PerceptualHash] = append(byHash[item.PerceptualHash], item)
+	}
+	for _, group := range GroupNearDuplicates(hashes, maxDistance) {
+		var groupItems []*QorMediaLibrary
+		for _, h := range group {
+			groupItems = append(groupItems, byHash[h]...)
+		}
+		if len(groupItems) > 1 {
+			groups = append(groups, groupItems)
+		}
+	}
+	return
+}
+
+// perceptualHashColumns updates the perceptual hash column of processed File, checking the near-duplicates
+// of new hash if `NearDuplicateDistance` is not negative
+func (mediaLibrary *QorMediaLibrary) perceptualHashColumns(db *aorm.DB, img oss.ImageInterface) map[string]interface{} {
+	var hash string
+	if p, ok := img.(interface{ GetPerceptualHash() string }); ok {
+		hash = p.GetPerceptualHash()
+	}
+	changed := hash != mediaLibrary.PerceptualHash
+	bands := hashBands(hash)
+	mediaLibrary.PerceptualHash = hash
+	mediaLibrary.PerceptualHashBand1, mediaLibrary.PerceptualHashBand2 = bands[0], bands[1]
+	mediaLibrary.PerceptualHashBand3, mediaLibrary.PerceptualHashBand4 = bands[2], bands[3]
+	mediaLibrary.NearDuplicates = nil
+	if changed && hash != "" && NearDuplicateDistance >= 0 {
+		if duplicates, err := mediaLibrary.FindNearDuplicates(db, NearDuplicateDistance); err == nil && len(duplicates) > 0 {
+			mediaLibrary.NearDuplicates = duplicates
+			if OnNearDuplicate != nil {
+				OnNearDuplicate(media.ContextOf(db), mediaLibrary, duplicates)
+			}
+		}
+	}
+	return map[string]interface{}{
+		"perceptual_hash":       hash,
+		"perceptual_hash_band1": bands[0],
+		"perceptual_hash_band2": bands[1],
+		"perceptual_hash_band3": bands[2],
+		"perceptual_hash_band4": bands[3],
+	}
+}
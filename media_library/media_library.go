@@ -7,6 +7,7 @@ import (
 	"github.com/ecletus/core"
 	"github.com/ecletus/core/resource"
 	"github.com/ecletus/media/oss"
+	"github.com/ecletus/media/video_link"
 	"github.com/moisespsena-go/aorm"
 )
 
@@ -16,15 +17,20 @@ func init() {
 }
 
 type MediaOption struct {
-	Video        string                     `json:",omitempty"`
-	FileName     string                     `json:",omitempty"`
-	URL          string                     `json:",omitempty"`
-	OriginalURL  string                     `json:",omitempty"`
-	CropOptions  map[string]*oss.CropOption `json:",omitempty"`
-	Sizes        map[string]*oss.Size       `json:",omitempty"`
-	SelectedType string                     `json:",omitempty"`
-	Description  string                     `json:",omitempty"`
-	Crop         bool
+	Video string `json:",omitempty"`
+	// VideoLinkInfo is the video of Video link, with its embed URL, title and thumbnail. Ignored by
+	// `ScanMediaOptions`.
+	VideoLinkInfo *video_link.Video          `json:",omitempty"`
+	FileName      string                     `json:",omitempty"`
+	URL           string                     `json:",omitempty"`
+	OriginalURL   string                     `json:",omitempty"`
+	CropOptions   map[string]*oss.CropOption `json:",omitempty"`
+	Sizes         map[string]*oss.Size       `json:",omitempty"`
+	SelectedType  string                     `json:",omitempty"`
+	Description   string                     `json:",omitempty"`
+	// NearDuplicates are the urls of existing items like the uploaded file
+	NearDuplicates []string `json:",omitempty"`
+	Crop           bool
 }
 
 type MediaLibraryInterface interface {
@@ -39,6 +45,21 @@ type QorMediaLibrary struct {
 	aorm.Model
 	SelectedType string
 	File         MediaLibraryStorage `sql:"type:text;" media_library:"url:/system/{{class}}/{{primary_key}}/{{column}}.{{extension}}"`
+	// DominantColor is the dominant color of File, with its RGB channels indexed for the `NearestColor` filter
+	DominantColor string `sql:"size:7"`
+	ColorR        int    `sql:"index:media_library_color"`
+	ColorG        int    `sql:"index:media_library_color"`
+	ColorB        int    `sql:"index:media_library_color"`
+	// PerceptualHash is the dHash of File, see `FindNearDuplicates`
+	PerceptualHash string `sql:"size:16;index"`
+	// PerceptualHashBand1 to PerceptualHashBand4 are the 16 bits bands of PerceptualHash, indexed to find the
+	// near-duplicates without loading all hashes
+	PerceptualHashBand1 string `sql:"size:4;index"`
+	PerceptualHashBand2 string `sql:"size:4;index"`
+	PerceptualHashBand3 string `sql:"size:4;index"`
+	PerceptualHashBand4 string `sql:"size:4;index"`
+	// NearDuplicates are the existing items like the File uploaded, set if `NearDuplicateDistance` is not negative
+	NearDuplicates []*NearDuplicate `sql:"-" json:"-"`
 }
 
 func (mediaLibrary *QorMediaLibrary) Init(site *core.Site) {
@@ -46,24 +67,47 @@ func (mediaLibrary *QorMediaLibrary) Init(site *core.Site) {
 }
 
 func (mediaLibrary *QorMediaLibrary) ScanMediaOptions(mediaOption MediaOption) error {
+	// the video metadata is never accepted from client
+	mediaOption.VideoLinkInfo = mediaLibrary.File.VideoLinkInfo
 	if bytes, err := json.Marshal(mediaOption); err == nil {
-		return mediaLibrary.File.Scan(bytes)
+		if err = mediaLibrary.File.Scan(bytes); err == nil && mediaLibrary.File.Video != "" {
+			// the video link is kept without metadata if the provider is unreachable
+			mediaLibrary.File.ResolveVideoLink()
+		}
+		return err
 	} else {
 		return err
 	}
 }
 
 func (mediaLibrary *QorMediaLibrary) GetMediaOption(ctx *core.Context) MediaOption {
-	return MediaOption{
-		Video:        mediaLibrary.File.Video,
-		FileName:     mediaLibrary.File.FileName,
-		URL:          mediaLibrary.File.URL(),
-		OriginalURL:  mediaLibrary.File.URL(oss.IMAGE_STYLE_ORIGNAL),
-		CropOptions:  mediaLibrary.File.CropOptions,
-		Sizes:        mediaLibrary.File.GetSizes(),
-		SelectedType: mediaLibrary.File.SelectedType,
-		Description:  mediaLibrary.File.Description,
+	option := MediaOption{
+		Video:         mediaLibrary.File.Video,
+		VideoLinkInfo: mediaLibrary.File.VideoLinkInfo,
+		FileName:      mediaLibrary.File.FileName,
+		URL:           mediaLibrary.File.URL(),
+		OriginalURL:   mediaLibrary.File.URL(oss.IMAGE_STYLE_ORIGNAL),
+		CropOptions:   mediaLibrary.File.CropOptions,
+		Sizes:         mediaLibrary.File.GetSizes(),
+		SelectedType:  mediaLibrary.File.SelectedType,
+		Description:   mediaLibrary.File.Description,
+	}
+	for _, duplicate := range mediaLibrary.NearDuplicates {
+		option.NearDuplicates = append(option.NearDuplicates, duplicate.File.URL())
+	}
+	return option
+}
+
+// ImageProcessed updates the columns derived from File after its processing
+func (mediaLibrary *QorMediaLibrary) ImageProcessed(db *aorm.DB, field string, img oss.ImageInterface) map[string]interface{} {
+	if field != "File" {
+		return nil
+	}
+	columns := mediaLibrary.colorColumns(img)
+	for column, value := range mediaLibrary.perceptualHashColumns(db, img) {
+		columns[column] = value
 	}
+	return columns
 }
 
 func (mediaLibrary *QorMediaLibrary) SetSelectedType(typ string) {
@@ -79,5 +123,9 @@ func (QorMediaLibrary) ConfigureResource(res resource.Resourcer) {
 		res.UseTheme("grid")
 		res.UseTheme("media_library")
 		res.IndexAttrs("File")
+		res.Filter(&admin.Filter{
+			Name:    "DominantColor",
+			Handler: nearestColorFilter,
+		})
 	}
 }
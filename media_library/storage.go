@@ -10,6 +10,7 @@ import (
 	"github.com/ecletus/core/resource"
 	"github.com/ecletus/media"
 	"github.com/ecletus/media/oss"
+	"github.com/ecletus/media/video_link"
 	"github.com/moisespsena-go/aorm"
 )
 
@@ -17,6 +18,10 @@ type MediaLibraryStorageAttributes struct {
 	Video        string
 	SelectedType string
 	Description  string
+	// PerceptualHash is the dHash of image, in hex, set by `SetPerceptualHash` and ignored on form scans
+	PerceptualHash string `json:",omitempty"`
+	// VideoLinkInfo is the video of Video link with its oEmbed metadata, cached by `ResolveVideoLink`
+	VideoLinkInfo *video_link.Video `json:",omitempty"`
 }
 
 type MediaLibraryStorage struct {
@@ -37,6 +42,33 @@ func (b *MediaLibraryStorage) Init(site *core.Site, field *aorm.Field) {
 	b.GetOrSetFieldOption().ParseFieldTag("media_library", &field.Tag)
 }
 
+// SetPerceptualHash sets the perceptual hash computed on processing
+func (b *MediaLibraryStorage) SetPerceptualHash(hash string) {
+	b.PerceptualHash = hash
+}
+
+// GetPerceptualHash return the perceptual hash of image
+func (b MediaLibraryStorage) GetPerceptualHash() string {
+	return b.PerceptualHash
+}
+
+// ResolveVideoLink return the video of Video link with its oEmbed metadata. The metadata is fetched only if the
+// link changed. The cached VideoLinkInfo is untrusted, see `video_link.Refresh`. If fetch fails, the video of
+// known providers is kept without metadata.
+func (mls *MediaLibraryStorage) ResolveVideoLink() (*video_link.Video, error) {
+	if mls.Video == "" {
+		mls.VideoLinkInfo = nil
+		return nil, nil
+	}
+	video, err := video_link.Refresh(mls.VideoLinkInfo, mls.Video)
+	if err != nil {
+		mls.VideoLinkInfo, _ = video_link.Parse(mls.Video)
+		return mls.VideoLinkInfo, err
+	}
+	mls.VideoLinkInfo = video
+	return video, nil
+}
+
 func (mls MediaLibraryStorage) Value() (driver.Value, error) {
 	return mls.DBValue(&mls)
 }
@@ -64,10 +96,15 @@ func (mls MediaLibraryStorage) ConfigureQorMetaBeforeInitialize(metaor resource.
 }
 
 func (mls *MediaLibraryStorage) ScanBytes(ctx *media.Context, data []byte) (err error) {
+	hash := mls.PerceptualHash
 	mls.MediaLibraryStorageAttributes = MediaLibraryStorageAttributes{}
 	if err = mls.Image.ScanBytes(ctx, data); err == nil {
 		err = json.Unmarshal(data, &mls.MediaLibraryStorageAttributes)
 	}
+	// the perceptual hash is set by the processing, never accepted from forms
+	if mls.IsFormScan() {
+		mls.PerceptualHash = hash
+	}
 	return
 }
 
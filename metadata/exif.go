@@ -0,0 +1,237 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+	"time"
+)
+
+// EXIF tags
+const (
+	tagImageDescription   = 0x010E
+	tagMake               = 0x010F
+	tagModel              = 0x0110
+	tagOrientation        = 0x0112
+	tagDateTime           = 0x0132
+	tagArtist             = 0x013B
+	tagCopyright          = 0x8298
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagLensMake           = 0xA433
+	tagLensModel          = 0xA434
+
+	tagGPSLatitudeRef  = 0x01
+	tagGPSLatitude     = 0x02
+	tagGPSLongitudeRef = 0x03
+	tagGPSLongitude    = 0x04
+	tagGPSAltitudeRef  = 0x05
+	tagGPSAltitude     = 0x06
+)
+
+// EXIF value types
+const (
+	typeByte      = 1
+	typeASCII     = 2
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeUndefined = 7
+	typeSLong     = 9
+	typeSRational = 10
+)
+
+var typeSizes = map[uint16]int{
+	typeByte: 1, typeASCII: 1, typeShort: 2, typeLong: 4, typeRational: 8,
+	typeUndefined: 1, typeSLong: 4, typeSRational: 8,
+}
+
+var ErrInvalidEXIF = errors.New("invalid EXIF")
+
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+type exifEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+func (t *tiff) ifd(offset uint32) (entries map[uint16]*exifEntry, next uint32, err error) {
+	if int64(offset)+2 > int64(len(t.data)) {
+		return nil, 0, ErrInvalidEXIF
+	}
+	var (
+		count = int(t.order.Uint16(t.data[offset:]))
+		pos   = int(offset) + 2
+	)
+	if pos+count*12+4 > len(t.data) {
+		return nil, 0, ErrInvalidEXIF
+	}
+	entries = make(map[uint16]*exifEntry, count)
+	for i := 0; i < count; i, pos = i+1, pos+12 {
+		var (
+			e    = &exifEntry{typ: t.order.Uint16(t.data[pos+2:]), count: t.order.Uint32(t.data[pos+4:])}
+			size = typeSizes[e.typ]
+		)
+		if size == 0 || e.count > uint32(len(t.data)) {
+			continue
+		}
+		total := size * int(e.count)
+		if total <= 4 {
+			e.value = t.data[pos+8 : pos+8+total]
+		} else {
+			off := int64(t.order.Uint32(t.data[pos+8:]))
+			if off+int64(total) > int64(len(t.data)) {
+				continue
+			}
+			e.value = t.data[off : off+int64(total)]
+		}
+		entries[t.order.Uint16(t.data[pos:])] = e
+	}
+	return entries, t.order.Uint32(t.data[pos:]), nil
+}
+
+func (t *tiff) string(e *exifEntry) string {
+	if e == nil || (e.typ != typeASCII && e.typ != typeUndefined && e.typ != typeByte) {
+		return ""
+	}
+	return strings.TrimSpace(string(bytes.TrimRight(e.value, "\x00")))
+}
+
+func (t *tiff) uint(e *exifEntry) (uint32, bool) {
+	if e == nil || e.count == 0 {
+		return 0, false
+	}
+	switch e.typ {
+	case typeByte:
+		return uint32(e.value[0]), true
+	case typeShort:
+		return uint32(t.order.Uint16(e.value)), true
+	case typeLong:
+		return t.order.Uint32(e.value), true
+	}
+	return 0, false
+}
+
+func (t *tiff) rationals(e *exifEntry) (values []float64) {
+	if e == nil || (e.typ != typeRational && e.typ != typeSRational) {
+		return
+	}
+	for i := 0; i < int(e.count); i++ {
+		var num, den float64
+		if e.typ == typeRational {
+			num, den = float64(t.order.Uint32(e.value[i*8:])), float64(t.order.Uint32(e.value[i*8+4:]))
+		} else {
+			num, den = float64(int32(t.order.Uint32(e.value[i*8:]))), float64(int32(t.order.Uint32(e.value[i*8+4:])))
+		}
+		if den == 0 {
+			return nil
+		}
+		values = append(values, num/den)
+	}
+	return
+}
+
+func (t *tiff) degrees(value, ref *exifEntry, negative string) (float64, bool) {
+	v := t.rationals(value)
+	if len(v) != 3 {
+		return 0, false
+	}
+	deg := v[0] + v[1]/60 + v[2]/3600
+	if strings.EqualFold(t.string(ref), negative) {
+		deg = -deg
+	}
+	return deg, !math.IsNaN(deg)
+}
+
+// ParseEXIFTime parses the EXIF date time "2006:01:02 15:04:05", with the optional offset "-07:00"
+func ParseEXIFTime(value, offset string) (*time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.HasPrefix(value, "0000") {
+		return nil, false
+	}
+	var (
+		t   time.Time
+		err error
+	)
+	if offset = strings.TrimSpace(offset); offset != "" {
+		t, err = time.Parse("2006:01:02 15:04:05-07:00", value+offset)
+	} else {
+		t, err = time.ParseInLocation("2006:01:02 15:04:05", value, time.UTC)
+	}
+	if err != nil {
+		return nil, false
+	}
+	return &t, true
+}
+
+// ParseEXIF parses the TIFF structure of EXIF block
+func ParseEXIF(data []byte) (md *Metadata, err error) {
+	if len(data) < 8 {
+		return nil, ErrInvalidEXIF
+	}
+	t := &tiff{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, ErrInvalidEXIF
+	}
+	if t.order.Uint16(data[2:]) != 42 {
+		return nil, ErrInvalidEXIF
+	}
+
+	ifd0, _, err := t.ifd(t.order.Uint32(data[4:]))
+	if err != nil {
+		return
+	}
+	md = &Metadata{
+		Make:      t.string(ifd0[tagMake]),
+		Model:     t.string(ifd0[tagModel]),
+		Artist:    t.string(ifd0[tagArtist]),
+		Copyright: t.string(ifd0[tagCopyright]),
+		Caption:   t.string(ifd0[tagImageDescription]),
+	}
+	if o, ok := t.uint(ifd0[tagOrientation]); ok && o >= 1 && o <= 8 {
+		md.Orientation = int(o)
+	}
+
+	if off, ok := t.uint(ifd0[tagExifIFD]); ok {
+		if exif, _, err := t.ifd(off); err == nil {
+			md.DateTaken, _ = ParseEXIFTime(t.string(exif[tagDateTimeOriginal]), t.string(exif[tagOffsetTimeOriginal]))
+			md.Lens = t.string(exif[tagLensModel])
+			if lensMake := t.string(exif[tagLensMake]); lensMake != "" && md.Lens != "" && !strings.HasPrefix(md.Lens, lensMake) {
+				md.Lens = lensMake + " " + md.Lens
+			}
+		}
+	}
+	if md.DateTaken == nil {
+		md.DateTaken, _ = ParseEXIFTime(t.string(ifd0[tagDateTime]), "")
+	}
+
+	if off, ok := t.uint(ifd0[tagGPSIFD]); ok {
+		if gps, _, err := t.ifd(off); err == nil {
+			lat, okLat := t.degrees(gps[tagGPSLatitude], gps[tagGPSLatitudeRef], "S")
+			lon, okLon := t.degrees(gps[tagGPSLongitude], gps[tagGPSLongitudeRef], "W")
+			if okLat && okLon {
+				md.GPS = &GPS{Latitude: lat, Longitude: lon}
+				if alt := t.rationals(gps[tagGPSAltitude]); len(alt) == 1 {
+					if ref, _ := t.uint(gps[tagGPSAltitudeRef]); ref == 1 {
+						alt[0] = -alt[0]
+					}
+					md.GPS.Altitude = &alt[0]
+				}
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,127 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// IPTC application record datasets
+const (
+	iptcRecordApplication = 2
+
+	iptcByline       = 80
+	iptcDateCreated  = 55
+	iptcTimeCreated  = 60
+	iptcKeywords     = 25
+	iptcCopyright    = 116
+	iptcCaption      = 120
+	iptcEnvelope     = 1
+	iptcCodedCharset = 90
+)
+
+var ErrInvalidIPTC = errors.New("invalid IPTC")
+
+// ParseIPTC parses the IPTC-NAA records
+func ParseIPTC(data []byte) (md *Metadata, err error) {
+	var (
+		utf8Set bool
+		values  = map[int][]string{}
+	)
+	for len(data) > 0 {
+		if data[0] != 0x1C {
+			// padding
+			if data[0] == 0 {
+				break
+			}
+			return nil, ErrInvalidIPTC
+		}
+		if len(data) < 5 {
+			return nil, ErrInvalidIPTC
+		}
+		var (
+			record, dataset = data[1], data[2]
+			size            = int(binary.BigEndian.Uint16(data[3:5]))
+			pos             = 5
+		)
+		if size&0x8000 != 0 {
+			// extended dataset: the size is in the next n bytes
+			n := size & 0x7FFF
+			if n > 4 || len(data) < pos+n {
+				return nil, ErrInvalidIPTC
+			}
+			size = 0
+			for _, b := range data[pos : pos+n] {
+				size = size<<8 | int(b)
+			}
+			pos += n
+		}
+		if size < 0 || len(data) < pos+size {
+			return nil, ErrInvalidIPTC
+		}
+		value := data[pos : pos+size]
+		data = data[pos+size:]
+
+		switch {
+		case record == iptcEnvelope && dataset == iptcCodedCharset:
+			// ESC % G is UTF-8
+			utf8Set = string(value) == "\x1b%G"
+		case record == iptcRecordApplication:
+			values[int(dataset)] = append(values[int(dataset)], string(value))
+		}
+	}
+
+	text := func(s string) string {
+		if !utf8Set && !utf8.ValidString(s) {
+			// ISO-8859-1
+			runes := make([]rune, len(s))
+			for i := 0; i < len(s); i++ {
+				runes[i] = rune(s[i])
+			}
+			s = string(runes)
+		}
+		return strings.TrimSpace(strings.TrimRight(s, "\x00"))
+	}
+	first := func(dataset int) string {
+		if v := values[dataset]; len(v) > 0 {
+			return text(v[0])
+		}
+		return ""
+	}
+
+	md = &Metadata{
+		Artist:    first(iptcByline),
+		Copyright: first(iptcCopyright),
+		Caption:   first(iptcCaption),
+	}
+	for _, k := range values[iptcKeywords] {
+		md.addKeywords(text(k))
+	}
+	md.DateTaken = parseIPTCTime(first(iptcDateCreated), first(iptcTimeCreated))
+	return
+}
+
+// parseIPTCTime parses the date "20060102" and the optional time "150405-0700"
+func parseIPTCTime(date, tm string) *time.Time {
+	if len(date) != 8 {
+		return nil
+	}
+	var (
+		t   time.Time
+		err error
+	)
+	switch len(tm) {
+	case 11:
+		t, err = time.Parse("20060102150405-0700", date+tm)
+	case 6:
+		t, err = time.ParseInLocation("20060102150405", date+tm, time.UTC)
+	default:
+		t, err = time.ParseInLocation("20060102", date, time.UTC)
+	}
+	if err != nil {
+		return nil
+	}
+	return &t
+}
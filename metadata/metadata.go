@@ -0,0 +1,384 @@
+// Package metadata parses the EXIF, IPTC and XMP metadata embedded into JPEG, PNG and WEBP images.
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// MaxSegmentSize is the max size of a metadata block read
+var MaxSegmentSize = 16 * 1024 * 1024
+
+// GPS is the location where the image was taken
+type GPS struct {
+	Latitude  float64
+	Longitude float64
+	Altitude  *float64 `json:",omitempty"`
+}
+
+// Metadata is a normalized subset of image metadata
+type Metadata struct {
+	Make        string     `json:",omitempty"`
+	Model       string     `json:",omitempty"`
+	Lens        string     `json:",omitempty"`
+	DateTaken   *time.Time `json:",omitempty"`
+	GPS         *GPS       `json:",omitempty"`
+	Orientation int        `json:",omitempty"`
+	Artist      string     `json:",omitempty"`
+	Copyright   string     `json:",omitempty"`
+	Caption     string     `json:",omitempty"`
+	Keywords    []string   `json:",omitempty"`
+}
+
+// IsZero return if no metadata was found
+func (m *Metadata) IsZero() bool {
+	return m == nil || (m.Make == "" && m.Model == "" && m.Lens == "" && m.DateTaken == nil && m.GPS == nil &&
+		m.Orientation == 0 && m.Artist == "" && m.Copyright == "" && m.Caption == "" && len(m.Keywords) == 0)
+}
+
+// Camera return the camera make and model
+func (m *Metadata) Camera() string {
+	if m == nil {
+		return ""
+	}
+	if m.Model == "" || strings.HasPrefix(strings.ToLower(m.Model), strings.ToLower(m.Make)) {
+		return strings.TrimSpace(m.Model)
+	}
+	return strings.TrimSpace(m.Make + " " + m.Model)
+}
+
+// Credit return the photographer credit
+func (m *Metadata) Credit() string {
+	if m == nil {
+		return ""
+	}
+	if m.Artist != "" {
+		return m.Artist
+	}
+	return m.Copyright
+}
+
+func (m *Metadata) addKeywords(keywords ...string) {
+	for _, k := range keywords {
+		if k = strings.TrimSpace(k); k == "" {
+			continue
+		}
+		var found bool
+		for _, e := range m.Keywords {
+			if strings.EqualFold(e, k) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			m.Keywords = append(m.Keywords, k)
+		}
+	}
+}
+
+// merge sets the empty fields of m from other
+func (m *Metadata) merge(other *Metadata) {
+	if other == nil {
+		return
+	}
+	setString := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = strings.TrimSpace(src)
+		}
+	}
+	setString(&m.Make, other.Make)
+	setString(&m.Model, other.Model)
+	setString(&m.Lens, other.Lens)
+	setString(&m.Artist, other.Artist)
+	setString(&m.Copyright, other.Copyright)
+	setString(&m.Caption, other.Caption)
+	if m.DateTaken == nil {
+		m.DateTaken = other.DateTaken
+	}
+	if m.GPS == nil {
+		m.GPS = other.GPS
+	}
+	if m.Orientation == 0 {
+		m.Orientation = other.Orientation
+	}
+	m.addKeywords(other.Keywords...)
+}
+
+type blocks struct {
+	exif, iptc, xmp []byte
+}
+
+func (b *blocks) metadata() (*Metadata, error) {
+	var (
+		md   = &Metadata{}
+		errs []string
+	)
+	// EXIF is preferred for camera data, XMP for texts
+	if b.exif != nil {
+		if exif, err := ParseEXIF(b.exif); err != nil {
+			errs = append(errs, "exif: "+err.Error())
+		} else {
+			md.merge(exif)
+		}
+	}
+	var texts = &Metadata{}
+	if b.xmp != nil {
+		if xmp, err := ParseXMP(b.xmp); err != nil {
+			errs = append(errs, "xmp: "+err.Error())
+		} else {
+			texts.merge(xmp)
+		}
+	}
+	if b.iptc != nil {
+		if iptc, err := ParseIPTC(b.iptc); err != nil {
+			errs = append(errs, "iptc: "+err.Error())
+		} else {
+			texts.merge(iptc)
+		}
+	}
+	if texts.Caption != "" {
+		md.Caption = texts.Caption
+	}
+	if texts.Artist != "" {
+		md.Artist = texts.Artist
+	}
+	if texts.Copyright != "" {
+		md.Copyright = texts.Copyright
+	}
+	md.merge(texts)
+
+	if md.IsZero() && errs != nil {
+		return nil, errors.New(strings.Join(errs, "; "))
+	}
+	return md, nil
+}
+
+// Parse reads the metadata of JPEG, PNG or WEBP image. Returns nil metadata for other formats.
+func Parse(r io.Reader) (*Metadata, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(12)
+	if err != nil && len(head) < 4 {
+		return nil, err
+	}
+	var b *blocks
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8}):
+		b, err = jpegBlocks(br)
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		b, err = pngBlocks(br)
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && string(head[8:12]) == "WEBP":
+		b, err = webpBlocks(br)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b.metadata()
+}
+
+// readBlock reads the block of size. The memory grows with the read data, so a block size of truncated file
+// doesn't allocate it at once.
+func readBlock(r io.Reader, size int) ([]byte, error) {
+	if size > MaxSegmentSize {
+		return nil, errors.New("metadata block too large")
+	}
+	if size < 0 {
+		return nil, errors.New("invalid metadata block size")
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(size)))
+	if err == nil && len(data) < size {
+		err = io.ErrUnexpectedEOF
+	}
+	return data, err
+}
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	psHeader   = []byte("Photoshop 3.0\x00")
+)
+
+func jpegBlocks(r *bufio.Reader) (b *blocks, err error) {
+	b = &blocks{}
+	if _, err = r.Discard(2); err != nil {
+		return
+	}
+	for {
+		var marker byte
+		// skip fill bytes
+		for marker == 0 || marker == 0xFF {
+			if marker, err = r.ReadByte(); err != nil {
+				return b, nil
+			}
+		}
+		switch {
+		case marker == 0xD9 || marker == 0xDA:
+			// end of image or start of scan: no more metadata
+			return b, nil
+		case marker >= 0xD0 && marker <= 0xD7, marker == 0x01:
+			continue
+		}
+		var size uint16
+		if err = binary.Read(r, binary.BigEndian, &size); err != nil || size < 2 {
+			return b, nil
+		}
+		if marker != 0xE1 && marker != 0xED {
+			if _, err = r.Discard(int(size) - 2); err != nil {
+				return b, nil
+			}
+			continue
+		}
+		var data []byte
+		if data, err = readBlock(r, int(size)-2); err != nil {
+			return nil, err
+		}
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(data, exifHeader) && b.exif == nil:
+			b.exif = data[len(exifHeader):]
+		case marker == 0xE1 && bytes.HasPrefix(data, xmpHeader) && b.xmp == nil:
+			b.xmp = data[len(xmpHeader):]
+		case marker == 0xED && bytes.HasPrefix(data, psHeader):
+			if iptc := photoshopIPTC(data[len(psHeader):]); iptc != nil {
+				b.iptc = iptc
+			}
+		}
+	}
+}
+
+// photoshopIPTC return the IPTC-NAA resource of Photoshop image resources block
+func photoshopIPTC(data []byte) []byte {
+	for len(data) >= 12 && bytes.HasPrefix(data, []byte("8BIM")) {
+		id := binary.BigEndian.Uint16(data[4:6])
+		// pascal string name, padded to even size
+		nameLen := int(data[6]) + 1
+		if nameLen%2 != 0 {
+			nameLen++
+		}
+		pos := 6 + nameLen
+		if len(data) < pos+4 {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		pos += 4
+		if size < 0 || len(data) < pos+size {
+			return nil
+		}
+		if id == 0x0404 {
+			return data[pos : pos+size]
+		}
+		if size%2 != 0 {
+			size++
+		}
+		if pos+size > len(data) {
+			return nil
+		}
+		data = data[pos+size:]
+	}
+	return nil
+}
+
+func pngBlocks(r *bufio.Reader) (b *blocks, err error) {
+	b = &blocks{}
+	if _, err = r.Discard(8); err != nil {
+		return
+	}
+	for {
+		var (
+			size uint32
+			typ  [4]byte
+		)
+		if err = binary.Read(r, binary.BigEndian, &size); err != nil {
+			return b, nil
+		}
+		if _, err = io.ReadFull(r, typ[:]); err != nil {
+			return b, nil
+		}
+		switch string(typ[:]) {
+		case "IEND":
+			return b, nil
+		case "eXIf", "iTXt", "zTXt":
+			var data []byte
+			if data, err = readBlock(r, int(size)); err != nil {
+				return nil, err
+			}
+			if string(typ[:]) == "eXIf" {
+				b.exif = data
+			} else if xmp := pngXMP(string(typ[:]), data); xmp != nil {
+				b.xmp = xmp
+			}
+			_, err = r.Discard(4)
+		default:
+			_, err = io.CopyN(ioutil.Discard, r, int64(size)+4)
+		}
+		if err != nil {
+			return b, nil
+		}
+	}
+}
+
+// pngXMP return the XMP of iTXt chunk with keyword XML:com.adobe.xmp
+func pngXMP(typ string, data []byte) []byte {
+	const keyword = "XML:com.adobe.xmp\x00"
+	if typ != "iTXt" || !bytes.HasPrefix(data, []byte(keyword)) {
+		return nil
+	}
+	data = data[len(keyword):]
+	// compression flag, compression method, language tag and translated keyword
+	if len(data) < 2 || data[0] != 0 {
+		return nil
+	}
+	data = data[2:]
+	for i := 0; i < 2; i++ {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			return nil
+		}
+		data = data[end+1:]
+	}
+	return data
+}
+
+func webpBlocks(r *bufio.Reader) (b *blocks, err error) {
+	b = &blocks{}
+	if _, err = r.Discard(12); err != nil {
+		return
+	}
+	for {
+		var (
+			typ  [4]byte
+			size uint32
+		)
+		if _, err = io.ReadFull(r, typ[:]); err != nil {
+			return b, nil
+		}
+		if err = binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return b, nil
+		}
+		padded := int64(size) + int64(size%2)
+		switch string(typ[:]) {
+		case "EXIF", "XMP ":
+			var data []byte
+			if data, err = readBlock(r, int(size)); err != nil {
+				return nil, err
+			}
+			if typ[0] == 'E' {
+				b.exif = bytes.TrimPrefix(data, exifHeader)
+			} else {
+				b.xmp = data
+			}
+			_, err = r.Discard(int(padded - int64(size)))
+		default:
+			_, err = io.CopyN(ioutil.Discard, r, padded)
+		}
+		if err != nil {
+			return b, nil
+		}
+	}
+}
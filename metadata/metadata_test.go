@@ -0,0 +1,284 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type ifdEntry struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte
+}
+
+// buildIFD writes the IFD at offset, with the values after it
+func buildIFD(offset uint32, entries []ifdEntry, next uint32) []byte {
+	var (
+		b      bytes.Buffer
+		values bytes.Buffer
+		le     = binary.LittleEndian
+		valOff = offset + 2 + uint32(len(entries))*12 + 4
+	)
+	binary.Write(&b, le, uint16(len(entries)))
+	for _, e := range entries {
+		binary.Write(&b, le, e.tag)
+		binary.Write(&b, le, e.typ)
+		binary.Write(&b, le, e.count)
+		if len(e.value) <= 4 {
+			v := make([]byte, 4)
+			copy(v, e.value)
+			b.Write(v)
+		} else {
+			binary.Write(&b, le, valOff+uint32(values.Len()))
+			values.Write(e.value)
+		}
+	}
+	binary.Write(&b, le, next)
+	b.Write(values.Bytes())
+	return b.Bytes()
+}
+
+func ascii(s string) ifdEntry {
+	return ifdEntry{typ: typeASCII, count: uint32(len(s) + 1), value: append([]byte(s), 0)}
+}
+
+func rationals(values ...[2]uint32) []byte {
+	var b bytes.Buffer
+	for _, v := range values {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	return b.Bytes()
+}
+
+func withTag(tag uint16, e ifdEntry) ifdEntry {
+	e.tag = tag
+	return e
+}
+
+func testEXIF() []byte {
+	short := func(tag, v uint16) ifdEntry {
+		return ifdEntry{tag, typeShort, 1, []byte{byte(v), byte(v >> 8)}}
+	}
+	long := func(tag uint16, v uint32) ifdEntry {
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, v)
+		return ifdEntry{tag, typeLong, 1, b}
+	}
+
+	// the IFD0 size is computed with placeholder offsets
+	ifd0 := func(exifOff, gpsOff uint32) []ifdEntry {
+		return []ifdEntry{
+			withTag(tagImageDescription, ascii("EXIF caption")),
+			withTag(tagMake, ascii("Canon")),
+			withTag(tagModel, ascii("Canon EOS 5D")),
+			short(tagOrientation, 6),
+			withTag(tagArtist, ascii("EXIF Artist")),
+			long(tagExifIFD, exifOff),
+			long(tagGPSIFD, gpsOff),
+		}
+	}
+	exif := []ifdEntry{
+		withTag(tagDateTimeOriginal, ascii("2020:05:06 07:08:09")),
+		withTag(tagOffsetTimeOriginal, ascii("-03:00")),
+		withTag(tagLensModel, ascii("EF 50mm")),
+	}
+	gps := []ifdEntry{
+		withTag(tagGPSLatitudeRef, ascii("S")),
+		{tagGPSLatitude, typeRational, 3, rationals([2]uint32{23, 1}, [2]uint32{30, 1}, [2]uint32{0, 1})},
+		withTag(tagGPSLongitudeRef, ascii("W")),
+		{tagGPSLongitude, typeRational, 3, rationals([2]uint32{46, 1}, [2]uint32{15, 1}, [2]uint32{0, 1})},
+		{tagGPSAltitude, typeRational, 1, rationals([2]uint32{760, 1})},
+	}
+
+	var (
+		ifd0Off = uint32(8)
+		size0   = uint32(len(buildIFD(ifd0Off, ifd0(0, 0), 0)))
+		exifOff = ifd0Off + size0
+		exifB   = buildIFD(exifOff, exif, 0)
+		gpsOff  = exifOff + uint32(len(exifB))
+		data    = []byte("II*\x00\x08\x00\x00\x00")
+	)
+	data = append(data, buildIFD(ifd0Off, ifd0(exifOff, gpsOff), 0)...)
+	data = append(data, exifB...)
+	data = append(data, buildIFD(gpsOff, gps, 0)...)
+	return data
+}
+
+func iptcRecord(dataset byte, value string) []byte {
+	return append([]byte{0x1C, 2, dataset, byte(len(value) >> 8), byte(len(value))}, value...)
+}
+
+func testIPTC() []byte {
+	var b bytes.Buffer
+	b.Write(iptcRecord(iptcKeywords, "beach"))
+	b.Write(iptcRecord(iptcKeywords, "Sunset"))
+	b.Write(iptcRecord(iptcCaption, "IPTC caption"))
+	b.Write(iptcRecord(iptcCopyright, "IPTC Copyright"))
+	b.Write(iptcRecord(iptcByline, "IPTC Artist"))
+	return b.Bytes()
+}
+
+const testXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/"
+	xmlns:aux="http://ns.adobe.com/exif/1.0/aux/" aux:Lens="XMP lens">
+	<dc:description><rdf:Alt><rdf:li xml:lang="x-default">XMP caption</rdf:li></rdf:Alt></dc:description>
+	<dc:subject><rdf:Bag><rdf:li>sunset</rdf:li><rdf:li>sea</rdf:li></rdf:Bag></dc:subject>
+</rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>`
+
+func jpegSegment(marker byte, data []byte) []byte {
+	return append([]byte{0xFF, marker, byte((len(data) + 2) >> 8), byte(len(data) + 2)}, data...)
+}
+
+func testJPEG() []byte {
+	var (
+		b  bytes.Buffer
+		ps bytes.Buffer
+	)
+	iptc := testIPTC()
+	ps.Write(psHeader)
+	ps.WriteString("8BIM\x04\x04\x00\x00")
+	binary.Write(&ps, binary.BigEndian, uint32(len(iptc)))
+	ps.Write(iptc)
+
+	b.Write([]byte{0xFF, 0xD8})
+	b.Write(jpegSegment(0xE0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")))
+	b.Write(jpegSegment(0xE1, append(append([]byte{}, exifHeader...), testEXIF()...)))
+	b.Write(jpegSegment(0xE1, append(append([]byte{}, xmpHeader...), testXMP...)))
+	b.Write(jpegSegment(0xED, ps.Bytes()))
+	b.Write([]byte{0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9})
+	return b.Bytes()
+}
+
+func TestParseJPEG(t *testing.T) {
+	md, err := Parse(bytes.NewReader(testJPEG()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md == nil {
+		t.Fatal("no metadata")
+	}
+
+	if md.Camera() != "Canon EOS 5D" {
+		t.Errorf("Camera() == %q", md.Camera())
+	}
+	if md.Lens != "EF 50mm" {
+		t.Errorf("Lens == %q", md.Lens)
+	}
+	if md.Orientation != 6 {
+		t.Errorf("Orientation == %d", md.Orientation)
+	}
+	if md.DateTaken == nil || md.DateTaken.UTC().Format("2006-01-02 15:04:05") != "2020-05-06 10:08:09" {
+		t.Errorf("DateTaken == %v", md.DateTaken)
+	}
+	if md.GPS == nil || math.Abs(md.GPS.Latitude+23.5) > 1e-9 || math.Abs(md.GPS.Longitude+46.25) > 1e-9 ||
+		md.GPS.Altitude == nil || *md.GPS.Altitude != 760 {
+		t.Errorf("GPS == %+v", md.GPS)
+	}
+	// XMP is preferred for texts, then IPTC
+	if md.Caption != "XMP caption" {
+		t.Errorf("Caption == %q", md.Caption)
+	}
+	if md.Artist != "IPTC Artist" || md.Credit() != "IPTC Artist" {
+		t.Errorf("Artist == %q", md.Artist)
+	}
+	if md.Copyright != "IPTC Copyright" {
+		t.Errorf("Copyright == %q", md.Copyright)
+	}
+	if expected := []string{"sunset", "sea", "beach"}; !reflect.DeepEqual(md.Keywords, expected) {
+		t.Errorf("Keywords == %q, want %q", md.Keywords, expected)
+	}
+}
+
+func TestParseUnknown(t *testing.T) {
+	md, err := Parse(bytes.NewReader([]byte("GIF89a.......")))
+	if md != nil || err != nil {
+		t.Errorf("Parse(GIF) == %v, %v", md, err)
+	}
+}
+
+func TestStripJPEG(t *testing.T) {
+	var b bytes.Buffer
+	if err := Strip(&b, bytes.NewReader(testJPEG()), true); err != nil {
+		t.Fatal(err)
+	}
+	md, err := Parse(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (&Metadata{Orientation: 6}); !reflect.DeepEqual(md, expected) {
+		t.Errorf("Strip(keepOrientation) metadata == %+v, want %+v", md, expected)
+	}
+	if !bytes.Contains(b.Bytes(), []byte("JFIF")) {
+		t.Error("JFIF segment removed")
+	}
+
+	b.Reset()
+	if err := Strip(&b, bytes.NewReader(testJPEG()), false); err != nil {
+		t.Fatal(err)
+	}
+	if md, err = Parse(bytes.NewReader(b.Bytes())); err != nil || !md.IsZero() {
+		t.Errorf("Strip metadata == %+v, %v", md, err)
+	}
+}
+
+func TestStripPNG(t *testing.T) {
+	var (
+		src bytes.Buffer
+		img = image.NewGray(image.Rect(0, 0, 2, 3))
+	)
+	if err := png.Encode(&src, img); err != nil {
+		t.Fatal(err)
+	}
+	// insert the metadata chunks after IHDR: signature (8), IHDR header (8), data (13) and crc (4)
+	var (
+		data = src.Bytes()
+		b    bytes.Buffer
+	)
+	b.Write(data[:33])
+	writePNGChunk(&b, "eXIf", testEXIF())
+	writePNGChunk(&b, "tEXt", []byte("Comment\x00secret"))
+	b.Write(data[33:])
+
+	if md, err := Parse(bytes.NewReader(b.Bytes())); err != nil || md.GPS == nil {
+		t.Fatalf("Parse(PNG) == %+v, %v", md, err)
+	}
+
+	var stripped bytes.Buffer
+	if err := Strip(&stripped, bytes.NewReader(b.Bytes()), true); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stripped.Bytes(), []byte("secret")) {
+		t.Error("tEXt chunk not removed")
+	}
+	if _, err := png.Decode(bytes.NewReader(stripped.Bytes())); err != nil {
+		t.Fatalf("png.Decode == %v", err)
+	}
+	if md, err := Parse(bytes.NewReader(stripped.Bytes())); err != nil || md.GPS != nil || md.Orientation != 6 {
+		t.Errorf("Parse(stripped PNG) == %+v, %v", md, err)
+	}
+}
+
+func TestReadBlock(t *testing.T) {
+	if data, err := readBlock(strings.NewReader("abcdef"), 4); err != nil || string(data) != "abcd" {
+		t.Errorf("readBlock() == %q, %v", data, err)
+	}
+	// the size of a truncated block isn't allocated
+	if _, err := readBlock(strings.NewReader("abc"), MaxSegmentSize); err != io.ErrUnexpectedEOF {
+		t.Errorf("readBlock() of truncated block == %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	for _, size := range []int{MaxSegmentSize + 1, -1} {
+		if _, err := readBlock(strings.NewReader("abc"), size); err == nil {
+			t.Errorf("readBlock() of size %d should fail", size)
+		}
+	}
+}
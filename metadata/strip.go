@@ -0,0 +1,290 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+)
+
+// OrientationEXIF return the TIFF structure of EXIF block with only the orientation tag
+func OrientationEXIF(orientation int) []byte {
+	data := []byte("MM\x00\x2A\x00\x00\x00\x08\x00\x01")
+	data = append(data, byte(tagOrientation>>8), byte(tagOrientation&0xFF), 0, typeShort, 0, 0, 0, 1)
+	data = append(data, byte(orientation>>8), byte(orientation), 0, 0)
+	return append(data, 0, 0, 0, 0)
+}
+
+// Strip copies the JPEG, PNG or WEBP image of r into w without the EXIF, IPTC, XMP and text blocks. The pixels
+// are not decoded. If keepOrientation and the image is not in normal orientation, a EXIF block with only the
+// orientation tag is kept. Other formats are copied unchanged.
+func Strip(w io.Writer, r io.Reader, keepOrientation bool) (err error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(12)
+	if err != nil && len(head) < 4 {
+		if err == io.EOF {
+			err = nil
+		}
+		_, err2 := w.Write(head)
+		if err == nil {
+			err = err2
+		}
+		return
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8}):
+		return stripJPEG(w, br, keepOrientation)
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return stripPNG(w, br, keepOrientation)
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && string(head[8:12]) == "WEBP":
+		return stripWEBP(w, br, keepOrientation)
+	}
+	_, err = io.Copy(w, br)
+	return
+}
+
+// orientation return the orientation of EXIF block if it is not normal
+func orientation(exif []byte, keep bool) int {
+	if !keep {
+		return 0
+	}
+	if md, err := ParseEXIF(exif); err == nil && md.Orientation > 1 {
+		return md.Orientation
+	}
+	return 0
+}
+
+var iccHeader = []byte("ICC_PROFILE\x00")
+
+func writeJPEGSegment(w io.Writer, marker byte, data []byte) (err error) {
+	if len(data)+2 > 0xFFFF {
+		return errors.New("JPEG segment too large")
+	}
+	if _, err = w.Write([]byte{0xFF, marker, byte((len(data) + 2) >> 8), byte(len(data) + 2)}); err == nil {
+		_, err = w.Write(data)
+	}
+	return
+}
+
+func stripJPEG(w io.Writer, r *bufio.Reader, keepOrientation bool) (err error) {
+	var soi [2]byte
+	if _, err = io.ReadFull(r, soi[:]); err != nil {
+		return
+	}
+	if _, err = w.Write(soi[:]); err != nil {
+		return
+	}
+	var exifDone bool
+	for {
+		var marker byte
+		for marker == 0 || marker == 0xFF {
+			if marker, err = r.ReadByte(); err != nil {
+				return
+			}
+		}
+		switch {
+		case marker == 0xDA:
+			// start of scan: copy the entropy coded data and the remaining segments
+			if _, err = w.Write([]byte{0xFF, marker}); err == nil {
+				_, err = io.Copy(w, r)
+			}
+			return
+		case marker == 0xD9:
+			_, err = w.Write([]byte{0xFF, marker})
+			return
+		case marker >= 0xD0 && marker <= 0xD7, marker == 0x01:
+			if _, err = w.Write([]byte{0xFF, marker}); err != nil {
+				return
+			}
+			continue
+		}
+		var size uint16
+		if err = binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size < 2 {
+			return errors.New("invalid JPEG segment size")
+		}
+		data := make([]byte, int(size)-2)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return
+		}
+		var keep bool
+		switch {
+		case marker == 0xE0, marker == 0xEE:
+			// JFIF and Adobe color transform
+			keep = true
+		case marker == 0xE2:
+			keep = bytes.HasPrefix(data, iccHeader)
+		case marker == 0xE1:
+			if !exifDone && bytes.HasPrefix(data, exifHeader) {
+				exifDone = true
+				if o := orientation(data[len(exifHeader):], keepOrientation); o != 0 {
+					if err = writeJPEGSegment(w, marker, append(append([]byte{}, exifHeader...), OrientationEXIF(o)...)); err != nil {
+						return
+					}
+				}
+			}
+		case marker >= 0xE3 && marker <= 0xEF, marker == 0xFE:
+			// other application segments and comments
+		default:
+			keep = true
+		}
+		if keep {
+			if err = writeJPEGSegment(w, marker, data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// png chunks removed by Strip
+var pngStripChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+func writePNGChunk(w io.Writer, typ string, data []byte) (err error) {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(data)))
+	copy(header[4:], typ)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	if _, err = w.Write(header[:]); err != nil {
+		return
+	}
+	if _, err = w.Write(data); err != nil {
+		return
+	}
+	return binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+func stripPNG(w io.Writer, r *bufio.Reader, keepOrientation bool) (err error) {
+	var signature [8]byte
+	if _, err = io.ReadFull(r, signature[:]); err != nil {
+		return
+	}
+	if _, err = w.Write(signature[:]); err != nil {
+		return
+	}
+	for {
+		var header [8]byte
+		if _, err = io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return
+		}
+		var (
+			size = int64(binary.BigEndian.Uint32(header[:4]))
+			typ  = string(header[4:])
+		)
+		if !pngStripChunks[typ] {
+			if _, err = w.Write(header[:]); err != nil {
+				return
+			}
+			if _, err = io.CopyN(w, r, size+4); err != nil || typ == "IEND" {
+				return
+			}
+			continue
+		}
+		if typ == "eXIf" && keepOrientation {
+			var data []byte
+			if data, err = readBlock(r, int(size)); err != nil {
+				return
+			}
+			if o := orientation(data, true); o != 0 {
+				if err = writePNGChunk(w, typ, OrientationEXIF(o)); err != nil {
+					return
+				}
+			}
+			_, err = r.Discard(4)
+		} else {
+			_, err = io.CopyN(ioutil.Discard, r, size+4)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// VP8X flags
+const (
+	webpFlagXMP  = 0x04
+	webpFlagEXIF = 0x08
+)
+
+func stripWEBP(w io.Writer, r *bufio.Reader, keepOrientation bool) (err error) {
+	// the RIFF size changes, so the chunks are buffered
+	var header [12]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return
+	}
+	var (
+		body bytes.Buffer
+		vp8x []byte
+		exif []byte
+	)
+	for {
+		var (
+			typ  [4]byte
+			size uint32
+		)
+		if _, err = io.ReadFull(r, typ[:]); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return
+		}
+		if err = binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return
+		}
+		var data []byte
+		if data, err = readBlock(r, int(size)+int(size%2)); err != nil {
+			return
+		}
+		switch string(typ[:]) {
+		case "EXIF":
+			if o := orientation(bytes.TrimPrefix(data[:size], exifHeader), keepOrientation); o != 0 {
+				exif = OrientationEXIF(o)
+			}
+			continue
+		case "XMP ":
+			continue
+		case "VP8X":
+			if vp8x == nil && len(data) >= 1 {
+				vp8x = data
+				continue
+			}
+		}
+		body.Write(typ[:])
+		binary.Write(&body, binary.LittleEndian, size)
+		body.Write(data)
+	}
+	err = nil
+
+	var chunks bytes.Buffer
+	if vp8x != nil {
+		vp8x[0] &^= webpFlagXMP | webpFlagEXIF
+		if exif != nil {
+			vp8x[0] |= webpFlagEXIF
+		}
+		chunks.WriteString("VP8X")
+		binary.Write(&chunks, binary.LittleEndian, uint32(len(vp8x)))
+		chunks.Write(vp8x)
+	}
+	chunks.Write(body.Bytes())
+	if exif != nil && vp8x != nil {
+		// the EXIF chunk is valid only with the VP8X chunk
+		chunks.WriteString("EXIF")
+		binary.Write(&chunks, binary.LittleEndian, uint32(len(exif)))
+		chunks.Write(exif)
+	}
+
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+chunks.Len()))
+	if _, err = w.Write(header[:]); err == nil {
+		_, err = w.Write(chunks.Bytes())
+	}
+	return
+}
@@ -0,0 +1,132 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XMP namespaces
+const (
+	nsRDF       = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsDC        = "http://purl.org/dc/elements/1.1/"
+	nsPhotoshop = "http://ns.adobe.com/photoshop/1.0/"
+	nsEXIF      = "http://ns.adobe.com/exif/1.0/"
+	nsEXIFEX    = "http://cipa.jp/exif/1.0/"
+	nsTIFF      = "http://ns.adobe.com/tiff/1.0/"
+	nsAux       = "http://ns.adobe.com/exif/1.0/aux/"
+	nsXMP       = "http://ns.adobe.com/xap/1.0/"
+)
+
+var xmpTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseXMPTime parses the XMP date, like "2006-01-02T15:04:05+07:00"
+func parseXMPTime(value string) *time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range xmpTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+type xmpProperties map[xml.Name][]string
+
+func (p xmpProperties) first(space, local string) string {
+	if v := p[xml.Name{Space: space, Local: local}]; len(v) > 0 {
+		return strings.TrimSpace(v[0])
+	}
+	return ""
+}
+
+// ParseXMP parses the XMP packet
+func ParseXMP(data []byte) (md *Metadata, err error) {
+	var (
+		d     = xml.NewDecoder(bytes.NewReader(data))
+		props = xmpProperties{}
+		// stack of open elements
+		stack []xml.Name
+		text  strings.Builder
+		// property of the current value
+		property *xml.Name
+	)
+	d.Strict = false
+
+	for {
+		var tok xml.Token
+		if tok, err = d.Token(); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == nsRDF && t.Name.Local == "Description" {
+				// simple properties as attributes
+				for _, attr := range t.Attr {
+					if attr.Name.Space != nsRDF && attr.Name.Space != "xmlns" && attr.Name.Space != "" {
+						props[attr.Name] = append(props[attr.Name], attr.Value)
+					}
+				}
+			} else if t.Name.Space != nsRDF && len(stack) > 0 {
+				if parent := stack[len(stack)-1]; parent.Space == nsRDF && parent.Local == "Description" {
+					name := t.Name
+					property = &name
+				}
+			}
+			stack = append(stack, t.Name)
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if property != nil {
+				leaf := (t.Name.Space == nsRDF && t.Name.Local == "li") || t.Name == *property
+				if leaf && strings.TrimSpace(text.String()) != "" {
+					props[*property] = append(props[*property], text.String())
+				}
+				if t.Name == *property {
+					property = nil
+				}
+			}
+			text.Reset()
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	err = nil
+
+	md = &Metadata{
+		Make:      props.first(nsTIFF, "Make"),
+		Model:     props.first(nsTIFF, "Model"),
+		Artist:    props.first(nsDC, "creator"),
+		Copyright: props.first(nsDC, "rights"),
+		Caption:   props.first(nsDC, "description"),
+	}
+	if md.Lens = props.first(nsEXIFEX, "LensModel"); md.Lens == "" {
+		md.Lens = props.first(nsAux, "Lens")
+	}
+	if o, err := strconv.Atoi(props.first(nsTIFF, "Orientation")); err == nil && o >= 1 && o <= 8 {
+		md.Orientation = o
+	}
+	for _, name := range [][2]string{{nsEXIF, "DateTimeOriginal"}, {nsPhotoshop, "DateCreated"}, {nsXMP, "CreateDate"}} {
+		if md.DateTaken = parseXMPTime(props.first(name[0], name[1])); md.DateTaken != nil {
+			break
+		}
+	}
+	for _, k := range props[xml.Name{Space: nsDC, Local: "subject"}] {
+		md.addKeywords(k)
+	}
+	return
+}
@@ -2,21 +2,29 @@ package oss
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
-	"github.com/ecletus/media"
+	"io"
+	"io/ioutil"
 	"mime/multipart"
+	"os"
 	"reflect"
 
+	"github.com/ecletus/media"
+
 	"github.com/dsnet/golib/memfile"
 
 	"github.com/ecletus/core"
 
 	"github.com/ecletus/serializable_meta"
 	"github.com/moisespsena-go/aorm"
+	errwrap "github.com/moisespsena-go/error-wrap"
 )
 
 var E_SAVE_AND_CROP = PKG + ":save_and_crop"
+
+// E_SYNC_IMAGE_LINK is the callback that downloads the remote image links, see `ImageLinkSyncer`
+var E_SYNC_IMAGE_LINK = PKG + ":sync_image_link"
 var DB_CALLBACK_IGNORE = PKG + ".callback.ignore"
 
 func IgnoreCallback(db *aorm.DB) *aorm.DB {
@@ -35,47 +43,69 @@ func IsIgnoreCallback(v interface{}) bool {
 	return false
 }
 
-func cropField(img ImageInterface) (cropped bool, err error) {
-	var file multipart.File
-	if fileHeader := img.GetFileHeader(); fileHeader != nil {
-		file, err = img.GetFileHeader().Open()
-	} else {
-		file, err = img.Retrieve(img.URL())
-	}
-
-	if err != nil {
-		return false, err
+// openFile opens the uploaded file, or the stored file if there is no upload
+func openFile(ctx context.Context, oss OSSInterface) (file multipart.File, err error) {
+	if fileHeader := oss.GetFileHeader(); fileHeader != nil {
+		return fileHeader.Open()
 	}
+	return media.Retrieve(ctx, oss, oss.URL())
+}
 
+func cropField(ctx context.Context, img ImageInterface, file multipart.File) (cropped bool, err error) {
 	img.Cropped(true)
 
 	if file != nil {
 		var cropper *ImageCropper
-		if cropper, err = NewImageCropper(img, file); err != nil {
+		if cropper, err = NewImageCropperContext(ctx, img, file); err != nil {
 			return false, err
 		}
 
 		cb := func(key string, f *bytes.Buffer) (err error) {
-			return img.Store(img.URL(key), f)
+			return media.Store(ctx, img, media.StorageURL(img, key), f)
 		}
+		// the original which format has no encoder keeps the uploaded bytes, without the original style
 		var original bool
-		if err = cropper.CropNames(func(key string, f *bytes.Buffer) error {
-			original = true
-			if cropper, err = NewImageCropper(img, memfile.New(f.Bytes())); err != nil {
-				return err
+		if cropper.Reencodable() {
+			if err = cropper.CropNames(func(key string, f *bytes.Buffer) error {
+				original = true
+				if cropper, err = NewImageCropperContext(ctx, img, memfile.New(f.Bytes())); err != nil {
+					return err
+				}
+				return cb(key, f)
+			}, IMAGE_STYLE_ORIGNAL); err != nil {
+				return false, err
 			}
-			return cb(key, f)
-		}, IMAGE_STYLE_ORIGNAL); err != nil {
-			return false, err
 		}
 
 		size := img.GetOriginalSize()
 		size.Width = cropper.Width()
 		size.Height = cropper.Height()
 
+		if err = cropper.setPlaceholder(); err != nil {
+			return false, err
+		}
+		cropper.setPalette()
+		cropper.setPerceptualHash()
+
 		if !original {
-			img.Store(img.URL(IMAGE_STYLE_ORIGNAL), file)
-			file.Seek(0, 0)
+			if cropper.Oriented() && cropper.Reencodable() {
+				// stores the rotated original, so the crop coordinates match it
+				var buf bytes.Buffer
+				if err = cropper.Encode(&buf); err != nil {
+					return false, errwrap.Wrap(err, "Encode oriented original")
+				}
+				err = media.Store(ctx, img, media.StorageURL(img, IMAGE_STYLE_ORIGNAL), &buf)
+			} else {
+				file.Seek(0, 0)
+				var r io.Reader
+				if r, err = stripMetadata(img, file); err == nil {
+					err = media.Store(ctx, img, media.StorageURL(img, IMAGE_STYLE_ORIGNAL), r)
+				}
+				file.Seek(0, 0)
+			}
+			if err != nil {
+				return false, err
+			}
 		}
 
 		var names []string
@@ -96,6 +126,76 @@ func cropField(img ImageInterface) (cropped bool, err error) {
 	return true, err
 }
 
+// storedContent return the content stored as original: the upload with stripped metadata and sanitized SVG
+func storedContent(oss OSSInterface, file io.Reader) (r io.Reader, err error) {
+	if r, err = stripMetadata(oss, file); err != nil {
+		return
+	}
+	return sanitizeSVG(oss, r)
+}
+
+// tempContent is a content buffered in a temp file, removed on Close
+type tempContent struct {
+	*os.File
+}
+
+func (c tempContent) Close() error {
+	err := c.File.Close()
+	os.Remove(c.Name())
+	return err
+}
+
+// hashContent hashes the stored content while it streams into a temp file, and sets its SHA-256, the address of
+// content addressed medias. The content is read again from the temp file, removed on Close.
+func hashContent(oss OSSInterface, content io.Reader) (_ io.ReadCloser, err error) {
+	var file *os.File
+	if file, err = ioutil.TempFile("", "media-content"); err != nil {
+		return nil, errwrap.Wrap(err, "Hash %q", oss.GetFileName())
+	}
+	tmp := tempContent{file}
+	reader := media.NewHashingReader(content)
+	if _, err = io.Copy(tmp, reader); err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		return nil, errwrap.Wrap(err, "Hash %q", oss.GetFileName())
+	}
+	oss.SetSHA256(reader.Sum())
+	return tmp, nil
+}
+
+// storeOriginal stores the content hashing it while it streams.
+// Content addressed medias reuse the object already stored with same content.
+func storeOriginal(ctx context.Context, oss OSSInterface, url string, content io.Reader) (err error) {
+	if oss.ContentAddressed() {
+		var found bool
+		if found, err = oss.Exists(url); err != nil || found {
+			return
+		}
+	}
+	if oss.GetSHA256() != "" {
+		return media.Store(ctx, oss, url, content)
+	}
+	reader := media.NewHashingReader(content)
+	if err = media.Store(ctx, oss, url, reader); err == nil {
+		oss.SetSHA256(reader.Sum())
+	}
+	return
+}
+
+// handleMedia runs the media handlers pipeline
+func handleMedia(ctx context.Context, oss OSSInterface) (media.HandleReport, error) {
+	return media.HandleWithReport(ctx, oss, func(name string, handler media.MediaHandler) (err error) {
+		var file multipart.File
+		if file, err = openFile(ctx, oss); err != nil {
+			return
+		}
+		defer file.Close()
+		return media.CallHandler(ctx, handler, oss, file, oss.FieldOption())
+	})
+}
+
 func saveField(field *aorm.Field, scope *aorm.Scope) (changed bool) {
 	if field.Field.CanAddr() {
 		if oss, ok := field.Field.Addr().Interface().(OSSInterface); ok {
@@ -107,45 +207,121 @@ func saveField(field *aorm.Field, scope *aorm.Scope) (changed bool) {
 			}
 
 			oss.Init(core.GetSiteFromDB(scope.DB()), field)
+			if v, ok := oss.(interface{ GetURLTemplateError() error }); ok {
+				if err := v.GetURLTemplateError(); err != nil {
+					scope.Err(errwrap.Wrap(err, "Field %q", field.Name))
+					return false
+				}
+			}
+			if v, ok := oss.(interface{ GetSizesError() error }); ok {
+				if err := v.GetSizesError(); err != nil {
+					scope.Err(errwrap.Wrap(err, "Field %q", field.Name))
+					return false
+				}
+			}
 
-			var url string
+			var (
+				url string
+				ctx = media.ScopeContext(scope)
+			)
 
 			if oss.IsNew() {
-				if url = oss.GetURL(scope, field, oss); url == "" {
-					scope.Err(errors.New("invalid URL"))
-					return false
-				}
-				result, _ := json.Marshal(map[string]string{"Url": url})
-				oss.MediaScan(media.NewContext(oss, map[interface{}]interface{}{"oss.db_callback":true}), result)
 				// is new
+				if v, ok := oss.(media.FileValidator); ok {
+					// the uploads of new records are scanned before Init, without the validators of field tag
+					if err := v.ValidateFile(oss); err != nil {
+						err = media.TranslateError(media.CoreContextOf(scope), err)
+						scope.Err(errwrap.Wrap(err, "Validate field %q", field.Name))
+						return false
+					}
+				}
 				file, err := oss.GetFileHeader().Open()
 				if err != nil {
 					scope.Err(err)
 					return false
 				}
 				defer file.Close()
-				if err = oss.Store(url, file); err != nil {
+				content, err := storedContent(oss, file)
+				if err != nil {
+					scope.Err(err)
+					return false
+				}
+				if oss.ContentAddressed() {
+					// the address is the hash of stored content, not of upload
+					var hashed io.ReadCloser
+					if hashed, err = hashContent(oss, content); err != nil {
+						scope.Err(err)
+						return false
+					}
+					defer hashed.Close()
+					content = hashed
+				}
+				var styleURL string
+				if v, ok := oss.(media.StyleURLGetter); ok {
+					url, styleURL, err = v.GetStyleURL(scope, field, oss)
+				} else {
+					url, err = oss.GetURL(scope, field, oss)
+				}
+				if err != nil {
+					scope.Err(errwrap.Wrap(err, "URL of field %q", field.Name))
+					return false
+				}
+				if err = checkSVGURL(oss, url); err != nil {
+					scope.Err(errwrap.Wrap(err, "URL of field %q", field.Name))
+					return false
+				}
+				result, _ := json.Marshal(map[string]string{"Url": url, "StyleUrl": styleURL})
+				oss.MediaScan(media.NewContext(oss, map[interface{}]interface{}{"oss.db_callback":true}), result)
+				if err = storeOriginal(ctx, oss, url, content); err != nil {
 					scope.Err(err)
 					return false
 				}
+				changed = true
 			}
 
-			if img, ok := oss.(ImageInterface); ok {
-				if img.Cropped() {
+			if img, ok := oss.(ImageInterface); ok && IsAsync(oss) && img.IsImage() && (img.IsNew() || img.NeedCrop()) {
+				// the metadata is read from upload, the stored original could be stripped
+				if err := extractMetadata(ctx, img); err != nil {
+					scope.Err(err)
 					return false
 				}
-				if img.IsNew() || img.NeedCrop() {
-					var err error
-					if changed, err = cropField(img); err != nil {
-						scope.Err(err)
-					}
+				if err := enqueueJob(scope, field, img); err != nil {
+					scope.Err(err)
+					return false
 				}
+				return true
+			}
+
+			// the styles are cropped by the registered image handler (IMAGE_HANDLER), so the handlers registered
+			// before or after it, or replacing it, like handlers/vips, runs in the same pipeline
+			report, err := handleMedia(ctx, oss)
+			if err != nil {
+				scope.Err(err)
+				return false
+			}
+			if len(report.Handled()) > 0 {
+				changed = true
 			}
 		}
 	}
 	return changed
 }
 
+// ImageProcessedHandler is implemented by records with columns derived from its images, like the
+// dominant color. The returned columns are updated after the image processing.
+type ImageProcessedHandler interface {
+	ImageProcessed(db *aorm.DB, field string, img ImageInterface) map[string]interface{}
+}
+
+func imageProcessedColumns(db *aorm.DB, record interface{}, field *aorm.Field) map[string]interface{} {
+	if handler, ok := record.(ImageProcessedHandler); ok {
+		if img, ok := field.Field.Addr().Interface().(ImageInterface); ok {
+			return handler.ImageProcessed(db, field.Name, img)
+		}
+	}
+	return nil
+}
+
 func saveAndCropImage(isCreate bool) func(scope *aorm.Scope) {
 	return func(scope *aorm.Scope) {
 		if IsIgnoreCallback(scope) {
@@ -189,12 +365,17 @@ func saveAndCropImage(isCreate bool) func(scope *aorm.Scope) {
 
 			// Handle Normal Field
 			for _, field := range scope.Instance().Fields {
-				if saveField(field, scope) && isCreate {
-					if oss, ok := field.Field.Addr().Interface().(OSSInterface); ok {
-						if !oss.IsZero() {
-							updateColumns[field.DBName] = oss
+				if saveField(field, scope) {
+					if isCreate {
+						if oss, ok := field.Field.Addr().Interface().(OSSInterface); ok {
+							if !oss.IsZero() {
+								updateColumns[field.DBName] = oss
+							}
 						}
 					}
+					for column, value := range imageProcessedColumns(scope.NewDB(), scope.Value, field) {
+						updateColumns[column] = value
+					}
 				}
 			}
 
@@ -205,8 +386,23 @@ func saveAndCropImage(isCreate bool) func(scope *aorm.Scope) {
 	}
 }
 
+// syncImageLink downloads the remote image links before the DB transaction begins, so the transaction isn't kept
+// open while downloading. The image fields are stored by saveAndCropImage.
+func syncImageLink(scope *aorm.Scope) {
+	if IsIgnoreCallback(scope) || scope.HasError() {
+		return
+	}
+	if syncer, ok := scope.Value.(ImageLinkSyncer); ok {
+		if _, err := syncer.SyncImageLink(); err != nil {
+			scope.Err(err)
+		}
+	}
+}
+
 // RegisterCallbacks register callback into GORM DB
 func RegisterCallbacks(db *aorm.DB) {
+	db.Callback().Create().Before("aorm:begin_transaction").Register(E_SYNC_IMAGE_LINK, syncImageLink)
+	db.Callback().Update().Before("aorm:begin_transaction").Register(E_SYNC_IMAGE_LINK, syncImageLink)
 	db.Callback().Update().Before("aorm:before_save").Register(E_SAVE_AND_CROP, saveAndCropImage(false))
 	db.Callback().Create().After("gorm:after_create").Register(E_SAVE_AND_CROP, saveAndCropImage(true))
 }
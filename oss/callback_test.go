@@ -0,0 +1,35 @@
+package oss
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ecletus/media"
+)
+
+func TestHashContent(t *testing.T) {
+	var (
+		m    = &OSS{Base: media.Base{FileName: "a.txt"}}
+		data = strings.Repeat("content", 1000)
+		sum  = sha256.Sum256([]byte(data))
+	)
+	r, err := hashContent(m, strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := m.GetSHA256(), hex.EncodeToString(sum[:]); got != want {
+		t.Errorf("SHA256 == %q, want %q", got, want)
+	}
+	if read, _ := ioutil.ReadAll(r); string(read) != data {
+		t.Errorf("content read again differs")
+	}
+	name := r.(tempContent).Name()
+	r.Close()
+	if _, err = os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("temp file should be removed on Close: %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package oss
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"sort"
+
+	"github.com/disintegration/imaging"
+	"github.com/ecletus/media"
+)
+
+// OPT_GIF_STATIC_PREVIEW is the option of animated GIF images with the preview style as a static PNG of first frame:
+// `image:"gif_static_preview"`
+const OPT_GIF_STATIC_PREVIEW = "image.gif_static_preview"
+
+// IsGIFStaticPreview return if the preview style of GIF images is a static PNG
+func IsGIFStaticPreview(m media.Media) bool {
+	if opt := m.FieldOption(); opt != nil {
+		return opt.Get(OPT_GIF_STATIC_PREVIEW) != ""
+	}
+	return false
+}
+
+// CoalesceGIF return the frames of g drawn over the full canvas, applying the disposal methods of previous
+// frames. The frames of optimized GIFs are sub-rectangles with the changes from previous frame.
+func CoalesceGIF(g *gif.GIF) []*image.NRGBA {
+	var (
+		bounds = image.Rect(0, 0, g.Config.Width, g.Config.Height)
+		canvas *image.NRGBA
+		frames = make([]*image.NRGBA, len(g.Image))
+	)
+	if bounds.Empty() && len(g.Image) > 0 {
+		bounds = g.Image[0].Bounds()
+	}
+	canvas = image.NewNRGBA(bounds)
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = imaging.Clone(canvas)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		frames[i] = imaging.Clone(canvas)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames
+}
+
+type quantizeEntry struct {
+	key   int
+	rgb   [3]float64
+	count float64
+}
+
+type quantizeBox []*quantizeEntry
+
+// channelRange return the channel with widest range of box and its range
+func (box quantizeBox) channelRange() (channel int, width float64) {
+	for c := 0; c < 3; c++ {
+		min, max := 255.0, 0.0
+		for _, e := range box {
+			if e.rgb[c] < min {
+				min = e.rgb[c]
+			}
+			if e.rgb[c] > max {
+				max = e.rgb[c]
+			}
+		}
+		if max-min > width {
+			channel, width = c, max-min
+		}
+	}
+	return
+}
+
+// Quantize return img as paletted image of up to maxColors colors, by median cut. The pixels with alpha
+// below 128 are transparent, using one of the colors.
+func Quantize(img image.Image, maxColors int) *image.Paletted {
+	var (
+		bounds      = img.Bounds()
+		src         = imaging.Clone(img)
+		entries     = map[int]*quantizeEntry{}
+		transparent bool
+	)
+	for i := 0; i+3 < len(src.Pix); i += 4 {
+		p := src.Pix[i : i+4]
+		if p[3] < 128 {
+			transparent = true
+			continue
+		}
+		key := int(p[0]>>3)<<10 | int(p[1]>>3)<<5 | int(p[2]>>3)
+		e := entries[key]
+		if e == nil {
+			e = &quantizeEntry{key: key}
+			entries[key] = e
+		}
+		e.rgb[0] += float64(p[0])
+		e.rgb[1] += float64(p[1])
+		e.rgb[2] += float64(p[2])
+		e.count++
+	}
+	if transparent {
+		maxColors--
+	}
+
+	all := make(quantizeBox, 0, len(entries))
+	for _, e := range entries {
+		e.rgb = [3]float64{e.rgb[0] / e.count, e.rgb[1] / e.count, e.rgb[2] / e.count}
+		all = append(all, e)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].key < all[j].key })
+
+	var boxes []quantizeBox
+	if len(all) > 0 {
+		boxes = append(boxes, all)
+	}
+	for len(boxes) < maxColors {
+		// splits the box with widest channel range
+		best, bestWidth, bestChannel := -1, 0.0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			if c, w := box.channelRange(); w > bestWidth {
+				best, bestWidth, bestChannel = i, w, c
+			}
+		}
+		if best < 0 {
+			break
+		}
+		box := boxes[best]
+		sort.SliceStable(box, func(i, j int) bool { return box[i].rgb[bestChannel] < box[j].rgb[bestChannel] })
+		var total, half float64
+		for _, e := range box {
+			total += e.count
+		}
+		split := 1
+		for i, e := range box[:len(box)-1] {
+			if half += e.count; half >= total/2 {
+				split = i + 1
+				break
+			}
+		}
+		boxes[best], boxes = box[:split], append(boxes, box[split:])
+	}
+
+	var (
+		palette = make(color.Palette, 0, len(boxes)+1)
+		indexes = map[int]uint8{}
+	)
+	for i, box := range boxes {
+		var sum [4]float64
+		for _, e := range box {
+			sum[0] += e.rgb[0] * e.count
+			sum[1] += e.rgb[1] * e.count
+			sum[2] += e.rgb[2] * e.count
+			sum[3] += e.count
+			indexes[e.key] = uint8(i)
+		}
+		palette = append(palette, rgbColor([3]float64{sum[0] / sum[3], sum[1] / sum[3], sum[2] / sum[3]}))
+	}
+	transparentIndex := uint8(len(palette))
+	if transparent || len(palette) == 0 {
+		palette = append(palette, color.NRGBA{})
+	}
+
+	dst := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), palette)
+	for i, j := 0, 0; i+3 < len(src.Pix); i, j = i+4, j+1 {
+		p := src.Pix[i : i+4]
+		if p[3] < 128 {
+			dst.Pix[j] = transparentIndex
+		} else {
+			dst.Pix[j] = indexes[int(p[0]>>3)<<10|int(p[1]>>3)<<5|int(p[2]>>3)]
+		}
+	}
+	return dst
+}
+
+// frames return the coalesced frames of GIF
+func (cropper *ImageCropper) frames() []*image.NRGBA {
+	if cropper.coalesced == nil {
+		cropper.coalesced = CoalesceGIF(cropper.gif)
+	}
+	return cropper.coalesced
+}
@@ -0,0 +1,95 @@
+package oss
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"testing"
+)
+
+func TestCoalesceGIF(t *testing.T) {
+	var (
+		red   = color.RGBA{R: 255, A: 255}
+		blue  = color.RGBA{B: 255, A: 255}
+		pal   = color.Palette{color.Transparent, red, blue}
+		first = image.NewPaletted(image.Rect(0, 0, 4, 4), pal)
+		// partial frame over the right half
+		second = image.NewPaletted(image.Rect(2, 0, 4, 4), pal)
+		// partial frame over the top left pixel, restored after
+		third  = image.NewPaletted(image.Rect(0, 0, 1, 1), pal)
+		fourth = image.NewPaletted(image.Rect(3, 3, 4, 4), pal)
+	)
+	for i := range first.Pix {
+		first.Pix[i] = 1
+	}
+	for i := range second.Pix {
+		second.Pix[i] = 2
+	}
+	third.Pix[0] = 2
+
+	frames := CoalesceGIF(&gif.GIF{
+		Image:    []*image.Paletted{first, second, third, fourth},
+		Delay:    []int{10, 10, 10, 10},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious, gif.DisposalNone},
+		Config:   image.Config{Width: 4, Height: 4},
+	})
+	at := func(frame, x, y int) color.NRGBA {
+		return frames[frame].NRGBAAt(x, y)
+	}
+	if len(frames) != 4 || frames[1].Bounds() != image.Rect(0, 0, 4, 4) {
+		t.Fatalf("frames == %d", len(frames))
+	}
+	if at(1, 0, 0) != (color.NRGBA{R: 255, A: 255}) || at(1, 3, 0) != (color.NRGBA{B: 255, A: 255}) {
+		t.Errorf("frame 1 == %v, %v", at(1, 0, 0), at(1, 3, 0))
+	}
+	// the right half was disposed to background
+	if at(2, 0, 0) != (color.NRGBA{B: 255, A: 255}) || at(2, 3, 0).A != 0 || at(2, 1, 1) != (color.NRGBA{R: 255, A: 255}) {
+		t.Errorf("frame 2 == %v, %v, %v", at(2, 0, 0), at(2, 3, 0), at(2, 1, 1))
+	}
+	// the top left pixel was restored to previous
+	if at(3, 0, 0) != (color.NRGBA{R: 255, A: 255}) || at(3, 3, 3).A != 0 {
+		t.Errorf("frame 3 == %v, %v", at(3, 0, 0), at(3, 3, 3))
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 4), B: 128, A: 255})
+		}
+	}
+	img.SetNRGBA(0, 0, color.NRGBA{})
+
+	q := Quantize(img, 256)
+	if len(q.Palette) != 256 {
+		t.Fatalf("palette of %d colors", len(q.Palette))
+	}
+	if _, _, _, a := q.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("transparent pixel == %v", q.At(0, 0))
+	}
+	c := color.NRGBAModel.Convert(q.At(40, 20)).(color.NRGBA)
+	if diff(c.R, 160) > 16 || diff(c.G, 80) > 16 || diff(c.B, 128) > 16 {
+		t.Errorf("quantized color == %v", c)
+	}
+
+	// images with few colors keep the exact colors
+	few := image.NewPaletted(image.Rect(0, 0, 8, 8), palette.Plan9[:4])
+	for i := range few.Pix {
+		few.Pix[i] = uint8(i % 4)
+	}
+	q = Quantize(few, 256)
+	for i := 0; i < 4; i++ {
+		if got, want := color.NRGBAModel.Convert(q.At(i, 0)), color.NRGBAModel.Convert(palette.Plan9[i]); got != want {
+			t.Errorf("color %d == %v, expected %v", i, got, want)
+		}
+	}
+}
+
+func diff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
@@ -1,27 +1,25 @@
 package oss
 
 import (
-	"bytes"
-	"github.com/pkg/errors"
+	"context"
 	"image"
-	"image/draw"
-	"image/gif"
 	_ "image/jpeg"
 	"image/png"
 	"mime/multipart"
 
 	"github.com/ecletus/media"
-
-	"github.com/disintegration/imaging"
 )
 
-// imageHandler default image handler
+// IMAGE_HANDLER is the name of default image handler
+const IMAGE_HANDLER = "image_handler"
+
+// imageHandler default image handler, crops the image and saves its styles
 type imageHandler struct{}
 
 func (imageHandler) CouldHandle(m media.Media) bool {
 	if m.IsImage() {
 		if im, ok := m.(ImageInterface); ok {
-			return im.NeedCrop()
+			return !im.Cropped() && (im.IsNew() || im.NeedCrop() || im.GetProcessingStatus() == PROCESSING_PROCESSING)
 		}
 	}
 	return false
@@ -33,115 +31,15 @@ func init() {
 	image.RegisterFormat("png", "png", png.Decode, png.DecodeConfig)
 }
 
-func (imageHandler) Handle(m media.Media, file multipart.File, option *media.Option) (err error) {
-	im := m.(ImageInterface)
-	if format, err := media.GetImageFormat(im.URL()); err == nil {
-		var buffer bytes.Buffer
-		if *format == imaging.GIF {
-			if g, err := gif.DecodeAll(file); err == nil {
-				if cropOption := im.GetCropOption(IMAGE_STYLE_ORIGNAL); cropOption != nil {
-					for i := range g.Image {
-						img := imaging.Crop(g.Image[i], *cropOption.Rectangle())
-						g.Image[i] = image.NewPaletted(img.Rect, g.Image[i].Palette)
-						draw.Draw(g.Image[i], img.Rect, img, image.Pt(0, 0), draw.Src)
-						if i == 0 {
-							g.Config.Width = img.Rect.Dx()
-							g.Config.Height = img.Rect.Dy()
-						}
-					}
-				}
-
-				if err = gif.EncodeAll(&buffer, g); err != nil {
-					return errors.Wrap(err, "ecletus/media/oss.imageHandler#Handle: gif encode all")
-				}
-				if err = im.Store(im.URL(), &buffer); err != nil {
-					return errors.Wrap(err, "ecletus/media/oss.imageHandler#Handle: store")
-				}
-			} else {
-				return err
-			}
-
-			// save sizes image
-			for key, size := range im.GetSizes() {
-				file.Seek(0, 0)
-				if g, err := gif.DecodeAll(file); err == nil {
-					for i := range g.Image {
-						var img image.Image = g.Image[i]
-						if cropOption := im.GetCropOption(key); cropOption != nil {
-							img = imaging.Crop(g.Image[i], *cropOption.Rectangle())
-						}
-						img = imaging.Thumbnail(img, size.Width, size.Height, imaging.Lanczos)
-						g.Image[i] = image.NewPaletted(image.Rect(0, 0, size.Width, size.Height), g.Image[i].Palette)
-						draw.Draw(g.Image[i], image.Rect(0, 0, size.Width, size.Height), img, image.Pt(0, 0), draw.Src)
-					}
-
-					var result bytes.Buffer
-					g.Config.Width = size.Width
-					g.Config.Height = size.Height
-					if err = gif.EncodeAll(&result, g); err != nil {
-						return errors.Wrap(err, "ecletus/media/oss.imageHandler#Handle: gif encode all")
-					}
-					if err = im.Store(im.URL(key), &result); err != nil {
-						return errors.Wrap(err, "ecletus/media/oss.imageHandler#Handle: store")
-					}
-				}
-			}
-		} else {
-			/*tmp, err := os.Create("tmp.png")
-			defer tmp.Close()
-			io.Copy(tmp, file)
-
-			_, err = png.Decode(file)
-			if err != nil {
-				fmt.Println("PNG DECODE ERROR: ", err)
-				fmt.Println("PNG DECODE ERROR: ", file.Read)
-				return err
-			}
-			*/
-			///return toNRGBA(img), nil
-
-			if img, err := imaging.Decode(&buffer); err == nil {
-				// save original image
-				if cropOption := im.GetCropOption(IMAGE_STYLE_ORIGNAL); cropOption != nil {
-					img = imaging.Crop(img, *cropOption.Rectangle())
-				}
-
-				// Save default image
-				if err = imaging.Encode(&buffer, img, *format); err != nil {
-					return errors.Wrap(err, "ecletus/media/oss.imageHandler#Handle: gif encode all")
-				}
-				if err = im.Store(im.URL(IMAGE_STYLE_ORIGNAL), &buffer); err != nil {
-					return errors.Wrap(err, "ecletus/media/oss.imageHandler#Handle: store")
-				}
-
-				// save sizes image
-				for key, size := range im.GetSizes() {
-					if key == IMAGE_STYLE_ORIGNAL {
-						continue
-					}
-					newImage := img
-					if cropOption := im.GetCropOption(key); cropOption != nil {
-						newImage = imaging.Crop(newImage, *cropOption.Rectangle())
-					}
-
-					dst := imaging.Thumbnail(newImage, size.Width, size.Height, imaging.Lanczos)
-					var buffer bytes.Buffer
-					if err = imaging.Encode(&buffer, dst, *format); err != nil {
-						return errors.Wrap(err, "ecletus/media/oss.imageHandler#Handle: imaging encode all")
-					}
-					if err = im.Store(im.URL(key), &buffer); err != nil {
-						return errors.Wrap(err, "ecletus/media/oss.imageHandler#Handle: store")
-					}
-				}
-			} else {
-				return err
-			}
-		}
-	}
+func (h imageHandler) Handle(m media.Media, file multipart.File, option *media.Option) (err error) {
+	return h.HandleContext(context.Background(), m, file, option)
+}
 
-	return err
+func (imageHandler) HandleContext(ctx context.Context, m media.Media, file multipart.File, option *media.Option) (err error) {
+	_, err = cropField(ctx, m.(ImageInterface), file)
+	return
 }
 
 func init() {
-	media.RegisterMediaHandler("image_handler", imageHandler{})
+	media.RegisterMediaHandler(IMAGE_HANDLER, imageHandler{})
 }
@@ -3,12 +3,14 @@ package oss
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"hash/fnv"
 	"image"
 	"mime/multipart"
 	"os"
+	"strconv"
 	"strings"
 
-	"github.com/ecletus/media/reader_provider"
+	"github.com/disintegration/imaging"
 
 	"github.com/moisespsena-go/aorm"
 
@@ -21,6 +23,7 @@ import (
 
 	"github.com/ecletus/admin"
 	"github.com/ecletus/media"
+	"github.com/ecletus/media/metadata"
 )
 
 func init() {
@@ -48,6 +51,8 @@ type ImageInterface interface {
 	GetOriginalSize() *Size
 	OriginalSizeDefined() bool
 	Cropable() bool
+	GetProcessingStatus() ProcessingStatus
+	SetProcessingStatus(status ProcessingStatus)
 }
 
 type Image struct {
@@ -57,7 +62,110 @@ type Image struct {
 	cropped      bool
 	Sizes        map[string]*Size `json:",omitempty"`
 	OriginalSize Size
-	notSqlScan   bool
+	// Metadata is the normalized EXIF, IPTC and XMP metadata of original
+	Metadata *metadata.Metadata `json:",omitempty"`
+	// FocalPoint is the center of crops of styles without crop option
+	FocalPoint *FocalPoint `json:",omitempty"`
+	// BlurHash is the BlurHash placeholder of original
+	BlurHash string `json:",omitempty"`
+	// Preview is the tiny preview data URI of original
+	Preview string `json:",omitempty"`
+	// Palette is the palette of original, the first swatch is the dominant color
+	Palette []Swatch `json:",omitempty"`
+	// ProcessingStatus is the status of the asynchronous style generation
+	ProcessingStatus ProcessingStatus `json:",omitempty"`
+	// SourceURL is the url of downloaded image, see `ImageOrLink.DownloadImageLink`
+	SourceURL  string `json:",omitempty"`
+	notSqlScan bool
+	// sizesErr is the sizes error found by ValidateSizes
+	sizesErr error
+}
+
+func (img *Image) GetProcessingStatus() ProcessingStatus {
+	return img.ProcessingStatus
+}
+
+func (img *Image) SetProcessingStatus(status ProcessingStatus) {
+	img.ProcessingStatus = status
+}
+
+// StylesReady return if the styles was generated
+func (img Image) StylesReady() bool {
+	return img.ProcessingStatus == "" || img.ProcessingStatus == PROCESSING_DONE
+}
+
+func (img Image) readyStyles(styles []string) []string {
+	if len(styles) > 0 && styles[0] != "" && styles[0] != IMAGE_STYLE_ORIGNAL && !img.StylesReady() {
+		// fallback to original until the styles are ready
+		return nil
+	}
+	return styles
+}
+
+// styleVariant return the key of style crop option, size and focal point
+func styleVariant(crop *CropOption, size *Size, focalPoint *FocalPoint) string {
+	data, _ := json.Marshal(struct {
+		Crop       *CropOption
+		Size       *Size
+		FocalPoint *FocalPoint
+	}{crop, size, focalPoint})
+	h := fnv.New32a()
+	h.Write(data)
+	return strconv.FormatUint(uint64(h.Sum32()), 36)
+}
+
+// storedStyles return styles with the name of stored style. The styles of content addressed images are
+// suffixed by the `styleVariant`, so the records sharing the content has its own styles.
+func (img Image) storedStyles(styles []string) []string {
+	if len(styles) == 0 || styles[0] == "" || !img.ContentAddressed() {
+		return styles
+	}
+	variant := styleVariant(img.GetCropOption(styles[0]), img.GetSizes()[styles[0]], img.FocalPoint)
+	return append([]string{styles[0] + "-" + variant}, styles[1:]...)
+}
+
+// StorageURL return the url of stored style, with the extension of style format, even if the styles are pending
+func (img Image) StorageURL(style string) string {
+	return img.withStyleExt(img.OSS.URL(img.storedStyles([]string{style})...), style)
+}
+
+// URL return the url of style, with the extension of style format, or of original file if the styles are not
+// ready, like `FullURL`
+func (img Image) URL(styles ...string) string {
+	if styles = img.readyStyles(styles); len(styles) == 0 {
+		return img.OSS.URL()
+	}
+	return img.StorageURL(styles[0])
+}
+
+// FullURL return the full url of style, or of original file if the styles are not ready
+func (img Image) FullURL(ctx *core.Context, styles ...string) string {
+	styles = img.readyStyles(styles)
+	url := img.OSS.FullURL(ctx, img.storedStyles(styles)...)
+	if len(styles) > 0 {
+		url = img.withStyleExt(url, styles[0])
+	}
+	return url
+}
+
+// FullURLU is like `FullURL`, but with cache buster
+func (img Image) FullURLU(ctx *core.Context, styles ...string) string {
+	if img.IsZero() {
+		return ""
+	}
+	return img.FullURL(ctx, styles...) + "?_=" + img.CacheBuster()
+}
+
+// CacheBuster return a token that changes when the stored file or its crop options changes
+func (img Image) CacheBuster() string {
+	if len(img.CropOptions) == 0 {
+		return img.OSS.CacheBuster()
+	}
+	crop, _ := json.Marshal(img.CropOptions)
+	h := fnv.New64a()
+	h.Write([]byte(img.OSS.CacheBuster()))
+	h.Write(crop)
+	return strconv.FormatUint(h.Sum64(), 36)
 }
 
 func (img *Image) GetOriginalSize() *Size {
@@ -108,12 +216,23 @@ func (img Image) GetSizes() map[string]*Size {
 		IMAGE_STYLE_PREVIEW: {Width: 200, Height: 200},
 	}
 
+	if IsGIFStaticPreview(&img) {
+		if format, err := img.GetFileType().ImageFormat(); err == nil && *format == imaging.GIF {
+			sizes[IMAGE_STYLE_PREVIEW].Format = "png"
+		}
+	}
+
 	if img.Sizes != nil {
 		for key, value := range img.Sizes {
 			sizes[key] = value
 		}
 	}
 
+	// the sizes of field tag overrides the stored sizes
+	for key, value := range img.tagSizes() {
+		sizes[key] = value
+	}
+
 	return sizes
 }
 
@@ -145,7 +264,13 @@ func (img *Image) Scan(data interface{}) (err error) {
 
 func (img *Image) ContextScan(ctx *core.Context, data interface{}) (err error) {
 	img.notSqlScan = true
-	return img.Set(media.NewContext(img), data)
+	return media.TranslateError(ctx, img.Set(media.NewContext(img), data))
+}
+
+// IsFormScan return if img is scanned from a form by ContextScan, so the values computed from the stored image
+// are ignored
+func (img Image) IsFormScan() bool {
+	return img.notSqlScan
 }
 
 func (img *Image) Set(ctx *media.Context, data interface{}) (err error) {
@@ -154,6 +279,12 @@ func (img *Image) Set(ctx *media.Context, data interface{}) (err error) {
 			if err == nil && img.isNew {
 				// reset original size
 				img.OriginalSize = Size{}
+				img.Metadata = nil
+				img.FocalPoint = nil
+				img.BlurHash, img.Preview = "", ""
+				img.Palette = nil
+				img.ProcessingStatus = ""
+				img.SourceURL = ""
 				if img.Sizes != nil {
 					img.Sizes = nil
 				}
@@ -177,10 +308,17 @@ func (img *Image) ScanBytes(ctx *media.Context, data []byte) (err error) {
 
 	if img.HasFile() && !img.Delete && img.Cropable() {
 		var imgData struct {
-			CropOptions  map[string]*CropOption
-			Crop         bool
-			Sizes        map[string]*Size
-			OriginalSize *Size
+			CropOptions      map[string]*CropOption
+			Crop             bool
+			Sizes            map[string]*Size
+			OriginalSize     *Size
+			Metadata         *metadata.Metadata
+			FocalPoint       *FocalPoint
+			BlurHash         string
+			Preview          string
+			Palette          []Swatch
+			ProcessingStatus ProcessingStatus
+			SourceURL        string
 		}
 
 		if err = json.Unmarshal(data, &imgData); err == nil {
@@ -205,6 +343,35 @@ func (img *Image) ScanBytes(ctx *media.Context, data []byte) (err error) {
 			if imgData.OriginalSize != nil {
 				img.OriginalSize = *imgData.OriginalSize
 			}
+
+			// the metadata is extracted from the stored image, never accepted from forms
+			if imgData.Metadata != nil && !img.notSqlScan {
+				img.Metadata = imgData.Metadata
+			}
+
+			if imgData.FocalPoint != nil {
+				img.FocalPoint = imgData.FocalPoint
+			}
+
+			// the placeholders are computed from the stored image, never accepted from forms
+			if imgData.BlurHash != "" && !img.notSqlScan {
+				img.BlurHash, img.Preview = imgData.BlurHash, imgData.Preview
+			}
+
+			// the palette is extracted from the stored image, never accepted from forms
+			if imgData.Palette != nil && !img.notSqlScan {
+				img.Palette = imgData.Palette
+			}
+
+			// the processing status is set by the style generation, never accepted from forms
+			if imgData.ProcessingStatus != "" && !img.notSqlScan {
+				img.ProcessingStatus = imgData.ProcessingStatus
+			}
+
+			// the source url is set by the download, never accepted from forms
+			if imgData.SourceURL != "" && !img.notSqlScan {
+				img.SourceURL = imgData.SourceURL
+			}
 		}
 	}
 	return
@@ -223,11 +390,23 @@ func (img *Image) MediaScan(ctx *media.Context, data interface{}) (err error) {
 		img.OriginalSize = Size{}
 		img.Sizes = nil
 		img.CropOptions = nil
+		img.Metadata = nil
+		img.FocalPoint = nil
+		img.BlurHash, img.Preview = "", ""
+		img.Palette = nil
+		img.ProcessingStatus = ""
+		img.SourceURL = ""
 		return img.OSS.MediaScan(ctx, data)
 	case *multipart.FileHeader:
 		img.OriginalSize = Size{}
 		img.Sizes = nil
 		img.CropOptions = nil
+		img.Metadata = nil
+		img.FocalPoint = nil
+		img.BlurHash, img.Preview = "", ""
+		img.Palette = nil
+		img.ProcessingStatus = ""
+		img.SourceURL = ""
 		return img.OSS.MediaScan(ctx, data)
 	case []*multipart.FileHeader:
 		if len(values) > 0 {
@@ -246,6 +425,8 @@ func (img *Image) ConfigureQorMetaBeforeInitialize(meta resource.Metaor) {
 func (img *Image) Init(site *core.Site, field *aorm.Field) {
 	img.OSS.Init(site, field)
 	img.GetOrSetFieldOption().ParseFieldTag("image", &field.Tag)
+	img.ValidateURLTemplate(img)
+	img.ValidateSizes()
 }
 
 func (Image) MaxSize() uint64 {
@@ -253,11 +434,11 @@ func (Image) MaxSize() uint64 {
 }
 
 func (Image) FileTypes() []string {
-	return []string{"image/jpeg", "image/png"}
+	return []string{"image/jpeg", "image/png", "image/gif", "image/webp", "image/tiff", "image/bmp"}
 }
 
 func (Image) FileExts() []string {
-	return []string{"jpg", "png"}
+	return []string{"jpg", "jpeg", "png", "gif", "webp", "tif", "tiff", "bmp"}
 }
 
 func ImageMetaOnDefaultValue(meta *admin.Meta, cb func(e *admin.MetaValuerEvent)) {
@@ -345,6 +526,23 @@ func ImageMetaURL(meta *admin.Meta, key, defaultStyle string) *admin.Meta {
 type Size struct {
 	Width  int
 	Height int
+	// Format is the output format of style: jpeg, png, gif, tiff or bmp. Defaults to the format of original.
+	Format string `json:",omitempty"`
+	// Quality is the JPEG quality, from 1 to 100
+	Quality int `json:",omitempty"`
+	// Compression is the PNG compression level: default, none, speed or best
+	Compression string `json:",omitempty"`
+	// Fit is the resize mode: cover (default), contain, fill, pad, width or height
+	Fit string `json:",omitempty"`
+	// Anchor is the gravity of cover crop and pad: center (default), top, bottom, left, right,
+	// top_left, top_right, bottom_left or bottom_right
+	Anchor string `json:",omitempty"`
+	// Background is the pad color, like "#fff". Defaults to white for JPEG, and transparent for other formats.
+	Background string `json:",omitempty"`
+	// NoUpscale never enlarges the image
+	NoUpscale bool `json:",omitempty"`
+	// Watermark is the name of registered watermark drawn over the style. The original is never watermarked.
+	Watermark string `json:",omitempty"`
 }
 
 // CropOption includes crop options
@@ -364,6 +562,8 @@ type MediaType string
 const (
 	MEDIA_IMAGE_FILE MediaType = "image_file"
 	MEDIA_IMAGE_LINK MediaType = "image_link"
+	// MEDIA_IMAGE_REMOTE is the image link downloaded into the image file on save, instead of hot-linked
+	MEDIA_IMAGE_REMOTE MediaType = "image_remote"
 )
 
 type ImageWithLink struct {
@@ -391,7 +591,3 @@ func (i *ImageOrLink) IsImageLink(has ...bool) bool {
 func (i *ImageOrLink) HasImageFile() bool {
 	return !i.ImageFile.IsZero()
 }
-
-func (i *ImageOrLink) ImageURLProvider() reader_provider.MediaReaderProvider {
-	panic("not implemented")
-}
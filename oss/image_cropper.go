@@ -2,24 +2,28 @@ package oss
 
 import (
 	"bytes"
+	"context"
 	"image"
-	"image/draw"
 	"image/gif"
 	"io"
 
-	"github.com/ecletus/media"
+	"github.com/ecletus/media/metadata"
 	"github.com/moisespsena-go/error-wrap"
 
 	"github.com/disintegration/imaging"
 )
 
 type ImageCropper struct {
-	file    io.ReadSeeker
-	Image   ImageInterface
-	Img     image.Image
-	Format  imaging.Format
-	gif     *gif.GIF
-	handler func(options map[string]*CropperOption, cb func(key string, f *bytes.Buffer) error) error
+	ctx    context.Context
+	file   io.ReadSeeker
+	Image  ImageInterface
+	Img    image.Image
+	Format imaging.Format
+	// Orientation is the EXIF orientation applied to Img
+	Orientation int
+	gif         *gif.GIF
+	coalesced   []*image.NRGBA
+	handler     func(options map[string]*CropperOption, cb func(key string, f *bytes.Buffer) error) error
 }
 
 type CropperOption struct {
@@ -28,11 +32,19 @@ type CropperOption struct {
 }
 
 func NewImageCropper(img ImageInterface, file io.ReadSeeker) (cropper *ImageCropper, err error) {
+	return NewImageCropperContext(context.Background(), img, file)
+}
+
+// NewImageCropperContext creates a cropper that stops processing when ctx is done
+func NewImageCropperContext(ctx context.Context, img ImageInterface, file io.ReadSeeker) (cropper *ImageCropper, err error) {
 	var format *imaging.Format
-	if format, err = media.GetImageFormat(img.URL()); err != nil {
+	if format, err = img.GetFileType().ImageFormat(); err != nil {
+		return
+	}
+	if err = ctx.Err(); err != nil {
 		return
 	}
-	cropper = &ImageCropper{file, img, nil, *format, nil, nil}
+	cropper = &ImageCropper{ctx: ctx, file: file, Image: img, Format: *format}
 	if *format == imaging.GIF {
 		if cropper.gif, err = gif.DecodeAll(file); err != nil {
 			return nil, errwrap.Wrap(err, "GIF Decode")
@@ -41,13 +53,55 @@ func NewImageCropper(img ImageInterface, file io.ReadSeeker) (cropper *ImageCrop
 		return
 	}
 	cropper.handler = cropper.defaultHandler
+	if md, _ := metadata.Parse(file); md != nil {
+		cropper.Orientation = md.Orientation
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return
+	}
 	if cropper.Img, err = imaging.Decode(file); err != nil {
 		return nil, errwrap.Wrap(err, "Decode")
 	}
-
+	cropper.Img = Orient(cropper.Img, cropper.Orientation)
 	return
 }
 
+// Reencodable return if the original is encoded again in its own format
+func (cropper *ImageCropper) Reencodable() bool {
+	return cropper.Image.GetFileType().ImageReencodable()
+}
+
+// Oriented return if the decoded image was rotated or flipped by the EXIF orientation
+func (cropper *ImageCropper) Oriented() bool {
+	return cropper.Img != nil && cropper.Orientation > 1
+}
+
+// Orient rotates or flips img to the normal orientation
+func Orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	}
+	return img
+}
+
+// Encode encodes the decoded image
+func (cropper *ImageCropper) Encode(w io.Writer) error {
+	return imaging.Encode(w, cropper.Img, cropper.Format)
+}
+
 func (cropper *ImageCropper) Width() (w int) {
 	if cropper.gif != nil {
 		return cropper.gif.Config.Width
@@ -62,27 +116,40 @@ func (cropper *ImageCropper) Height() (w int) {
 	return cropper.Img.Bounds().Max.Y
 }
 
+// firstFrame return the decoded image, or the first coalesced frame of GIF
+func (cropper *ImageCropper) firstFrame() image.Image {
+	if cropper.gif != nil {
+		return cropper.frames()[0]
+	}
+	return cropper.Img
+}
+
 func (cropper *ImageCropper) Size() (w int, h int) {
 	return cropper.Width(), cropper.Height()
 }
 
 func (cropper *ImageCropper) defaultHandler(options map[string]*CropperOption, cb func(key string, f *bytes.Buffer) error) (err error) {
-	w, h := cropper.Size()
 	for key, opt := range options {
+		if err = cropper.ctx.Err(); err != nil {
+			return
+		}
 		img := cropper.Img
-		var (
-			crop   = opt.Crop != nil
-			resize = opt.Size != nil && !(opt.Size.Width == w && opt.Size.Width == h)
-		)
+		var crop = opt.Crop != nil
 		if crop {
 			img = imaging.Crop(img, *opt.Crop.Rectangle())
 		}
+		var resize = opt.Size != nil && opt.Size.Changes(img.Bounds().Dx(), img.Bounds().Dy())
 		if resize {
-			img = imaging.Thumbnail(img, opt.Size.Width, opt.Size.Height, imaging.Lanczos)
+			if img, err = cropper.resize(key, img, opt.Size); err != nil {
+				return
+			}
+		}
+		if img, err = cropper.watermark(key, img, opt.Size); err != nil {
+			return
 		}
-		if crop || resize {
+		if crop || resize || opt.Size.Converts() {
 			var buffer bytes.Buffer
-			if err = imaging.Encode(&buffer, img, cropper.Format); err != nil {
+			if err = cropper.encode(&buffer, key, img, opt.Size); err != nil {
 				return errwrap.Wrap(err, "Encode %q", key)
 			}
 			if err = cb(key, &buffer); err != nil {
@@ -93,39 +160,76 @@ func (cropper *ImageCropper) defaultHandler(options map[string]*CropperOption, c
 	return
 }
 
-func (cropper *ImageCropper) newGif() *gif.GIF {
-	g := *cropper.gif
-	g.Image = cropper.gif.Image[:]
-	return &g
+// resize resizes img of style key by the fit mode of size
+func (cropper *ImageCropper) resize(key string, img image.Image, size *Size) (image.Image, error) {
+	format, err := size.OutputFormat(cropper.Format)
+	if err != nil || key == IMAGE_STYLE_ORIGNAL {
+		format = cropper.Format
+	}
+	if img, err = size.Resize(img, format); err != nil {
+		return nil, errwrap.Wrap(err, "Resize %q", key)
+	}
+	return img, nil
+}
+
+// encode encodes img of style key with the output format and the encoder options of size.
+// The original keeps its format.
+func (cropper *ImageCropper) encode(w io.Writer, key string, img image.Image, size *Size) (err error) {
+	var (
+		format  = cropper.Format
+		options []imaging.EncodeOption
+	)
+	if key != IMAGE_STYLE_ORIGNAL {
+		if format, err = size.OutputFormat(cropper.Format); err != nil {
+			return
+		}
+	}
+	if options, err = size.EncodeOptions(); err != nil {
+		return
+	}
+	return imaging.Encode(w, img, format, options...)
 }
 
+// gifHandler transforms the coalesced frames, keeping the frame delays, disposals and loop count.
+// The frames are quantized again, the resampling creates colors out of the original palettes.
 func (cropper *ImageCropper) gifHandler(options map[string]*CropperOption, cb func(key string, f *bytes.Buffer) error) (err error) {
 	for key, cropOption := range options {
-		g := cropper.newGif()
-		rectangle := image.Rect(0, 0, g.Config.Width, g.Config.Height)
-		if cropOption.Crop != nil {
-			rectangle = *cropOption.Crop.Rectangle()
+		if format, err := cropOption.Size.OutputFormat(imaging.GIF); err != nil {
+			return errwrap.Wrap(err, "Style %q", key)
+		} else if format != imaging.GIF && key != IMAGE_STYLE_ORIGNAL {
+			// other formats are encoded from the first frame
+			if err = cropper.gifFrameStyle(key, cropOption, cb); err != nil {
+				return err
+			}
+			continue
 		}
-		if cropOption.Size != nil {
-			rectangle = image.Rect(0, 0, cropOption.Size.Width, cropOption.Size.Height)
+		g := &gif.GIF{
+			Delay:     cropper.gif.Delay,
+			Disposal:  cropper.gif.Disposal,
+			LoopCount: cropper.gif.LoopCount,
 		}
-
-		for i := range g.Image {
-			var img image.Image
-			img = g.Image[i]
+		for _, frame := range cropper.frames() {
+			if err = cropper.ctx.Err(); err != nil {
+				return
+			}
+			var img image.Image = frame
 			if cropOption.Crop != nil {
 				img = imaging.Crop(img, *cropOption.Crop.Rectangle())
 			}
 			if cropOption.Size != nil {
-				img = imaging.Thumbnail(img, cropOption.Size.Width, cropOption.Size.Height, imaging.Lanczos)
+				if img, err = cropper.resize(key, img, cropOption.Size); err != nil {
+					return
+				}
+			}
+			if img, err = cropper.watermark(key, img, cropOption.Size); err != nil {
+				return
 			}
-			g.Image[i] = image.NewPaletted(rectangle, g.Image[i].Palette)
-			draw.Draw(g.Image[i], rectangle, img, image.Pt(0, 0), draw.Src)
+			g.Image = append(g.Image, Quantize(img, 256))
 		}
 
 		var result bytes.Buffer
-		g.Config.Width = rectangle.Max.X
-		g.Config.Height = rectangle.Max.Y
+		bounds := g.Image[0].Bounds()
+		g.Config = image.Config{Width: bounds.Dx(), Height: bounds.Dy()}
 		if err = gif.EncodeAll(&result, g); err != nil {
 			return errwrap.Wrap(err, "GIF EncodeAll %q", key)
 		}
@@ -136,6 +240,29 @@ func (cropper *ImageCropper) gifHandler(options map[string]*CropperOption, cb fu
 	return
 }
 
+func (cropper *ImageCropper) gifFrameStyle(key string, opt *CropperOption, cb func(key string, f *bytes.Buffer) error) (err error) {
+	var img image.Image = cropper.frames()[0]
+	if opt.Crop != nil {
+		img = imaging.Crop(img, *opt.Crop.Rectangle())
+	}
+	if opt.Size != nil {
+		if img, err = cropper.resize(key, img, opt.Size); err != nil {
+			return
+		}
+	}
+	if img, err = cropper.watermark(key, img, opt.Size); err != nil {
+		return
+	}
+	var buffer bytes.Buffer
+	if err = cropper.encode(&buffer, key, img, opt.Size); err != nil {
+		return errwrap.Wrap(err, "Encode %q", key)
+	}
+	if err = cb(key, &buffer); err != nil {
+		return errwrap.Wrap(err, "Callback of %q", key)
+	}
+	return
+}
+
 func (cropper *ImageCropper) Crop(options map[string]*CropperOption, cb func(key string, f *bytes.Buffer) error) (err error) {
 	return cropper.handler(options, cb)
 }
@@ -148,6 +275,9 @@ func (cropper *ImageCropper) CropNames(cb func(key string, f *bytes.Buffer) erro
 			Crop: cropper.Image.GetCropOption(name),
 			Size: sizes[name],
 		}
+		if opt.Crop == nil && name != IMAGE_STYLE_ORIGNAL {
+			opt.Crop = cropper.autoCrop(opt.Size, cropper.firstFrame())
+		}
 		if opt.Crop != nil || opt.Size != nil {
 			options[name] = opt
 		}
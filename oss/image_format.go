@@ -0,0 +1,90 @@
+package oss
+
+import (
+	"fmt"
+	"image/png"
+	"path"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/ecletus/media"
+)
+
+var pngCompressionLevels = map[string]png.CompressionLevel{
+	"":        png.DefaultCompression,
+	"default": png.DefaultCompression,
+	"none":    png.NoCompression,
+	"speed":   png.BestSpeed,
+	"best":    png.BestCompression,
+}
+
+// OutputFormat return the format of style encoded from image of format original
+func (size *Size) OutputFormat(original imaging.Format) (imaging.Format, error) {
+	if size == nil || size.Format == "" {
+		return original, nil
+	}
+	name := strings.ToLower(strings.TrimPrefix(size.Format, "."))
+	if name != "webp" {
+		if format, err := media.GetImageFormat("." + name); err == nil {
+			return *format, nil
+		}
+	}
+	return original, fmt.Errorf("unsupported style format %q", size.Format)
+}
+
+// EncodeOptions return the encoder options of style
+func (size *Size) EncodeOptions() (options []imaging.EncodeOption, err error) {
+	if size == nil {
+		return
+	}
+	if size.Quality != 0 {
+		if size.Quality < 1 || size.Quality > 100 {
+			return nil, fmt.Errorf("invalid JPEG quality %d", size.Quality)
+		}
+		options = append(options, imaging.JPEGQuality(size.Quality))
+	}
+	level, ok := pngCompressionLevels[strings.ToLower(size.Compression)]
+	if !ok {
+		return nil, fmt.Errorf("invalid PNG compression %q", size.Compression)
+	}
+	if level != png.DefaultCompression {
+		options = append(options, imaging.PNGCompressionLevel(level))
+	}
+	return
+}
+
+// Converts return if the style must be encoded even if not cropped or resized
+func (size *Size) Converts() bool {
+	return size != nil && (size.Format != "" || size.Quality != 0 || size.Compression != "" || size.Watermark != "")
+}
+
+// StyleFormat return the output format of style
+func (img Image) StyleFormat(style string) (imaging.Format, error) {
+	if style == IMAGE_STYLE_PREVIEW && img.IsSVG() && IsSVGPreview(&img) {
+		return imaging.PNG, nil
+	}
+	original, err := img.GetFileType().ImageFormat()
+	if err != nil {
+		return 0, err
+	}
+	if style == "" || style == IMAGE_STYLE_ORIGNAL {
+		return *original, nil
+	}
+	return img.GetSizes()[style].OutputFormat(*original)
+}
+
+// withStyleExt replaces the extension of style url by the extension of style format
+func (img Image) withStyleExt(url, style string) string {
+	if style == "" || style == IMAGE_STYLE_ORIGNAL || url == "" {
+		return url
+	}
+	format, err := img.StyleFormat(style)
+	if err != nil {
+		return url
+	}
+	ext := path.Ext(url)
+	if current, err := media.GetImageFormat(ext); err == nil && *current == format && !strings.EqualFold(ext, ".webp") {
+		return url
+	}
+	return strings.TrimSuffix(url, ext) + "." + media.ImageFormatExt(format)
+}
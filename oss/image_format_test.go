@@ -0,0 +1,59 @@
+package oss
+
+import (
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/ecletus/media"
+)
+
+func TestSizeOutputFormat(t *testing.T) {
+	cases := []struct {
+		size   *Size
+		format imaging.Format
+		err    bool
+	}{
+		{nil, imaging.GIF, false},
+		{&Size{}, imaging.GIF, false},
+		{&Size{Format: "jpg"}, imaging.JPEG, false},
+		{&Size{Format: ".PNG"}, imaging.PNG, false},
+		{&Size{Format: "tiff"}, imaging.TIFF, false},
+		{&Size{Format: "webp"}, imaging.GIF, true},
+		{&Size{Format: "avif"}, imaging.GIF, true},
+	}
+	for _, c := range cases {
+		format, err := c.size.OutputFormat(imaging.GIF)
+		if format != c.format || (err != nil) != c.err {
+			t.Errorf("%v.OutputFormat(GIF) == %v, %v, want %v", c.size, format, err, c.format)
+		}
+	}
+}
+
+func TestImageStyleFormat(t *testing.T) {
+	img := Image{
+		OSS: OSS{Base: media.Base{Url: "/a.webp", ContentType: "image/webp"}},
+		Sizes: map[string]*Size{
+			"thumb": {Width: 10, Height: 10},
+			"jpeg":  {Width: 10, Height: 10, Format: "jpg"},
+		},
+	}
+	cases := map[string]string{
+		"":                  "/a.webp",
+		IMAGE_STYLE_ORIGNAL: "/a.original.webp",
+		"thumb":             "/a.thumb.png",
+		"jpeg":              "/a.jpeg.jpg",
+	}
+	for style, want := range cases {
+		if got := img.URL(style); got != want {
+			t.Errorf("URL(%q) == %q, want %q", style, got, want)
+		}
+	}
+
+	img.Url, img.ContentType = "/a.png", "image/png"
+	if format, err := img.StyleFormat("jpeg"); err != nil || format != imaging.JPEG {
+		t.Errorf("StyleFormat(jpeg) == %v, %v", format, err)
+	}
+	if got, want := img.URL("thumb"), "/a.thumb.png"; got != want {
+		t.Errorf("URL(thumb) == %q, want %q", got, want)
+	}
+}
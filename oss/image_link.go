@@ -0,0 +1,154 @@
+package oss
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ecletus/media"
+	"github.com/ecletus/media/reader_provider"
+	errwrap "github.com/moisespsena-go/error-wrap"
+)
+
+var (
+	// RemoteImageMaxSize is the max size of downloaded image links
+	RemoteImageMaxSize int64 = 20 << 20
+	// RemoteImageMaxRedirects is the max number of redirects of image link downloads
+	RemoteImageMaxRedirects = 3
+	// RemoteImageTimeout is the timeout of image link downloads
+	RemoteImageTimeout = 30 * time.Second
+	// RemoteImageContentTypes are the accepted content types of image link responses
+	RemoteImageContentTypes = []string{"image/"}
+	// RemoteImageAllowPrivate allows image links of loopback and private addresses, like intranet servers.
+	// Enabling it exposes the internal services to server side request forgery.
+	RemoteImageAllowPrivate bool
+)
+
+// ImageLinkSyncer is implemented by records with image links downloaded on save, before the DB transaction
+// begins, see `ImageOrLink.SyncImageLink`. Inside an outer transaction, the download runs in that transaction.
+type ImageLinkSyncer interface {
+	SyncImageLink() (downloaded bool, err error)
+}
+
+// GetSourceURL return the url of downloaded image, blank if uploaded
+func (img Image) GetSourceURL() string {
+	return img.SourceURL
+}
+
+// IsImageRemote return if the image link is downloaded into the image file
+func (i *ImageOrLink) IsImageRemote() bool {
+	return i.HasImageLink() && i.MediaType == MEDIA_IMAGE_REMOTE
+}
+
+// ImageURLProvider return the reader provider of image link, with the SSRF safeguards: only public addresses,
+// up to `RemoteImageMaxRedirects` redirects and `RemoteImageMaxSize` bytes of `RemoteImageContentTypes`.
+// Returns nil if there is no image link.
+func (i *ImageOrLink) ImageURLProvider() reader_provider.MediaReaderProvider {
+	if !i.HasImageLink() {
+		return nil
+	}
+	name := "image"
+	if u, err := url.Parse(i.ImageLink); err == nil {
+		if base := path.Base(u.Path); base != "." && base != "/" {
+			name = base
+		}
+	}
+	return &reader_provider.Named{
+		ReaderProvider: remoteImageReaderProvider(i.ImageLink),
+		Name:           name,
+	}
+}
+
+// remoteImageReaderProvider return the reader provider of remote image url, with the SSRF safeguards
+func remoteImageReaderProvider(url string) *reader_provider.HTTPReaderProvider {
+	redirects := RemoteImageMaxRedirects
+	if redirects == 0 {
+		redirects = -1
+	}
+	return &reader_provider.HTTPReaderProvider{
+		URL:          url,
+		Timeout:      RemoteImageTimeout,
+		PublicOnly:   !RemoteImageAllowPrivate,
+		MaxRedirects: redirects,
+		MaxSize:      RemoteImageMaxSize,
+		ContentTypes: RemoteImageContentTypes,
+	}
+}
+
+// SyncImageLink downloads the image link of remote media type if it isn't the source of image file
+func (i *ImageOrLink) SyncImageLink() (downloaded bool, err error) {
+	if !i.IsImageRemote() {
+		return
+	}
+	return i.DownloadImageLink(false)
+}
+
+// DownloadImageLink sets the image file to the image of link, with the validations of uploads. The image is
+// stored and cropped on save. The link is kept as source URL of image file, and is downloaded again only if
+// changed, unless force.
+func (i *ImageOrLink) DownloadImageLink(force bool) (downloaded bool, err error) {
+	if !i.HasImageLink() {
+		return
+	}
+	if !force && i.HasImageFile() && i.ImageFile.SourceURL == i.ImageLink {
+		return
+	}
+	var (
+		provider = i.ImageURLProvider()
+		r        io.ReadCloser
+		data     []byte
+		header   *multipart.FileHeader
+	)
+	if r, err = provider.GetReader(); err != nil {
+		return false, errwrap.Wrap(err, "Download image link %q", i.ImageLink)
+	}
+	defer r.Close()
+	if data, err = ioutil.ReadAll(r); err != nil {
+		return false, errwrap.Wrap(err, "Download image link %q", i.ImageLink)
+	}
+	if header, err = newFileHeader(remoteFileName(provider.GetName(), data), data); err != nil {
+		return
+	}
+	if err = i.ImageFile.Set(media.NewContext(&i.ImageFile), header); err != nil {
+		return
+	}
+	i.ImageFile.SourceURL = i.ImageLink
+	return true, nil
+}
+
+// remoteFileName return name with the extension of data type
+func remoteFileName(name string, data []byte) string {
+	typ := media.DetectFileType(data)
+	if typ.Ext == "" || media.FileTypeFromName(name).MIME == typ.MIME {
+		return name
+	}
+	return strings.TrimSuffix(name, path.Ext(name)) + "." + typ.Ext
+}
+
+// newFileHeader return the file header of data, like uploaded by form
+func newFileHeader(name string, data []byte) (*multipart.FileHeader, error) {
+	var (
+		buf bytes.Buffer
+		w   = multipart.NewWriter(&buf)
+	)
+	part, err := w.CreateFormFile("file", name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = part.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	form, err := multipart.NewReader(&buf, w.Boundary()).ReadForm(int64(len(data)) + 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	return form.File["file"][0], nil
+}
@@ -0,0 +1,113 @@
+package oss
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ecletus/media/reader_provider"
+	"github.com/ecletus/media/video_link"
+)
+
+func TestRemoteFileName(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	for name, expected := range map[string]string{
+		"photo.png": "photo.png",
+		"photo.jpg": "photo.png",
+		"photo":     "photo.png",
+	} {
+		if got := remoteFileName(name, buf.Bytes()); got != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, got)
+		}
+	}
+}
+
+func TestNewFileHeader(t *testing.T) {
+	data := []byte("content of file")
+	header, err := newFileHeader("photo.png", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Filename != "photo.png" || header.Size != int64(len(data)) {
+		t.Errorf("unexpected header %q of %d bytes", header.Filename, header.Size)
+	}
+	f, err := header.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got, _ := ioutil.ReadAll(f); !bytes.Equal(got, data) {
+		t.Errorf("unexpected content %q", got)
+	}
+}
+
+func TestVideoLinkProvider(t *testing.T) {
+	link := "https://www.youtube.com/watch?v=dQw4w9WgXcQ"
+	iv := &ImageOrLinkOrVideoLink{
+		VideoLink: link,
+		// the cached thumbnail is untrusted
+		VideoLinkInfo: video_link.Video{Link: link, Fetched: true, ThumbnailURL: "http://10.0.0.1/admin.jpg"},
+	}
+	named, ok := iv.VideoLinkProvider().(*reader_provider.Named)
+	if !ok {
+		t.Fatalf("VideoLinkProvider() == %T", iv.VideoLinkProvider())
+	}
+	p := named.ReaderProvider.(*reader_provider.HTTPReaderProvider)
+	if p.URL != "https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg" || named.Name != "youtube-dQw4w9WgXcQ.jpg" {
+		t.Errorf("VideoLinkProvider() == %q named %q", p.URL, named.Name)
+	}
+	if p.PublicOnly != !RemoteImageAllowPrivate || p.MaxSize != RemoteImageMaxSize || len(p.ContentTypes) == 0 {
+		t.Errorf("VideoLinkProvider() without safeguards: %+v", p)
+	}
+}
+
+func TestDownloadImageLink(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 10, 10)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/photo":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(buf.Bytes())
+		case "/fake.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("not an image"))
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html></html>"))
+		}
+	}))
+	defer srv.Close()
+
+	// the test server is at loopback, blocked by default
+	i := &ImageOrLink{MediaType: MEDIA_IMAGE_REMOTE, ImageWithLink: ImageWithLink{ImageLink: srv.URL + "/photo"}}
+	if _, err := i.SyncImageLink(); err == nil {
+		t.Errorf("SyncImageLink() of private address should fail")
+	}
+	defer func(allow bool) { RemoteImageAllowPrivate = allow }(RemoteImageAllowPrivate)
+	RemoteImageAllowPrivate = true
+
+	downloaded, err := i.SyncImageLink()
+	if err != nil || !downloaded {
+		t.Fatalf("SyncImageLink() == %v, %v", downloaded, err)
+	}
+	if i.ImageFile.SourceURL != i.ImageLink || i.ImageFile.GetFileName() != "photo.png" || i.ImageFile.FileSize != int64(buf.Len()) {
+		t.Errorf("image file == %q of %d bytes from %q", i.ImageFile.GetFileName(), i.ImageFile.FileSize, i.ImageFile.SourceURL)
+	}
+	// the source isn't downloaded again
+	if downloaded, err = i.SyncImageLink(); err != nil || downloaded {
+		t.Errorf("SyncImageLink() of same link == %v, %v", downloaded, err)
+	}
+
+	for _, link := range []string{srv.URL + "/page", srv.URL + "/fake.png"} {
+		i := &ImageOrLink{MediaType: MEDIA_IMAGE_REMOTE, ImageWithLink: ImageWithLink{ImageLink: link}}
+		if _, err := i.DownloadImageLink(false); err == nil || i.ImageFile.SourceURL != "" {
+			t.Errorf("DownloadImageLink(%q) == %v, source %q", link, err, i.ImageFile.SourceURL)
+		}
+	}
+}
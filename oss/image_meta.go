@@ -28,6 +28,9 @@ func (this *ImageMeta) DefaultURL(ctx *core.Context, record interface{}, value *
 		}
 		return value.FullURL(ctx, IMAGE_STYLE_PREVIEW)
 	} else if value.IsSVG() {
+		if IsSVGPreview(value) {
+			return value.FullURL(ctx, IMAGE_STYLE_PREVIEW)
+		}
 		return value.FullURL(ctx)
 	}
 	return ""
@@ -1,7 +1,12 @@
 package oss
 
 import (
+	"net/url"
+	"path"
+	"strings"
+
 	"github.com/ecletus/media/reader_provider"
+	"github.com/ecletus/media/video_link"
 )
 
 type ImageOrVideoType string
@@ -14,10 +19,55 @@ const (
 type ImageOrLinkOrVideoLink struct {
 	ImageOrLink
 	VideoLink string
+	// VideoLinkInfo is the video of VideoLink with its oEmbed metadata, cached by `ResolveVideoLink`
+	VideoLinkInfo video_link.Video `sql:"type:text"`
+}
+
+// ResolveVideoLink return the video of video link with its oEmbed metadata. The metadata is fetched only if the
+// video link changed. Returns nil if there is no video link.
+func (iv *ImageOrLinkOrVideoLink) ResolveVideoLink() (*video_link.Video, error) {
+	if !iv.HasVideoLink() {
+		iv.VideoLinkInfo = video_link.Video{}
+		return nil, nil
+	}
+	video, err := video_link.Refresh(&iv.VideoLinkInfo, iv.VideoLink)
+	if err != nil {
+		return nil, err
+	}
+	iv.VideoLinkInfo = *video
+	return &iv.VideoLinkInfo, nil
 }
 
+// VideoLinkProvider return the reader provider of thumbnail of video link, named as "PROVIDER-ID.EXT", with the
+// safeguards of `ImageURLProvider`. The cached VideoLinkInfo is untrusted: the thumbnail is the default of
+// provider, or fetched by oEmbed. Returns nil if the video link is unknown or has no thumbnail.
 func (iv *ImageOrLinkOrVideoLink) VideoLinkProvider() reader_provider.MediaReaderProvider {
-	panic("not implemented")
+	if !iv.HasVideoLink() {
+		return nil
+	}
+	video, err := video_link.Parse(iv.VideoLink)
+	if err == nil && video.ThumbnailURL == "" {
+		video, err = video_link.Fetch(iv.VideoLink)
+	}
+	if err != nil || video.ThumbnailURL == "" {
+		return nil
+	}
+	var (
+		ext  = ".jpg"
+		name = video.Provider
+	)
+	if u, err := url.Parse(video.ThumbnailURL); err == nil {
+		if e := path.Ext(u.Path); len(e) > 1 && len(e) <= 5 {
+			ext = strings.ToLower(e)
+		}
+	}
+	if video.ID != "" {
+		name += "-" + video.ID
+	}
+	return &reader_provider.Named{
+		ReaderProvider: remoteImageReaderProvider(video.ThumbnailURL),
+		Name:           name + ext,
+	}
 }
 
 func (iv *ImageOrLinkOrVideoLink) IsVideoLink(has ...bool) bool {
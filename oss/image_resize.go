@@ -0,0 +1,377 @@
+package oss
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/moisespsena-go/error-wrap"
+)
+
+// OPT_SIZE is the prefix of styles declared by tag: `image:"size.thumb:200x200 fit=pad background=#fff"`
+const OPT_SIZE = "image.size"
+
+// Fit modes of `Size.Fit`
+const (
+	// FIT_COVER resizes and crops to fill the size. It is the default.
+	FIT_COVER = "cover"
+	// FIT_CONTAIN resizes to fit inside the size, keeping the aspect ratio
+	FIT_CONTAIN = "contain"
+	// FIT_FILL stretches to the size
+	FIT_FILL = "fill"
+	// FIT_PAD is like FIT_CONTAIN, filling the remaining area with the background color
+	FIT_PAD = "pad"
+	// FIT_WIDTH resizes to the width, keeping the aspect ratio
+	FIT_WIDTH = "width"
+	// FIT_HEIGHT resizes to the height, keeping the aspect ratio
+	FIT_HEIGHT = "height"
+)
+
+var fitAliases = map[string]string{
+	"":        FIT_COVER,
+	"crop":    FIT_COVER,
+	"fit":     FIT_CONTAIN,
+	"stretch": FIT_FILL,
+}
+
+var anchors = map[string]imaging.Anchor{
+	"":             imaging.Center,
+	"center":       imaging.Center,
+	"top":          imaging.Top,
+	"bottom":       imaging.Bottom,
+	"left":         imaging.Left,
+	"right":        imaging.Right,
+	"top_left":     imaging.TopLeft,
+	"top_right":    imaging.TopRight,
+	"bottom_left":  imaging.BottomLeft,
+	"bottom_right": imaging.BottomRight,
+}
+
+// GetFit return the normalized fit mode
+func (size *Size) GetFit() string {
+	fit := strings.ToLower(size.Fit)
+	if alias, ok := fitAliases[fit]; ok {
+		return alias
+	}
+	return fit
+}
+
+// Validate checks the fit mode, anchor and background
+func (size *Size) Validate() error {
+	switch size.GetFit() {
+	case FIT_COVER, FIT_CONTAIN, FIT_FILL, FIT_PAD, FIT_WIDTH, FIT_HEIGHT:
+	default:
+		return fmt.Errorf("invalid fit mode %q", size.Fit)
+	}
+	if _, ok := anchors[strings.ToLower(size.Anchor)]; !ok {
+		return fmt.Errorf("invalid anchor %q", size.Anchor)
+	}
+	if size.Background != "" {
+		if _, err := ParseColor(size.Background); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scale(v int, k float64) int {
+	if r := int(math.Round(float64(v) * k)); r > 0 {
+		return r
+	}
+	return 1
+}
+
+// containSize return the size of source inside of box, keeping the aspect ratio
+func (size *Size) containSize(width, height, boxWidth, boxHeight int) (int, int) {
+	k := math.Min(float64(boxWidth)/float64(width), float64(boxHeight)/float64(height))
+	if size.NoUpscale && k > 1 {
+		k = 1
+	}
+	return scale(width, k), scale(height, k)
+}
+
+// OutputSize return the size of style image resized from image of width and height
+func (size *Size) OutputSize(width, height int) (w, h int) {
+	if width <= 0 || height <= 0 {
+		return size.Width, size.Height
+	}
+	var fit = size.GetFit()
+	w, h = size.Width, size.Height
+	switch fit {
+	case FIT_WIDTH:
+		h = 0
+	case FIT_HEIGHT:
+		w = 0
+	}
+	switch {
+	case w <= 0 && h <= 0:
+		return width, height
+	case w <= 0:
+		w, fit = scale(width, float64(h)/float64(height)), FIT_HEIGHT
+	case h <= 0:
+		h, fit = scale(height, float64(w)/float64(width)), FIT_WIDTH
+	}
+
+	switch fit {
+	case FIT_COVER:
+		if size.NoUpscale && (w > width || h > height) {
+			// the biggest box of same aspect ratio inside of source
+			k := math.Min(float64(width)/float64(w), float64(height)/float64(h))
+			w, h = scale(w, k), scale(h, k)
+		}
+	case FIT_CONTAIN:
+		w, h = size.containSize(width, height, w, h)
+	case FIT_FILL:
+		if size.NoUpscale {
+			w, h = minInt(w, width), minInt(h, height)
+		}
+	case FIT_WIDTH, FIT_HEIGHT:
+		if size.NoUpscale && w > width {
+			w, h = width, height
+		}
+	}
+	return
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Changes return if the image of width and height is changed by resize
+func (size *Size) Changes(width, height int) bool {
+	w, h := size.OutputSize(width, height)
+	return w != width || h != height
+}
+
+// Resize resizes img by the fit mode. The format is the output format, used by the default pad background:
+// white for formats without transparency.
+func (size *Size) Resize(img image.Image, format imaging.Format) (image.Image, error) {
+	if err := size.Validate(); err != nil {
+		return nil, err
+	}
+	var (
+		bounds        = img.Bounds()
+		width, height = bounds.Dx(), bounds.Dy()
+		w, h          = size.OutputSize(width, height)
+		anchor        = anchors[strings.ToLower(size.Anchor)]
+	)
+	if w == width && h == height {
+		return img, nil
+	}
+	switch size.GetFit() {
+	case FIT_COVER:
+		if size.Width > 0 && size.Height > 0 {
+			return imaging.Fill(img, w, h, anchor, imaging.Lanczos), nil
+		}
+	case FIT_PAD:
+		bg, err := size.background(format)
+		if err != nil {
+			return nil, err
+		}
+		iw, ih := size.containSize(width, height, w, h)
+		canvas := imaging.New(w, h, bg)
+		return imaging.Paste(canvas, imaging.Resize(img, iw, ih, imaging.Lanczos), anchorPoint(anchor, w, h, iw, ih)), nil
+	}
+	return imaging.Resize(img, w, h, imaging.Lanczos), nil
+}
+
+func (size *Size) background(format imaging.Format) (color.Color, error) {
+	if size.Background != "" {
+		return ParseColor(size.Background)
+	}
+	if format == imaging.JPEG || format == imaging.BMP {
+		return color.White, nil
+	}
+	return color.Transparent, nil
+}
+
+// anchorPoint return the position of image of width iw and height ih inside of box
+func anchorPoint(anchor imaging.Anchor, w, h, iw, ih int) image.Point {
+	var x, y = (w - iw) / 2, (h - ih) / 2
+	switch anchor {
+	case imaging.TopLeft, imaging.Left, imaging.BottomLeft:
+		x = 0
+	case imaging.TopRight, imaging.Right, imaging.BottomRight:
+		x = w - iw
+	}
+	switch anchor {
+	case imaging.TopLeft, imaging.Top, imaging.TopRight:
+		y = 0
+	case imaging.BottomLeft, imaging.Bottom, imaging.BottomRight:
+		y = h - ih
+	}
+	return image.Pt(x, y)
+}
+
+// ParseColor parses the colors "#rgb", "#rrggbb", "#rrggbbaa", "transparent" and the `ColorNames`
+func ParseColor(s string) (color.Color, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "transparent" {
+		return color.Transparent, nil
+	}
+	if named, ok := ColorNames[s]; ok {
+		s = named
+	}
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return nil, fmt.Errorf("invalid color %q", s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// ParseSize parses the size "WIDTHxHEIGHT" followed by options separated by space or comma:
+//
+//	200x200 fit=pad anchor=top background=#fff no_upscale format=jpeg quality=80 compression=best watermark=logo
+//
+// The width or height could be omitted: "200x" or "x200".
+func ParseSize(s string) (size *Size, err error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("blank size")
+	}
+	size = &Size{}
+	dims := strings.SplitN(strings.ToLower(fields[0]), "x", 2)
+	if len(dims) != 2 {
+		return nil, fmt.Errorf("invalid size %q", fields[0])
+	}
+	for i, dst := range []*int{&size.Width, &size.Height} {
+		if dims[i] == "" {
+			continue
+		}
+		if *dst, err = strconv.Atoi(dims[i]); err != nil || *dst < 0 {
+			return nil, fmt.Errorf("invalid size %q", fields[0])
+		}
+	}
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		key, value := strings.ToLower(kv[0]), ""
+		if len(kv) == 2 {
+			value = kv[1]
+		}
+		switch key {
+		case "fit":
+			size.Fit = value
+		case "anchor":
+			size.Anchor = value
+		case "background", "bg":
+			size.Background = value
+		case "no_upscale":
+			size.NoUpscale = value == "" || value == "true"
+		case "format":
+			size.Format = value
+		case "quality":
+			if size.Quality, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("invalid quality %q", value)
+			}
+		case "compression":
+			size.Compression = value
+		case "watermark":
+			size.Watermark = value
+		default:
+			return nil, fmt.Errorf("invalid size option %q", field)
+		}
+	}
+	if err = size.Validate(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// String return the size in the form parsed by `ParseSize`
+func (size Size) String() string {
+	var b strings.Builder
+	if size.Width > 0 {
+		b.WriteString(strconv.Itoa(size.Width))
+	}
+	b.WriteString("x")
+	if size.Height > 0 {
+		b.WriteString(strconv.Itoa(size.Height))
+	}
+	for _, opt := range [][2]string{
+		{"fit", size.Fit}, {"anchor", size.Anchor}, {"background", size.Background},
+		{"format", size.Format}, {"compression", size.Compression}, {"watermark", size.Watermark},
+	} {
+		if opt[1] != "" {
+			b.WriteString(" " + opt[0] + "=" + opt[1])
+		}
+	}
+	if size.Quality != 0 {
+		b.WriteString(" quality=" + strconv.Itoa(size.Quality))
+	}
+	if size.NoUpscale {
+		b.WriteString(" no_upscale")
+	}
+	return b.String()
+}
+
+// UnmarshalJSON accepts the object and the `ParseSize` string forms
+func (size *Size) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		parsed, err := ParseSize(s)
+		if err != nil {
+			return err
+		}
+		*size = *parsed
+		return nil
+	}
+	type plain Size
+	return json.Unmarshal(data, (*plain)(size))
+}
+
+// tagSizes return the sizes declared by field tag
+func (img Image) tagSizes() (sizes map[string]*Size) {
+	opt := img.FieldOption()
+	if opt == nil {
+		return
+	}
+	for name, value := range opt.GetPrefix(OPT_SIZE) {
+		if size, err := ParseSize(value); err == nil {
+			if sizes == nil {
+				sizes = map[string]*Size{}
+			}
+			sizes[strings.ToLower(name)] = size
+		}
+	}
+	return
+}
+
+// ValidateSizes validates the sizes declared by field tag. `Init` calls it, and the field isn't saved with
+// invalid sizes.
+func (img *Image) ValidateSizes() error {
+	img.sizesErr = nil
+	if opt := img.FieldOption(); opt != nil {
+		for name, value := range opt.GetPrefix(OPT_SIZE) {
+			if _, err := ParseSize(value); err != nil {
+				img.sizesErr = errwrap.Wrap(err, "Size %q", name)
+				break
+			}
+		}
+	}
+	return img.sizesErr
+}
+
+// GetSizesError return the sizes error found by `ValidateSizes`
+func (img *Image) GetSizesError() error {
+	return img.sizesErr
+}
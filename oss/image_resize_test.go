@@ -0,0 +1,105 @@
+package oss
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestSizeOutputSize(t *testing.T) {
+	cases := []struct {
+		size          string
+		width, height int
+		w, h          int
+	}{
+		{"200x200", 800, 400, 200, 200},
+		{"200x200 fit=contain", 800, 400, 200, 100},
+		{"200x200 fit=fit", 100, 50, 200, 100},
+		{"200x200 fit=contain no_upscale", 100, 50, 100, 50},
+		{"200x100 fit=fill", 800, 800, 200, 100},
+		{"200x100 fit=fill no_upscale", 150, 800, 150, 100},
+		{"200x200 fit=pad", 800, 400, 200, 200},
+		{"200x fit=cover", 800, 400, 200, 100},
+		{"x100", 800, 400, 200, 100},
+		{"200x999 fit=width", 800, 400, 200, 100},
+		{"999x100 fit=height", 800, 400, 200, 100},
+		{"1600x fit=width no_upscale", 800, 400, 800, 400},
+		{"400x200 no_upscale", 200, 200, 200, 100},
+	}
+	for _, c := range cases {
+		size, err := ParseSize(c.size)
+		if err != nil {
+			t.Errorf("ParseSize(%q) error: %v", c.size, err)
+			continue
+		}
+		if w, h := size.OutputSize(c.width, c.height); w != c.w || h != c.h {
+			t.Errorf("%q.OutputSize(%d, %d) == %dx%d, want %dx%d", c.size, c.width, c.height, w, h, c.w, c.h)
+		}
+	}
+}
+
+func TestSizeResizePad(t *testing.T) {
+	size, err := ParseSize("100x100 fit=pad anchor=top background=#f00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := imaging.New(200, 100, color.NRGBA{B: 255, A: 255})
+	img, err := size.Resize(src, imaging.PNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 100, 100) {
+		t.Fatalf("bounds == %v", img.Bounds())
+	}
+	// the image is at top, the pad at bottom
+	if r, _, b, _ := img.At(50, 10).RGBA(); r != 0 || b == 0 {
+		t.Errorf("top pixel == %v", img.At(50, 10))
+	}
+	if r, _, b, _ := img.At(50, 90).RGBA(); r == 0 || b != 0 {
+		t.Errorf("bottom pixel == %v", img.At(50, 90))
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	size, err := ParseSize("200x150,fit=pad,anchor=bottom_left,bg=#ffffff80,no_upscale,format=jpeg,quality=80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Size{Width: 200, Height: 150, Fit: "pad", Anchor: "bottom_left", Background: "#ffffff80",
+		NoUpscale: true, Format: "jpeg", Quality: 80}
+	if *size != expected {
+		t.Errorf("ParseSize == %+v, want %+v", *size, expected)
+	}
+	if again, err := ParseSize(size.String()); err != nil || *again != expected {
+		t.Errorf("ParseSize(%q) == %+v, %v", size.String(), again, err)
+	}
+	for _, invalid := range []string{"", "200", "ax1", "1x1 fit=zoom", "1x1 anchor=middle", "1x1 bg=#12", "1x1 foo"} {
+		if _, err := ParseSize(invalid); err == nil {
+			t.Errorf("ParseSize(%q) must fail", invalid)
+		}
+	}
+}
+
+func TestImageValidateSizes(t *testing.T) {
+	var img Image
+	if err := img.ValidateSizes(); err != nil {
+		t.Errorf("ValidateSizes() without field option == %v", err)
+	}
+	opt := img.GetOrSetFieldOption()
+	(*opt)["IMAGE.SIZE.THUMB"] = "200x200 fit=pad"
+	if err := img.ValidateSizes(); err != nil || img.GetSizesError() != nil {
+		t.Errorf("ValidateSizes() == %v", err)
+	}
+	(*opt)["IMAGE.SIZE.BIG"] = "1x1 fit=zoom"
+	if err := img.ValidateSizes(); err == nil || img.GetSizesError() != err {
+		t.Errorf("ValidateSizes() == %v, want error", err)
+	}
+	if _, ok := img.GetSizes()["big"]; ok {
+		t.Errorf("invalid size should not be used")
+	}
+	if size := img.GetSizes()["thumb"]; size == nil || size.Width != 200 || size.Fit != FIT_PAD {
+		t.Errorf("thumb size == %v", size)
+	}
+}
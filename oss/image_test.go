@@ -0,0 +1,54 @@
+package oss
+
+import (
+	"testing"
+
+	"github.com/ecletus/media"
+)
+
+func TestStyleVariant(t *testing.T) {
+	var (
+		crop  = &CropOption{X: 10, Y: 10, Width: 100, Height: 100}
+		size  = &Size{Width: 50, Height: 50}
+		focal = &FocalPoint{X: 0.5, Y: 0.25}
+		key   = styleVariant(crop, size, nil)
+	)
+	if got := styleVariant(&CropOption{X: 10, Y: 10, Width: 100, Height: 100}, &Size{Width: 50, Height: 50}, nil); got != key {
+		t.Errorf("styleVariant of same options == %q, want %q", got, key)
+	}
+	for name, other := range map[string]string{
+		"crop":        styleVariant(&CropOption{X: 20, Y: 10, Width: 100, Height: 100}, size, nil),
+		"size":        styleVariant(crop, &Size{Width: 60, Height: 50}, nil),
+		"focal point": styleVariant(crop, size, focal),
+		"no crop":     styleVariant(nil, size, nil),
+	} {
+		if other == key {
+			t.Errorf("styleVariant with other %s == %q", name, other)
+		}
+	}
+}
+
+func TestImageURLPendingStyles(t *testing.T) {
+	img := Image{
+		OSS:   OSS{Base: media.Base{Url: "/a.jpg", ContentType: "image/jpeg"}},
+		Sizes: map[string]*Size{"thumb": {Width: 10, Height: 10}},
+	}
+	for _, status := range []ProcessingStatus{"", PROCESSING_DONE} {
+		img.ProcessingStatus = status
+		if got, want := img.URL("thumb"), "/a.thumb.jpg"; got != want {
+			t.Errorf("%q: URL(thumb) == %q, want %q", status, got, want)
+		}
+	}
+	for _, status := range []ProcessingStatus{PROCESSING_PENDING, PROCESSING_PROCESSING, PROCESSING_FAILED} {
+		img.ProcessingStatus = status
+		if got, want := img.URL("thumb"), "/a.jpg"; got != want {
+			t.Errorf("%q: URL(thumb) == %q, want %q", status, got, want)
+		}
+		if got, want := img.URL(IMAGE_STYLE_ORIGNAL), "/a.original.jpg"; got != want {
+			t.Errorf("%q: URL(original) == %q, want %q", status, got, want)
+		}
+		if got, want := media.StorageURL(&img, "thumb"), "/a.thumb.jpg"; got != want {
+			t.Errorf("%q: StorageURL(thumb) == %q, want %q", status, got, want)
+		}
+	}
+}
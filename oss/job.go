@@ -0,0 +1,301 @@
+package oss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/ecletus/core"
+	"github.com/ecletus/media"
+	"github.com/moisespsena-go/aorm"
+	errwrap "github.com/moisespsena-go/error-wrap"
+)
+
+// OPT_ASYNC enables the asynchronous style generation: `image:"async"`
+const OPT_ASYNC = "image.async"
+
+// ProcessingStatus is the status of the asynchronous style generation
+type ProcessingStatus string
+
+const (
+	PROCESSING_PENDING    ProcessingStatus = "pending"
+	PROCESSING_PROCESSING ProcessingStatus = "processing"
+	PROCESSING_DONE       ProcessingStatus = "done"
+	PROCESSING_FAILED     ProcessingStatus = "failed"
+)
+
+// JobStatus is the status of a queued job
+type JobStatus string
+
+const (
+	JOB_PENDING JobStatus = "pending"
+	JOB_RUNNING JobStatus = "running"
+	JOB_DONE    JobStatus = "done"
+	JOB_FAILED  JobStatus = "failed"
+)
+
+// MediaJob is a queued processing of a media field
+type MediaJob struct {
+	aorm.Model
+	ModelName string    `sql:"size:255;index"`
+	RecordID  string    `sql:"size:255"`
+	Field     string    `sql:"size:255"`
+	Status    JobStatus `sql:"size:24;index"`
+	Attempts  int
+	RunAt     time.Time `sql:"index"`
+	LockedAt  *time.Time
+	LastError string `sql:"type:text"`
+}
+
+func (MediaJob) TableName() string {
+	return "media_jobs"
+}
+
+var jobModels sync.Map
+
+func jobModelName(typ reflect.Type) string {
+	return typ.PkgPath() + "." + typ.Name()
+}
+
+// RegisterJobModel registers models processed by the job worker.
+// Models are registered automatically when a job is queued, workers
+// running in other processes must register them.
+func RegisterJobModel(values ...interface{}) {
+	for _, value := range values {
+		typ := reflect.Indirect(reflect.ValueOf(value)).Type()
+		jobModels.Store(jobModelName(typ), typ)
+	}
+}
+
+// IsAsync return if the style generation of media is queued
+func IsAsync(m media.Media) bool {
+	if opt := m.FieldOption(); opt != nil {
+		return opt.Get(OPT_ASYNC) != ""
+	}
+	return false
+}
+
+// enqueueJob queues the processing of field. The job is created in the scope transaction.
+func enqueueJob(scope *aorm.Scope, field *aorm.Field, img ImageInterface) (err error) {
+	typ := reflect.Indirect(reflect.ValueOf(scope.Value)).Type()
+	jobModels.Store(jobModelName(typ), typ)
+
+	img.SetProcessingStatus(PROCESSING_PENDING)
+	job := &MediaJob{
+		ModelName: jobModelName(typ),
+		RecordID:  fmt.Sprint(scope.Instance().ID()),
+		Field:     field.DBName,
+		Status:    JOB_PENDING,
+		RunAt:     time.Now(),
+	}
+	if err = scope.NewDB().Create(job).Error; err != nil {
+		return errwrap.Wrap(err, "Queue media job of %s#%s", job.ModelName, job.Field)
+	}
+	return
+}
+
+// JobWorker processes the queued jobs
+type JobWorker struct {
+	DB *aorm.DB
+	// PollInterval interval between queue checks, defaults to 5 seconds
+	PollInterval time.Duration
+	// MaxAttempts defaults to 5
+	MaxAttempts int
+	// BatchSize max jobs fetched per check, defaults to 10
+	BatchSize int
+	// Backoff returns the delay before retry the attempt, defaults to 30s * 2^(attempt-1), up to one hour
+	Backoff func(attempt int) time.Duration
+	// LockTimeout is the max duration of a running job, defaults to 10 minutes. The running jobs locked before
+	// it, like the jobs of crashed workers, are queued again, or failed if the max attempts was reached.
+	LockTimeout time.Duration
+}
+
+func (w *JobWorker) lockTimeout() time.Duration {
+	if w.LockTimeout <= 0 {
+		return 10 * time.Minute
+	}
+	return w.LockTimeout
+}
+
+func (w *JobWorker) maxAttempts() int {
+	if w.MaxAttempts <= 0 {
+		return 5
+	}
+	return w.MaxAttempts
+}
+
+func (w *JobWorker) backoff(attempt int) time.Duration {
+	if w.Backoff != nil {
+		return w.Backoff(attempt)
+	}
+	d := 30 * time.Second << uint(attempt-1)
+	if d <= 0 || d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
+
+// Run processes jobs until ctx is done
+func (w *JobWorker) Run(ctx context.Context) error {
+	interval := w.PollInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	for {
+		n, err := w.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Reclaim queues again the running jobs locked before the lock timeout, or fails them if the max attempts was
+// reached. Returns the number of jobs reclaimed.
+func (w *JobWorker) Reclaim() (reclaimed int64, err error) {
+	var (
+		now     = time.Now()
+		expired = w.DB.Model(&MediaJob{}).Where("status = ? AND locked_at < ?", JOB_RUNNING, now.Add(-w.lockTimeout()))
+		db      = expired.Where("attempts >= ?", w.maxAttempts()).UpdateColumns(map[string]interface{}{
+			"status": JOB_FAILED, "locked_at": nil, "last_error": "lock timeout",
+		})
+	)
+	if db.Error != nil {
+		return 0, errwrap.Wrap(db.Error, "Fail expired media jobs")
+	}
+	reclaimed = db.RowsAffected
+	db = expired.Where("attempts < ?", w.maxAttempts()).UpdateColumns(map[string]interface{}{
+		"status": JOB_PENDING, "locked_at": nil, "last_error": "lock timeout", "run_at": now,
+	})
+	if db.Error != nil {
+		return reclaimed, errwrap.Wrap(db.Error, "Queue expired media jobs")
+	}
+	return reclaimed + db.RowsAffected, nil
+}
+
+// RunOnce reclaims the expired jobs, processes the due jobs and returns the number of jobs processed
+func (w *JobWorker) RunOnce(ctx context.Context) (processed int, err error) {
+	batchSize := w.BatchSize
+	if batchSize <= 0 {
+		batchSize = 10
+	}
+	if _, err = w.Reclaim(); err != nil {
+		return
+	}
+	var jobs []*MediaJob
+	if err = w.DB.Where("status = ? AND run_at <= ?", JOB_PENDING, time.Now()).
+		Order("run_at").Limit(batchSize).Find(&jobs).Error; err != nil {
+		return 0, errwrap.Wrap(err, "Find media jobs")
+	}
+
+	for _, job := range jobs {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		// the attempt is counted on lock, so the jobs crashing the worker fails after the max attempts
+		now, attempts := time.Now(), job.Attempts+1
+		db := w.DB.Model(job).Where("status = ?", JOB_PENDING).
+			UpdateColumns(map[string]interface{}{"status": JOB_RUNNING, "locked_at": &now, "attempts": attempts})
+		if db.Error != nil {
+			return processed, errwrap.Wrap(db.Error, "Lock media job")
+		}
+		if db.RowsAffected != 1 {
+			// locked by other worker
+			continue
+		}
+
+		processed++
+		job.Attempts = attempts
+		var (
+			final   = job.Attempts >= w.maxAttempts()
+			jobErr  = w.process(ctx, job, final)
+			columns = map[string]interface{}{"attempts": job.Attempts, "locked_at": nil}
+		)
+		switch {
+		case jobErr == nil:
+			columns["status"] = JOB_DONE
+			columns["last_error"] = ""
+		case final:
+			columns["status"] = JOB_FAILED
+			columns["last_error"] = jobErr.Error()
+		default:
+			columns["status"] = JOB_PENDING
+			columns["last_error"] = jobErr.Error()
+			columns["run_at"] = time.Now().Add(w.backoff(job.Attempts))
+		}
+		if err = w.DB.Model(job).UpdateColumns(columns).Error; err != nil {
+			return processed, errwrap.Wrap(err, "Update media job")
+		}
+	}
+	return
+}
+
+func (w *JobWorker) process(ctx context.Context, job *MediaJob, final bool) (err error) {
+	v, ok := jobModels.Load(job.ModelName)
+	if !ok {
+		return fmt.Errorf("media job model %q not registered", job.ModelName)
+	}
+	var (
+		record = reflect.New(v.(reflect.Type)).Interface()
+		db     = IgnoreCallback(media.WithContext(w.DB, ctx))
+		id     aorm.ID
+	)
+	if id, err = aorm.StructOf(record).DefaultID().SetValue(job.RecordID); err != nil {
+		return
+	}
+	if err = db.First(record, id).Error; err != nil {
+		return errwrap.Wrap(err, "Load %s#%s", job.ModelName, job.RecordID)
+	}
+
+	var (
+		scope = db.NewScope(record)
+		field *aorm.Field
+	)
+	for _, f := range scope.Instance().Fields {
+		if f.DBName == job.Field {
+			field = f
+			break
+		}
+	}
+	if field == nil {
+		return fmt.Errorf("field %q of %s not found", job.Field, job.ModelName)
+	}
+	img, ok := field.Field.Addr().Interface().(ImageInterface)
+	if !ok {
+		return errors.New("field isn't an image")
+	}
+	if !img.HasFile() {
+		return nil
+	}
+	img.Init(core.GetSiteFromDB(db), field)
+
+	img.SetProcessingStatus(PROCESSING_PROCESSING)
+	if _, err = handleMedia(ctx, img); err != nil {
+		if final {
+			img.SetProcessingStatus(PROCESSING_FAILED)
+		} else {
+			img.SetProcessingStatus(PROCESSING_PENDING)
+		}
+	} else {
+		img.SetProcessingStatus(PROCESSING_DONE)
+	}
+
+	columns := map[string]interface{}{field.DBName: img}
+	for column, value := range imageProcessedColumns(db, record, field) {
+		columns[column] = value
+	}
+	if updateErr := db.Model(record).UpdateColumns(columns).Error; updateErr != nil && err == nil {
+		err = updateErr
+	}
+	return
+}
@@ -0,0 +1,79 @@
+package oss
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ecletus/core/test/utils"
+)
+
+func TestJobWorkerBackoff(t *testing.T) {
+	w := &JobWorker{}
+	for attempt, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 3: 2 * time.Minute, 10: time.Hour, 100: time.Hour} {
+		if got := w.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) == %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestJobWorkerQueue(t *testing.T) {
+	db := utils.TestDB()
+	if err := db.DropTableIfExists(&MediaJob{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&MediaJob{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		ctx      = context.Background()
+		w        = &JobWorker{DB: db, MaxAttempts: 2, LockTimeout: time.Minute, Backoff: func(int) time.Duration { return 0 }}
+		now      = time.Now()
+		lockedAt = now.Add(-time.Hour)
+		// the model of jobs isn't registered, so the processing fails
+		failing = &MediaJob{ModelName: "unregistered", RecordID: "1", Field: "image", Status: JOB_PENDING, RunAt: now}
+		crashed = &MediaJob{ModelName: "unregistered", RecordID: "2", Field: "image", Status: JOB_RUNNING, RunAt: lockedAt, LockedAt: &lockedAt, Attempts: 1}
+		dead    = &MediaJob{ModelName: "unregistered", RecordID: "3", Field: "image", Status: JOB_RUNNING, RunAt: lockedAt, LockedAt: &lockedAt, Attempts: 2}
+		running = &MediaJob{ModelName: "unregistered", RecordID: "4", Field: "image", Status: JOB_RUNNING, RunAt: now, LockedAt: &now}
+	)
+	for _, job := range []*MediaJob{failing, crashed, dead, running} {
+		if err := db.Create(job).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := func(job *MediaJob, status JobStatus, attempts int, lastError string) {
+		t.Helper()
+		var got MediaJob
+		if err := db.First(&got, job.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != status || got.Attempts != attempts || !strings.Contains(got.LastError, lastError) {
+			t.Errorf("job %s: status %q, attempts %d, error %q; want %q, %d, %q",
+				job.RecordID, got.Status, got.Attempts, got.LastError, status, attempts, lastError)
+		}
+		if status != JOB_RUNNING && got.LockedAt != nil {
+			t.Errorf("job %s: locked at %v", job.RecordID, got.LockedAt)
+		}
+	}
+
+	// the crashed job is reclaimed and processed with the failing job, the dead job reached the max attempts
+	if processed, err := w.RunOnce(ctx); err != nil || processed != 2 {
+		t.Fatalf("RunOnce() == %d, %v", processed, err)
+	}
+	check(failing, JOB_PENDING, 1, "not registered")
+	check(crashed, JOB_FAILED, 2, "not registered")
+	check(dead, JOB_FAILED, 2, "lock timeout")
+	check(running, JOB_RUNNING, 0, "")
+
+	if processed, err := w.RunOnce(ctx); err != nil || processed != 1 {
+		t.Fatalf("RunOnce() == %d, %v", processed, err)
+	}
+	check(failing, JOB_FAILED, 2, "not registered")
+
+	if processed, err := w.RunOnce(ctx); err != nil || processed != 0 {
+		t.Fatalf("RunOnce() without due jobs == %d, %v", processed, err)
+	}
+}
@@ -0,0 +1,171 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime/multipart"
+	"time"
+
+	"github.com/ecletus/media"
+	"github.com/ecletus/media/metadata"
+	errwrap "github.com/moisespsena-go/error-wrap"
+)
+
+// IMAGE_METADATA_HANDLER is the name of image metadata handler
+const IMAGE_METADATA_HANDLER = "image_metadata"
+
+// OPT_STRIP_METADATA removes the EXIF, IPTC and XMP metadata of stored image files, keeping only the
+// orientation: `image:"strip_metadata"`. The GPS is not stored into the image JSON too.
+const OPT_STRIP_METADATA = "image.strip_metadata"
+
+// IsStripMetadata return if the metadata of stored image files is removed
+func IsStripMetadata(m media.Media) bool {
+	if opt := m.FieldOption(); opt != nil {
+		return opt.Get(OPT_STRIP_METADATA) != ""
+	}
+	return false
+}
+
+// stripMetadata return r without metadata if m is an image with strip enabled
+func stripMetadata(m media.Media, r io.Reader) (io.Reader, error) {
+	if !m.IsImage() || !IsStripMetadata(m) {
+		return r, nil
+	}
+	var buf bytes.Buffer
+	if err := metadata.Strip(&buf, r, true); err != nil {
+		return nil, errwrap.Wrap(err, "Strip metadata")
+	}
+	return &buf, nil
+}
+
+// MetadataInterface is implemented by images with EXIF, IPTC and XMP metadata
+type MetadataInterface interface {
+	GetMetadata() *metadata.Metadata
+	SetMetadata(md *metadata.Metadata)
+}
+
+// GetMetadata return the metadata of image. Returns nil if the image has no metadata.
+func (img *Image) GetMetadata() *metadata.Metadata {
+	return img.Metadata
+}
+
+// SetMetadata sets the metadata of image
+func (img *Image) SetMetadata(md *metadata.Metadata) {
+	if md.IsZero() {
+		md = nil
+	}
+	img.Metadata = md
+}
+
+// GetDateTaken return the capture date
+func (img Image) GetDateTaken() *time.Time {
+	if img.Metadata == nil {
+		return nil
+	}
+	return img.Metadata.DateTaken
+}
+
+// GetKeywords return the keywords
+func (img Image) GetKeywords() []string {
+	if img.Metadata == nil {
+		return nil
+	}
+	return img.Metadata.Keywords
+}
+
+// GetCaption return the caption
+func (img Image) GetCaption() string {
+	if img.Metadata == nil {
+		return ""
+	}
+	return img.Metadata.Caption
+}
+
+// GetCredit return the photographer credit: the artist or the copyright
+func (img Image) GetCredit() string {
+	return img.Metadata.Credit()
+}
+
+// GetCopyright return the copyright
+func (img Image) GetCopyright() string {
+	if img.Metadata == nil {
+		return ""
+	}
+	return img.Metadata.Copyright
+}
+
+// GetCamera return the camera make and model
+func (img Image) GetCamera() string {
+	return img.Metadata.Camera()
+}
+
+// GetLens return the lens
+func (img Image) GetLens() string {
+	if img.Metadata == nil {
+		return ""
+	}
+	return img.Metadata.Lens
+}
+
+// GetGPS return the location where the image was taken
+func (img Image) GetGPS() *metadata.GPS {
+	if img.Metadata == nil {
+		return nil
+	}
+	return img.Metadata.GPS
+}
+
+// GetOrientation return the EXIF orientation, from 1 to 8. Returns 0 if unknown.
+func (img Image) GetOrientation() int {
+	if img.Metadata == nil {
+		return 0
+	}
+	return img.Metadata.Orientation
+}
+
+// imageMetadataHandler extracts the EXIF, IPTC and XMP metadata of new images
+type imageMetadataHandler struct{}
+
+func (imageMetadataHandler) CouldHandle(m media.Media) bool {
+	if m.IsImage() {
+		if im, ok := m.(ImageInterface); ok {
+			if _, ok := m.(MetadataInterface); ok {
+				return im.IsNew()
+			}
+		}
+	}
+	return false
+}
+
+func (h imageMetadataHandler) Handle(m media.Media, file multipart.File, option *media.Option) (err error) {
+	return h.HandleContext(context.Background(), m, file, option)
+}
+
+func (imageMetadataHandler) HandleContext(ctx context.Context, m media.Media, file multipart.File, option *media.Option) (err error) {
+	// invalid metadata does not invalidate the image
+	md, _ := metadata.Parse(file)
+	if md != nil && IsStripMetadata(m) {
+		md.GPS = nil
+	}
+	m.(MetadataInterface).SetMetadata(md)
+	return nil
+}
+
+// extractMetadata runs the metadata handler out of handlers pipeline
+func extractMetadata(ctx context.Context, img ImageInterface) (err error) {
+	h := imageMetadataHandler{}
+	if !h.CouldHandle(img) {
+		return
+	}
+	var file multipart.File
+	if file, err = openFile(ctx, img); err != nil {
+		return
+	}
+	defer file.Close()
+	return media.CallHandler(ctx, h, img, file, img.FieldOption())
+}
+
+func init() {
+	media.RegisterMediaHandler(IMAGE_METADATA_HANDLER, imageMetadataHandler{}, media.HandlerOption{Before: []string{IMAGE_HANDLER}})
+}
@@ -1,6 +1,7 @@
 package oss
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -29,7 +30,9 @@ func init() {
 
 type OSSInterface interface {
 	media.Media
+	media.ContentAddresser
 	IsNew() bool
+	Exists(path string) (found bool, err error)
 }
 
 // OSS common storage interface
@@ -52,6 +55,15 @@ var DefaultStoreHandler = func(storage oss.StorageInterface, path string, option
 func (o *OSS) Init(site *core.Site, field *aorm.Field) {
 	o.Base.Init(site, field)
 	o.GetOrSetFieldOption().ParseFieldTag("oss", &field.Tag)
+	o.ValidateURLTemplate(o)
+}
+
+// DefaultStoreContextHandler used to store reader with default Storage, honouring ctx cancellation
+var DefaultStoreContextHandler = func(ctx context.Context, storage oss.StorageInterface, path string, option *media.Option, reader io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return DefaultStoreHandler(storage, path, option, media.NewContextReader(ctx, reader))
 }
 
 // Store save reader's content with path
@@ -59,11 +71,33 @@ func (o *OSS) Store(path string, reader io.Reader) error {
 	return DefaultStoreHandler(o.Storage(), path, o.FieldOption(), reader)
 }
 
+// StoreContext save reader's content with path, honouring ctx cancellation
+func (o *OSS) StoreContext(ctx context.Context, path string, reader io.Reader) error {
+	return DefaultStoreContextHandler(ctx, o.Storage(), path, o.FieldOption(), reader)
+}
+
+// Exists check if path was stored
+func (o *OSS) Exists(path string) (found bool, err error) {
+	_, notFound, err := o.Storage().Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("Get stat for %q fail: %v", path, err)
+	}
+	return !notFound, nil
+}
+
 // DefaultRemoveHandler used to store reader with default Storage
 var DefaultRemoveHandler = func(storage oss.StorageInterface, path string, option *media.Option) error {
 	return storage.Delete(path)
 }
 
+// RemoveContext remove content by path, honouring ctx cancellation
+func (o *OSS) RemoveContext(ctx context.Context, path string) (found bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return o.Remove(path)
+}
+
 // Remove content by path
 func (o *OSS) Remove(path string) (found bool, err error) {
 	_, notFound, err := o.Storage().Stat(path)
@@ -102,7 +136,7 @@ func (o *OSS) Scan(data interface{}) (err error) {
 }
 
 func (o *OSS) ContextScan(ctx *core.Context, data interface{}) (err error) {
-	return o.Set(media.NewContext(o), data)
+	return media.TranslateError(ctx, o.Set(media.NewContext(o), data))
 }
 
 func (o *OSS) MediaScan(ctx *media.Context, data interface{}) (err error) {
@@ -114,7 +148,19 @@ var DefaultRetrieveHandler = func(storage oss.StorageInterface, option *media.Op
 	return storage.Get(path)
 }
 
+// DefaultRetrieveContextHandler used to retrieve file, honouring ctx cancellation
+var DefaultRetrieveContextHandler = func(ctx context.Context, storage oss.StorageInterface, option *media.Option, path string) (*os.File, error) {
+	return media.RunContext(ctx, func() (*os.File, error) {
+		return DefaultRetrieveHandler(storage, option, path)
+	})
+}
+
 // Retrieve retrieve file content with url
 func (o *OSS) Retrieve(path string) (*os.File, error) {
 	return DefaultRetrieveHandler(o.Storage(), o.FieldOption(), path)
 }
+
+// RetrieveContext retrieve file content with url, honouring ctx cancellation
+func (o *OSS) RetrieveContext(ctx context.Context, path string) (*os.File, error) {
+	return DefaultRetrieveContextHandler(ctx, o.Storage(), o.FieldOption(), path)
+}
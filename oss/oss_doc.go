@@ -21,7 +21,7 @@ func (*Doc) FileExts() []string {
 }
 
 func (d *Doc) ContextScan(ctx *core.Context, data interface{}) (err error) {
-	return d.Set(media.NewContext(d), data)
+	return media.TranslateError(ctx, d.Set(media.NewContext(d), data))
 }
 
 func (d *Doc) ConfigureQorMetaBeforeInitialize(metaor resource.Metaor) {
@@ -21,12 +21,12 @@ type MyFileSystem struct {
 	oss.OSS
 }
 
-func (MyFileSystem) GetSizes() map[string]*Size {
-	return map[string]*Size{
-		"small1": {20, 10},
-		"small2": {20, 10},
-		"square": {30, 30},
-		"big":    {50, 50},
+func (MyFileSystem) GetSizes() map[string]*oss.Size {
+	return map[string]*oss.Size{
+		"small1": {Width: 20, Height: 10},
+		"small2": {Width: 20, Height: 10},
+		"square": {Width: 30, Height: 30},
+		"big":    {Width: 50, Height: 50},
 	}
 }
 
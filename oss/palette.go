@@ -0,0 +1,192 @@
+package oss
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/disintegration/imaging"
+)
+
+var (
+	// PaletteSize is the number of swatches of image palette
+	PaletteSize = 5
+	// PaletteAnalysisSize is the max size of the image copy analyzed by `ExtractPalette`
+	PaletteAnalysisSize = 64
+)
+
+// ColorNames are the named colors accepted by `ParseColor`
+var ColorNames = map[string]string{
+	"black":  "#000000",
+	"white":  "#ffffff",
+	"gray":   "#808080",
+	"grey":   "#808080",
+	"red":    "#e53935",
+	"orange": "#fb8c00",
+	"yellow": "#fdd835",
+	"green":  "#43a047",
+	"blue":   "#1e88e5",
+	"purple": "#8e24aa",
+	"pink":   "#d81b60",
+	"brown":  "#6d4c41",
+}
+
+// Swatch is a color of image palette
+type Swatch struct {
+	// Color is the hex color, like "#1e40af"
+	Color string
+	// Weight is the fraction of pixels near of color, from 0 to 1
+	Weight float64
+}
+
+// PaletteInterface is implemented by images with palette
+type PaletteInterface interface {
+	SetPalette(palette []Swatch)
+}
+
+// SetPalette sets the palette, the first swatch is the dominant color
+func (img *Image) SetPalette(palette []Swatch) {
+	img.Palette = palette
+}
+
+// GetPalette return the palette of original, sorted by weight
+func (img Image) GetPalette() []Swatch {
+	return img.Palette
+}
+
+// GetDominantColor return the hex color of the heaviest swatch, or blank if unknown
+func (img Image) GetDominantColor() string {
+	if len(img.Palette) == 0 {
+		return ""
+	}
+	return img.Palette[0].Color
+}
+
+// HexColor return the "#rrggbb" form of c
+func HexColor(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)
+}
+
+type paletteBucket struct {
+	rgb   [3]float64
+	count float64
+}
+
+func colorDistance(a, b [3]float64) float64 {
+	dr, dg, db := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dr*dr + dg*dg + db*db
+}
+
+// ExtractPalette return up to k swatches of img by k-means clustering, sorted by weight.
+// The transparent pixels are ignored.
+func ExtractPalette(img image.Image, k int) []Swatch {
+	if k <= 0 {
+		return nil
+	}
+	// histogram of 4 bits per channel
+	var (
+		small   = imaging.Fit(img, PaletteAnalysisSize, PaletteAnalysisSize, imaging.Box)
+		buckets = map[int]*paletteBucket{}
+		total   float64
+	)
+	for i := 0; i+3 < len(small.Pix); i += 4 {
+		p := small.Pix[i : i+4]
+		if p[3] < 128 {
+			continue
+		}
+		key := int(p[0]>>4)<<8 | int(p[1]>>4)<<4 | int(p[2]>>4)
+		b := buckets[key]
+		if b == nil {
+			b = &paletteBucket{}
+			buckets[key] = b
+		}
+		b.rgb[0] += float64(p[0])
+		b.rgb[1] += float64(p[1])
+		b.rgb[2] += float64(p[2])
+		b.count++
+		total++
+	}
+	if total == 0 {
+		return nil
+	}
+	points := make([]*paletteBucket, 0, len(buckets))
+	for _, b := range buckets {
+		b.rgb = [3]float64{b.rgb[0] / b.count, b.rgb[1] / b.count, b.rgb[2] / b.count}
+		points = append(points, b)
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].count != points[j].count {
+			return points[i].count > points[j].count
+		}
+		return HexColor(rgbColor(points[i].rgb)) < HexColor(rgbColor(points[j].rgb))
+	})
+
+	// the initial centroids are the most populated buckets, distinct of each other
+	var centroids [][3]float64
+	for _, minDistance := range []float64{48 * 48, 0} {
+		for _, p := range points {
+			if len(centroids) == k {
+				break
+			}
+			distinct := true
+			for _, c := range centroids {
+				if d := colorDistance(c, p.rgb); d <= minDistance || d == 0 {
+					distinct = false
+					break
+				}
+			}
+			if distinct {
+				centroids = append(centroids, p.rgb)
+			}
+		}
+	}
+
+	weights := make([]float64, len(centroids))
+	for iteration := 0; iteration < 10; iteration++ {
+		sums := make([][4]float64, len(centroids))
+		for _, p := range points {
+			nearest, best := 0, math.Inf(1)
+			for i, c := range centroids {
+				if d := colorDistance(c, p.rgb); d < best {
+					nearest, best = i, d
+				}
+			}
+			s := &sums[nearest]
+			s[0] += p.rgb[0] * p.count
+			s[1] += p.rgb[1] * p.count
+			s[2] += p.rgb[2] * p.count
+			s[3] += p.count
+		}
+		for i, s := range sums {
+			if s[3] > 0 {
+				centroids[i] = [3]float64{s[0] / s[3], s[1] / s[3], s[2] / s[3]}
+			}
+			weights[i] = s[3] / total
+		}
+	}
+
+	palette := make([]Swatch, 0, len(centroids))
+	for i, c := range centroids {
+		if weights[i] > 0 {
+			palette = append(palette, Swatch{Color: HexColor(rgbColor(c)), Weight: math.Round(weights[i]*1000) / 1000})
+		}
+	}
+	sort.SliceStable(palette, func(i, j int) bool {
+		return palette[i].Weight > palette[j].Weight
+	})
+	return palette
+}
+
+func rgbColor(rgb [3]float64) color.NRGBA {
+	return color.NRGBA{R: uint8(math.Round(rgb[0])), G: uint8(math.Round(rgb[1])), B: uint8(math.Round(rgb[2])), A: 255}
+}
+
+// setPalette computes the palette of decoded original
+func (cropper *ImageCropper) setPalette() {
+	if p, ok := cropper.Image.(PaletteInterface); ok {
+		p.SetPalette(ExtractPalette(cropper.firstFrame(), PaletteSize))
+	}
+}
@@ -0,0 +1,42 @@
+package oss
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestExtractPalette(t *testing.T) {
+	// 3/4 blue, 1/4 orange
+	img := imaging.New(80, 40, color.NRGBA{R: 20, G: 60, B: 200, A: 255})
+	img = imaging.Paste(img, imaging.New(20, 40, color.NRGBA{R: 250, G: 140, B: 10, A: 255}), image.Pt(60, 0))
+
+	palette := ExtractPalette(img, 5)
+	if len(palette) != 2 {
+		t.Fatalf("palette == %v", palette)
+	}
+	if palette[0].Color != "#143cc8" || palette[1].Color != "#fa8c0a" {
+		t.Errorf("palette colors == %v", palette)
+	}
+	if palette[0].Weight != 0.75 || palette[1].Weight != 0.25 {
+		t.Errorf("palette weights == %v", palette)
+	}
+	if dominant := (Image{Palette: palette}).GetDominantColor(); dominant != "#143cc8" {
+		t.Errorf("dominant color == %q", dominant)
+	}
+}
+
+func TestExtractPaletteTransparent(t *testing.T) {
+	if palette := ExtractPalette(image.NewNRGBA(image.Rect(0, 0, 10, 10)), 5); palette != nil {
+		t.Errorf("palette of transparent image == %v", palette)
+	}
+}
+
+func TestParseColorName(t *testing.T) {
+	c, err := ParseColor("Blue")
+	if err != nil || HexColor(c) != ColorNames["blue"] {
+		t.Errorf("ParseColor(Blue) == %v, %v", c, err)
+	}
+}
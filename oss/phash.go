@@ -0,0 +1,54 @@
+package oss
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"strconv"
+
+	"github.com/disintegration/imaging"
+)
+
+// PerceptualHashInterface is implemented by images with perceptual hash
+type PerceptualHashInterface interface {
+	SetPerceptualHash(hash string)
+}
+
+// PerceptualHash return the dHash of img in hex: 64 bits of the gradients between adjacent pixels of
+// a 9x8 grayscale copy. Re-encoded, resized and slightly edited copies have hashes of small Hamming distance.
+func PerceptualHash(img image.Image) string {
+	var (
+		small = imaging.Resize(imaging.Grayscale(img), 9, 8, imaging.Box)
+		hash  uint64
+	)
+	for y := 0; y < 8; y++ {
+		row := small.Pix[y*small.Stride:]
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if row[x*4] < row[(x+1)*4] {
+				hash |= 1
+			}
+		}
+	}
+	return fmt.Sprintf("%016x", hash)
+}
+
+// HammingDistance return the number of different bits of perceptual hashes a and b
+func HammingDistance(a, b string) (int, error) {
+	x, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid perceptual hash %q", a)
+	}
+	y, err := strconv.ParseUint(b, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid perceptual hash %q", b)
+	}
+	return bits.OnesCount64(x ^ y), nil
+}
+
+// setPerceptualHash computes the perceptual hash of decoded original
+func (cropper *ImageCropper) setPerceptualHash() {
+	if p, ok := cropper.Image.(PerceptualHashInterface); ok {
+		p.SetPerceptualHash(PerceptualHash(cropper.firstFrame()))
+	}
+}
@@ -0,0 +1,53 @@
+package oss
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func gradientImage(width, height int, flip bool) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8((x*7 + y*3) * 255 / (width*7 + height*3))
+			if flip && (x/(width/4))%2 == 1 {
+				v = 255 - v
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: v, G: v / 2, B: 255 - v, A: 255})
+		}
+	}
+	return img
+}
+
+func TestPerceptualHash(t *testing.T) {
+	var (
+		original = gradientImage(320, 240, false)
+		hash     = PerceptualHash(original)
+	)
+	if len(hash) != 16 {
+		t.Fatalf("hash == %q", hash)
+	}
+
+	// resized copy
+	resized := PerceptualHash(imaging.Resize(original, 100, 75, imaging.Lanczos))
+	if d, err := HammingDistance(hash, resized); err != nil || d > 4 {
+		t.Errorf("distance of resized copy == %d, %v", d, err)
+	}
+
+	different := PerceptualHash(gradientImage(320, 240, true))
+	if d, err := HammingDistance(hash, different); err != nil || d < 10 {
+		t.Errorf("distance of different image == %d, %v", d, err)
+	}
+}
+
+func TestHammingDistance(t *testing.T) {
+	if d, err := HammingDistance("00000000000000ff", "000000000000000f"); err != nil || d != 4 {
+		t.Errorf("HammingDistance == %d, %v", d, err)
+	}
+	if _, err := HammingDistance("xyz", "0"); err == nil {
+		t.Error("invalid hash must fail")
+	}
+}
@@ -0,0 +1,98 @@
+package oss
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html/template"
+	"image"
+	"regexp"
+
+	"github.com/disintegration/imaging"
+	"github.com/ecletus/media/blurhash"
+	errwrap "github.com/moisespsena-go/error-wrap"
+)
+
+var (
+	// PlaceholderSize is the max width and height of preview data URI
+	PlaceholderSize = 16
+	// BlurHashComponents is the x and y components of BlurHash of landscape images,
+	// swapped for portrait images
+	BlurHashComponents = [2]int{4, 3}
+
+	previewRegexp = regexp.MustCompile(`^data:image/(jpeg|png);base64,[A-Za-z0-9+/]*={0,2}$`)
+)
+
+// PlaceholderInterface is implemented by images with low quality placeholders
+type PlaceholderInterface interface {
+	SetPlaceholder(blurHash, preview string)
+}
+
+// SetPlaceholder sets the BlurHash and the preview data URI
+func (img *Image) SetPlaceholder(blurHash, preview string) {
+	img.BlurHash, img.Preview = blurHash, preview
+}
+
+// GetBlurHash return the BlurHash of original
+func (img Image) GetBlurHash() string {
+	return img.BlurHash
+}
+
+// GetPreview return the tiny preview data URI of original
+func (img Image) GetPreview() string {
+	return img.Preview
+}
+
+// PreviewURL return the preview data URI safe to html templates attributes, or blank if the preview isn't a
+// JPEG or PNG base64 data URI:
+//
+//	<img src="{{.Photo.PreviewURL}}" data-src="{{.Photo.URL "thumb"}}">
+func (img Image) PreviewURL() template.URL {
+	if !previewRegexp.MatchString(img.Preview) {
+		return ""
+	}
+	return template.URL(img.Preview)
+}
+
+// Placeholder return the BlurHash and the tiny preview data URI of img
+func Placeholder(img image.Image) (blurHash, preview string, err error) {
+	var (
+		bounds = img.Bounds()
+		x, y   = BlurHashComponents[0], BlurHashComponents[1]
+	)
+	if bounds.Dx() < bounds.Dy() {
+		x, y = y, x
+	}
+	// the BlurHash cost is proportional to pixels count
+	if blurHash, err = blurhash.Encode(x, y, imaging.Fit(img, 64, 64, imaging.Box)); err != nil {
+		return "", "", errwrap.Wrap(err, "BlurHash")
+	}
+
+	var (
+		thumb  = imaging.Fit(img, PlaceholderSize, PlaceholderSize, imaging.Linear)
+		buf    bytes.Buffer
+		format = imaging.JPEG
+		mime   = "image/jpeg"
+	)
+	if !thumb.Opaque() {
+		format, mime = imaging.PNG, "image/png"
+	}
+	if err = imaging.Encode(&buf, thumb, format, imaging.JPEGQuality(60)); err != nil {
+		return "", "", errwrap.Wrap(err, "Preview encode")
+	}
+	preview = "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+	return
+}
+
+// setPlaceholder computes the placeholders of decoded original
+func (cropper *ImageCropper) setPlaceholder() error {
+	p, ok := cropper.Image.(PlaceholderInterface)
+	if !ok {
+		return nil
+	}
+	blurHash, preview, err := Placeholder(cropper.firstFrame())
+	if err != nil {
+		return err
+	}
+	p.SetPlaceholder(blurHash, preview)
+	return nil
+}
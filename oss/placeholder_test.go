@@ -0,0 +1,58 @@
+package oss
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/ecletus/media/blurhash"
+)
+
+func TestPlaceholder(t *testing.T) {
+	img := imaging.New(120, 80, color.NRGBA{R: 200, G: 40, B: 40, A: 255})
+	blurHash, preview, err := Placeholder(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, y, err := blurhash.Components(blurHash); err != nil || x != 4 || y != 3 {
+		t.Errorf("BlurHash %q components == %d, %d, %v", blurHash, x, y, err)
+	}
+	if !strings.HasPrefix(preview, "data:image/jpeg;base64,") {
+		t.Errorf("preview of opaque image == %q", preview)
+	}
+
+	portrait := image.NewNRGBA(image.Rect(0, 0, 30, 90))
+	blurHash, preview, err = Placeholder(portrait)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x, y, err := blurhash.Components(blurHash); err != nil || x != 3 || y != 4 {
+		t.Errorf("BlurHash %q of portrait components == %d, %d, %v", blurHash, x, y, err)
+	}
+	if !strings.HasPrefix(preview, "data:image/png;base64,") {
+		t.Errorf("preview of transparent image == %q", preview)
+	}
+}
+
+func TestImagePreviewURL(t *testing.T) {
+	_, preview, err := Placeholder(imaging.New(12, 8, color.NRGBA{R: 200, A: 255}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		preview:                              preview,
+		"data:image/png;base64,iVBORw0KGgo=": "data:image/png;base64,iVBORw0KGgo=",
+		"":                                   "",
+		"javascript:alert(1)":                "",
+		"data:text/html;base64,PHNjcmlwdD4=": "",
+		"data:image/svg+xml;base64,PHN2Zz4=": "",
+		"data:image/png;base64,AA==\" onerror=\"x": "",
+	}
+	for value, want := range cases {
+		if got := (Image{Preview: value}).PreviewURL(); string(got) != want {
+			t.Errorf("PreviewURL() of %q == %q, want %q", value, got, want)
+		}
+	}
+}
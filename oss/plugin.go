@@ -37,4 +37,7 @@ func (p *Plugin) OnRegister() {
 	db.Events(p).DBOnInitGorm(func(e *db.DBEvent) {
 		RegisterCallbacks(e.DB.DB)
 	})
+	db.Events(p).DBOnMigrate(func(e *db.DBEvent) error {
+		return e.AutoMigrate(&MediaJob{}).Error
+	})
 }
@@ -0,0 +1,254 @@
+package oss
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"sort"
+	"strings"
+
+	"github.com/ecletus/core"
+	"github.com/ecletus/media"
+)
+
+// StyleSource is a style of the image with its dimensions
+type StyleSource struct {
+	Style  string
+	URL    string
+	Type   string
+	Width  int
+	Height int
+}
+
+// Dimensions return the dimensions of style, computed from the original size by the style fit mode
+func (img Image) Dimensions(style string) (width, height int) {
+	if style == "" || style == IMAGE_STYLE_ORIGNAL {
+		return img.OriginalSize.Width, img.OriginalSize.Height
+	}
+	size, ok := img.GetSizes()[style]
+	if !ok {
+		return
+	}
+	if crop := img.CropOptions[style]; crop != nil && crop.Width > 0 && crop.Height > 0 {
+		return size.OutputSize(crop.Width, crop.Height)
+	}
+	return size.OutputSize(img.OriginalSize.Width, img.OriginalSize.Height)
+}
+
+// styleURL return the full URL of style, or the URL without storage endpoint if ctx is nil
+func (img Image) styleURL(ctx *core.Context, style string) string {
+	var styles []string
+	if style != "" && style != IMAGE_STYLE_ORIGNAL {
+		styles = []string{style}
+	}
+	if ctx == nil {
+		return img.URL(styles...)
+	}
+	return img.FullURL(ctx, styles...)
+}
+
+// Sources return the styles with known width, ordered by width. If styles is empty, uses all
+// styles except the admin preview, and the original. Until the styles are ready, only the original is returned.
+func (img Image) Sources(ctx *core.Context, styles ...string) (sources []*StyleSource) {
+	if img.IsZero() {
+		return
+	}
+	if !img.StylesReady() {
+		styles = []string{IMAGE_STYLE_ORIGNAL}
+	} else if len(styles) == 0 {
+		for style := range img.GetSizes() {
+			if style != IMAGE_STYLE_PREVIEW {
+				styles = append(styles, style)
+			}
+		}
+		styles = append(styles, IMAGE_STYLE_ORIGNAL)
+	}
+	var seen = map[string]bool{}
+	for _, style := range styles {
+		width, height := img.Dimensions(style)
+		if width <= 0 {
+			continue
+		}
+		src := &StyleSource{Style: style, Width: width, Height: height, URL: img.styleURL(ctx, style)}
+		if seen[src.URL] {
+			continue
+		}
+		seen[src.URL] = true
+		src.Type = media.FileTypeFromName(strings.SplitN(src.URL, "?", 2)[0]).MIME
+		sources = append(sources, src)
+	}
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sources[i].Width < sources[j].Width
+	})
+	return
+}
+
+// sameAspect return the sources with the aspect ratio of width x height, up to 2% of difference from
+// rounding, so the browser doesn't pick a crop of other shape. If width or height is unknown, return sources.
+func sameAspect(sources []*StyleSource, width, height int) (result []*StyleSource) {
+	if width <= 0 || height <= 0 {
+		return sources
+	}
+	for _, src := range sources {
+		if src.Height <= 0 {
+			continue
+		}
+		a, b := float64(src.Width*height), float64(width*src.Height)
+		if a >= b*0.98 && a <= b*1.02 {
+			result = append(result, src)
+		}
+	}
+	return
+}
+
+func srcSet(sources []*StyleSource) string {
+	var parts []string
+	for _, src := range sources {
+		parts = append(parts, fmt.Sprintf("%s %dw", src.URL, src.Width))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SrcSet return the `srcset` attribute value of styles
+func (img Image) SrcSet(ctx *core.Context, styles ...string) string {
+	return srcSet(img.Sources(ctx, styles...))
+}
+
+func writeAttrs(b *strings.Builder, attrs ...string) {
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i+1] != "" {
+			fmt.Fprintf(b, ` %s="%s"`, html.EscapeString(attrs[i]), html.EscapeString(attrs[i+1]))
+		}
+	}
+}
+
+func (img Image) imgTag(ctx *core.Context, style, srcset string, attrs []string) string {
+	var (
+		b             strings.Builder
+		width, height = img.Dimensions(style)
+	)
+	b.WriteString("<img")
+	writeAttrs(&b, "src", img.styleURL(ctx, style), "srcset", srcset)
+	if width > 0 && height > 0 {
+		writeAttrs(&b, "width", fmt.Sprint(width), "height", fmt.Sprint(height))
+	}
+	writeAttrs(&b, attrs...)
+	b.WriteString(">")
+	return b.String()
+}
+
+// ImgTag return the `<img>` of style with `srcset` of the styles with the aspect ratio of style, and the `width`
+// and `height` of style. attrs are name and value pairs, like "alt", "Photo", "sizes", "(max-width: 600px) 100vw, 50vw".
+func (img Image) ImgTag(ctx *core.Context, style string, attrs ...string) template.HTML {
+	if img.IsZero() {
+		return ""
+	}
+	width, height := img.Dimensions(style)
+	return template.HTML(img.imgTag(ctx, style, srcSet(sameAspect(img.Sources(ctx), width, height)), attrs))
+}
+
+// PictureTag return the `<picture>` with a `<source>` per style format, and the `<img>` of style as
+// fallback with the styles of same format of style, like PNG for the styles of WebP images. Only the styles
+// with the aspect ratio of style are used.
+func (img Image) PictureTag(ctx *core.Context, style string, attrs ...string) template.HTML {
+	if img.IsZero() {
+		return ""
+	}
+	var (
+		fallbackType = media.FileTypeFromName(strings.SplitN(img.styleURL(ctx, style), "?", 2)[0]).MIME
+		byType       = map[string][]*StyleSource{}
+		types        []string
+		sizes        string
+		b            strings.Builder
+	)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i] == "sizes" {
+			sizes = attrs[i+1]
+		}
+	}
+	width, height := img.Dimensions(style)
+	for _, src := range sameAspect(img.Sources(ctx), width, height) {
+		if _, ok := byType[src.Type]; !ok && src.Type != fallbackType {
+			types = append(types, src.Type)
+		}
+		byType[src.Type] = append(byType[src.Type], src)
+	}
+	sort.Strings(types)
+
+	b.WriteString("<picture>")
+	for _, typ := range types {
+		b.WriteString("<source")
+		writeAttrs(&b, "type", typ, "srcset", srcSet(byType[typ]), "sizes", sizes)
+		b.WriteString(">")
+	}
+	b.WriteString(img.imgTag(ctx, style, srcSet(byType[fallbackType]), attrs))
+	b.WriteString("</picture>")
+	return template.HTML(b.String())
+}
+
+func imageOf(value interface{}) *Image {
+	switch t := value.(type) {
+	case Image:
+		return &t
+	case *Image:
+		return t
+	case ImageInterface:
+		if i, ok := t.(interface{ GetImage() *Image }); ok {
+			return i.GetImage()
+		}
+	}
+	return nil
+}
+
+// GetImage return the image
+func (img *Image) GetImage() *Image {
+	return img
+}
+
+// FuncMap return the template functions of responsive images:
+//
+//	{{image_srcset .Photo}}
+//	{{image_tag .Photo "thumb" "alt" "Photo" "sizes" "50vw"}}
+//	{{image_picture .Photo "thumb" "alt" "Photo"}}
+//	<img src="{{image_preview .Photo}}" data-blurhash="{{image_blurhash .Photo}}">
+//	<div style="background-color: {{image_color .Photo}}">
+func FuncMap(ctx *core.Context) template.FuncMap {
+	return template.FuncMap{
+		"image_srcset": func(value interface{}, styles ...string) string {
+			if img := imageOf(value); img != nil {
+				return img.SrcSet(ctx, styles...)
+			}
+			return ""
+		},
+		"image_tag": func(value interface{}, style string, attrs ...string) template.HTML {
+			if img := imageOf(value); img != nil {
+				return img.ImgTag(ctx, style, attrs...)
+			}
+			return ""
+		},
+		"image_picture": func(value interface{}, style string, attrs ...string) template.HTML {
+			if img := imageOf(value); img != nil {
+				return img.PictureTag(ctx, style, attrs...)
+			}
+			return ""
+		},
+		"image_blurhash": func(value interface{}) string {
+			if img := imageOf(value); img != nil {
+				return img.GetBlurHash()
+			}
+			return ""
+		},
+		"image_color": func(value interface{}) string {
+			if img := imageOf(value); img != nil {
+				return img.GetDominantColor()
+			}
+			return ""
+		},
+		"image_preview": func(value interface{}) template.URL {
+			if img := imageOf(value); img != nil {
+				return img.PreviewURL()
+			}
+			return ""
+		},
+	}
+}
@@ -0,0 +1,93 @@
+package oss
+
+import (
+	"testing"
+
+	"github.com/ecletus/media"
+)
+
+func responsiveImage() Image {
+	return Image{
+		OSS:          OSS{Base: media.Base{Url: "/a.jpg", ContentType: "image/jpeg"}},
+		OriginalSize: Size{Width: 1600, Height: 1200},
+		Sizes: map[string]*Size{
+			"square": {Width: 100, Height: 100},
+			"thumb":  {Width: 200, Height: 150},
+			"large":  {Width: 800, Height: 600, Format: "png"},
+		},
+	}
+}
+
+func TestImageSources(t *testing.T) {
+	img := responsiveImage()
+	sources := img.Sources(nil)
+	want := []StyleSource{
+		{"square", "/a.square.jpg", "image/jpeg", 100, 100},
+		{"thumb", "/a.thumb.jpg", "image/jpeg", 200, 150},
+		{"large", "/a.large.png", "image/png", 800, 600},
+		{IMAGE_STYLE_ORIGNAL, "/a.jpg", "image/jpeg", 1600, 1200},
+	}
+	if len(sources) != len(want) {
+		t.Fatalf("Sources() == %d sources, want %d", len(sources), len(want))
+	}
+	for i, src := range sources {
+		if *src != want[i] {
+			t.Errorf("Sources()[%d] == %+v, want %+v", i, *src, want[i])
+		}
+	}
+
+	if got, want := img.SrcSet(nil, "thumb", "square"), "/a.square.jpg 100w, /a.thumb.jpg 200w"; got != want {
+		t.Errorf("SrcSet() == %q, want %q", got, want)
+	}
+
+	img.ProcessingStatus = PROCESSING_PENDING
+	if got, want := img.SrcSet(nil), "/a.jpg 1600w"; got != want {
+		t.Errorf("SrcSet() of pending styles == %q, want %q", got, want)
+	}
+}
+
+func TestImageTags(t *testing.T) {
+	img := responsiveImage()
+	cases := []struct {
+		html string
+		want string
+	}{
+		{
+			string(img.ImgTag(nil, "thumb", "alt", `"Photo"`)),
+			`<img src="/a.thumb.jpg" srcset="/a.thumb.jpg 200w, /a.large.png 800w, /a.jpg 1600w" width="200" height="150" alt="&#34;Photo&#34;">`,
+		},
+		{
+			string(img.ImgTag(nil, "square")),
+			`<img src="/a.square.jpg" srcset="/a.square.jpg 100w" width="100" height="100">`,
+		},
+		{
+			string(img.PictureTag(nil, "thumb", "sizes", "50vw")),
+			`<picture><source type="image/png" srcset="/a.large.png 800w" sizes="50vw">` +
+				`<img src="/a.thumb.jpg" srcset="/a.thumb.jpg 200w, /a.jpg 1600w" width="200" height="150" sizes="50vw"></picture>`,
+		},
+	}
+	for _, c := range cases {
+		if c.html != c.want {
+			t.Errorf("tag ==\n%s\nwant\n%s", c.html, c.want)
+		}
+	}
+	// the styles of WebP images are PNG, the fallback has the format of style
+	img.Url, img.ContentType = "/a.webp", "image/webp"
+	if got, want := string(img.PictureTag(nil, "thumb")), `<picture><source type="image/webp" srcset="/a.webp 1600w">`+
+		`<img src="/a.thumb.png" srcset="/a.thumb.png 200w, /a.large.png 800w" width="200" height="150"></picture>`; got != want {
+		t.Errorf("PictureTag() of WebP ==\n%s\nwant\n%s", got, want)
+	}
+	if got := (Image{}).ImgTag(nil, "thumb"); got != "" {
+		t.Errorf("ImgTag() of zero image == %q", got)
+	}
+}
+
+func TestSameAspect(t *testing.T) {
+	sources := []*StyleSource{{Width: 100, Height: 100}, {Width: 200, Height: 150}, {Width: 799, Height: 600}, {Width: 300}}
+	if got := sameAspect(sources, 4, 3); len(got) != 2 || got[0] != sources[1] || got[1] != sources[2] {
+		t.Errorf("sameAspect(4x3) == %v", got)
+	}
+	if got := sameAspect(sources, 0, 0); len(got) != len(sources) {
+		t.Errorf("sameAspect of unknown size should return all sources")
+	}
+}
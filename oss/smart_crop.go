@@ -0,0 +1,170 @@
+package oss
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// SmartCropAnalysisSize is the max size of the image copy analyzed by `SmartCrop`
+var SmartCropAnalysisSize = 160
+
+// FocalPoint is the point of interest of image, relative to its size: from 0 (left or top) to 1 (right or bottom)
+type FocalPoint struct {
+	X, Y float64
+}
+
+// FocalPointInterface is implemented by images with focal point
+type FocalPointInterface interface {
+	GetFocalPoint() *FocalPoint
+}
+
+// GetFocalPoint return the focal point. Returns nil if not set.
+func (img *Image) GetFocalPoint() *FocalPoint {
+	return img.FocalPoint
+}
+
+// SetFocalPoint sets the focal point and marks the styles to be cropped again
+func (img *Image) SetFocalPoint(x, y float64) error {
+	if x < 0 || x > 1 || y < 0 || y > 1 {
+		return fmt.Errorf("invalid focal point (%v, %v): the coordinates must be from 0 to 1", x, y)
+	}
+	img.FocalPoint = &FocalPoint{X: x, Y: y}
+	img.Crop = true
+	return nil
+}
+
+// ClearFocalPoint removes the focal point and marks the styles to be cropped again
+func (img *Image) ClearFocalPoint() {
+	img.FocalPoint = nil
+	img.Crop = true
+}
+
+// coverRect return the biggest rectangle of bounds with aspect ratio of width and height.
+// The free axis is returned by horizontal.
+func coverRect(bounds image.Rectangle, width, height int) (rect image.Rectangle, horizontal bool) {
+	sw, sh := bounds.Dx(), bounds.Dy()
+	if sw*height > sh*width {
+		cw := int(math.Round(float64(sh) * float64(width) / float64(height)))
+		return image.Rect(0, 0, cw, sh).Add(bounds.Min), true
+	}
+	ch := int(math.Round(float64(sw) * float64(height) / float64(width)))
+	return image.Rect(0, 0, sw, ch).Add(bounds.Min), false
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// FocalCrop return the crop of bounds with aspect ratio of width and height, centered on the focal point
+func FocalCrop(bounds image.Rectangle, width, height int, focal FocalPoint) image.Rectangle {
+	rect, _ := coverRect(bounds, width, height)
+	var (
+		cx = int(math.Round(focal.X*float64(bounds.Dx()))) - rect.Dx()/2
+		cy = int(math.Round(focal.Y*float64(bounds.Dy()))) - rect.Dy()/2
+	)
+	return rect.Add(image.Pt(clamp(cx, 0, bounds.Dx()-rect.Dx()), clamp(cy, 0, bounds.Dy()-rect.Dy())))
+}
+
+// SmartCrop return the crop of img with aspect ratio of width and height with the highest edge density
+func SmartCrop(img image.Image, width, height int) image.Rectangle {
+	var (
+		bounds           = img.Bounds()
+		rect, horizontal = coverRect(bounds, width, height)
+		free             = bounds.Dy() - rect.Dy()
+	)
+	if horizontal {
+		free = bounds.Dx() - rect.Dx()
+	}
+	if free <= 0 {
+		return rect
+	}
+
+	var (
+		small = imaging.Grayscale(imaging.Fit(img, SmartCropAnalysisSize, SmartCropAnalysisSize, imaging.Box))
+		sb    = small.Bounds()
+		k     = float64(sb.Dx()) / float64(bounds.Dx())
+		n     = sb.Dy()
+	)
+	if horizontal {
+		n = sb.Dx()
+	}
+	// edge magnitude sum by column (or row)
+	lines := make([]float64, n)
+	for y := 1; y < sb.Dy()-1; y++ {
+		for x := 1; x < sb.Dx()-1; x++ {
+			var (
+				gx = float64(small.Pix[small.PixOffset(x+1, y)]) - float64(small.Pix[small.PixOffset(x-1, y)])
+				gy = float64(small.Pix[small.PixOffset(x, y+1)]) - float64(small.Pix[small.PixOffset(x, y-1)])
+				e  = math.Abs(gx) + math.Abs(gy)
+			)
+			if horizontal {
+				lines[x] += e
+			} else {
+				lines[y] += e
+			}
+		}
+	}
+
+	size := rect.Dy()
+	if horizontal {
+		size = rect.Dx()
+	}
+	window := clamp(int(math.Round(float64(size)*k)), 1, n)
+	var (
+		sum, best float64
+		start     int
+		center    = float64(n-window) / 2
+	)
+	for i := 0; i < window; i++ {
+		sum += lines[i]
+	}
+	best = -1
+	for i := 0; i+window <= n; i++ {
+		if i > 0 {
+			sum += lines[i+window-1] - lines[i-1]
+		}
+		// a light bias to center breaks the ties
+		score := sum * (1 - 0.05*math.Abs(float64(i)-center)/math.Max(center, 1))
+		if score > best {
+			best, start = score, i
+		}
+	}
+
+	offset := clamp(int(math.Round(float64(start)/k)), 0, free)
+	if horizontal {
+		return rect.Add(image.Pt(offset, 0))
+	}
+	return rect.Add(image.Pt(0, offset))
+}
+
+// autoCrop return the crop of style without explicit crop option, for the cover fit mode:
+// around the focal point, by the anchor of size, or by `SmartCrop`. Returns nil if the style does not need crop.
+func (cropper *ImageCropper) autoCrop(size *Size, img image.Image) *CropOption {
+	if size == nil || size.GetFit() != FIT_COVER || size.Width <= 0 || size.Height <= 0 {
+		return nil
+	}
+	var bounds = img.Bounds()
+	if bounds.Dx()*size.Height == bounds.Dy()*size.Width {
+		return nil
+	}
+	var rect image.Rectangle
+	if fp, ok := cropper.Image.(FocalPointInterface); ok && fp.GetFocalPoint() != nil {
+		rect = FocalCrop(bounds, size.Width, size.Height, *fp.GetFocalPoint())
+	} else if size.Anchor != "" {
+		// the resize crops by anchor
+		return nil
+	} else {
+		rect = SmartCrop(img, size.Width, size.Height)
+	}
+	rect = rect.Sub(bounds.Min)
+	return &CropOption{X: rect.Min.X, Y: rect.Min.Y, Width: rect.Dx(), Height: rect.Dy()}
+}
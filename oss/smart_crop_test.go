@@ -0,0 +1,32 @@
+package oss
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestFocalCrop(t *testing.T) {
+	bounds := image.Rect(0, 0, 400, 100)
+	if rect := FocalCrop(bounds, 1, 1, FocalPoint{X: 0.9, Y: 0.5}); rect != image.Rect(300, 0, 400, 100) {
+		t.Errorf("FocalCrop right == %v", rect)
+	}
+	if rect := FocalCrop(bounds, 1, 1, FocalPoint{X: 0.25, Y: 0.5}); rect != image.Rect(50, 0, 150, 100) {
+		t.Errorf("FocalCrop == %v", rect)
+	}
+}
+
+func TestSmartCrop(t *testing.T) {
+	// a flat image with details at right
+	img := imaging.New(400, 100, color.White)
+	for x := 300; x < 400; x += 4 {
+		for y := 0; y < 100; y++ {
+			img.Set(x, y, color.Black)
+		}
+	}
+	if rect := SmartCrop(img, 1, 1); rect.Min.X < 250 || rect.Dx() != 100 || rect.Dy() != 100 {
+		t.Errorf("SmartCrop == %v", rect)
+	}
+}
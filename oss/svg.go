@@ -0,0 +1,94 @@
+package oss
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+
+	"github.com/disintegration/imaging"
+	"github.com/ecletus/media"
+	"github.com/ecletus/media/svg"
+	errwrap "github.com/moisespsena-go/error-wrap"
+)
+
+// SVG_PREVIEW_HANDLER is the name of SVG preview handler
+const SVG_PREVIEW_HANDLER = "svg_preview"
+
+// OPT_SVG_PREVIEW rasterizes the SVG images into the preview style, as PNG: `image:"svg_preview"`
+const OPT_SVG_PREVIEW = "image.svg_preview"
+
+// IsSVGPreview return if the SVG images of media have the preview style
+func IsSVGPreview(m media.Media) bool {
+	if opt := m.FieldOption(); opt != nil {
+		return opt.Get(OPT_SVG_PREVIEW) != ""
+	}
+	return false
+}
+
+// svgNamed return if name has the SVG extension, rendered as SVG by browsers whatever the content
+func svgNamed(name string) bool {
+	return media.FileTypeFromName(name).IsSVG()
+}
+
+// sanitizeSVG return r without scripts, event handlers, foreign objects and external references if m is a SVG
+// by content or by file name. The files named as SVG which content isn't a SVG are rejected.
+func sanitizeSVG(m media.Media, r io.Reader) (io.Reader, error) {
+	if !m.GetFileType().IsSVG() && !svgNamed(m.GetFileName()) {
+		return r, nil
+	}
+	var buf bytes.Buffer
+	if err := svg.Sanitize(&buf, r); err != nil {
+		return nil, errwrap.Wrap(err, "Sanitize SVG")
+	}
+	return &buf, nil
+}
+
+// checkSVGURL return error if url has the SVG extension, but the content of m wasn't sanitized by `sanitizeSVG`
+func checkSVGURL(m media.Media, url string) error {
+	if svgNamed(url) && !m.GetFileType().IsSVG() && !svgNamed(m.GetFileName()) {
+		return fmt.Errorf("SVG extension of URL %q for content of type %q", url, m.GetFileType())
+	}
+	return nil
+}
+
+// svgPreviewHandler rasterizes the SVG images with `OPT_SVG_PREVIEW` into the preview style
+type svgPreviewHandler struct{}
+
+func (svgPreviewHandler) CouldHandle(m media.Media) bool {
+	if m.GetFileType().IsSVG() && IsSVGPreview(m) {
+		if im, ok := m.(ImageInterface); ok {
+			return im.IsNew() || im.NeedCrop()
+		}
+	}
+	return false
+}
+
+func (h svgPreviewHandler) Handle(m media.Media, file multipart.File, option *media.Option) (err error) {
+	return h.HandleContext(context.Background(), m, file, option)
+}
+
+func (svgPreviewHandler) HandleContext(ctx context.Context, m media.Media, file multipart.File, option *media.Option) (err error) {
+	var (
+		img  = m.(ImageInterface)
+		size = img.GetSizes()[IMAGE_STYLE_PREVIEW]
+		icon *svg.Icon
+	)
+	if icon, err = svg.Parse(file); err != nil {
+		return errwrap.Wrap(err, "SVG preview")
+	}
+	raster, err := size.Resize(icon.Rasterize(size.Width, size.Height), imaging.PNG)
+	if err != nil {
+		return errwrap.Wrap(err, "SVG preview")
+	}
+	var buf bytes.Buffer
+	if err = imaging.Encode(&buf, raster, imaging.PNG); err != nil {
+		return errwrap.Wrap(err, "SVG preview encode")
+	}
+	return media.Store(ctx, img, media.StorageURL(img, IMAGE_STYLE_PREVIEW), &buf)
+}
+
+func init() {
+	media.RegisterMediaHandler(SVG_PREVIEW_HANDLER, svgPreviewHandler{})
+}
@@ -0,0 +1,51 @@
+package oss
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ecletus/media"
+)
+
+func TestSanitizeSVG(t *testing.T) {
+	const script = `<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`
+	cases := []struct {
+		name, fileName, contentType, data string
+		err                               bool
+	}{
+		{"svg", "a.svg", "image/svg+xml", script, false},
+		{"svg named as other", "a.txt", "image/svg+xml", script, false},
+		{"other named as svg", "a.svg", "text/plain", script, false},
+		{"not svg named as svg", "a.SVG", "image/png", "\x89PNG\r\n\x1a\n", true},
+		{"png", "a.png", "image/png", "\x89PNG\r\n\x1a\n", false},
+	}
+	for _, c := range cases {
+		m := &OSS{Base: media.Base{FileName: c.fileName, ContentType: c.contentType}}
+		r, err := sanitizeSVG(m, strings.NewReader(c.data))
+		if (err != nil) != c.err {
+			t.Errorf("%s: sanitizeSVG() error == %v", c.name, err)
+			continue
+		}
+		if err == nil {
+			data, _ := ioutil.ReadAll(r)
+			if strings.Contains(string(data), "script") {
+				t.Errorf("%s: sanitizeSVG() == %q", c.name, data)
+			}
+		}
+	}
+}
+
+func TestCheckSVGURL(t *testing.T) {
+	png := &OSS{Base: media.Base{FileName: "a.png", ContentType: "image/png"}}
+	if err := checkSVGURL(png, "/system/a.png"); err != nil {
+		t.Errorf("checkSVGURL() of png == %v", err)
+	}
+	if err := checkSVGURL(png, "/system/a.svgz?v=1"); err == nil {
+		t.Errorf("checkSVGURL() of png with svg URL must fail")
+	}
+	svg := &OSS{Base: media.Base{FileName: "a.svg", ContentType: "text/plain"}}
+	if err := checkSVGURL(svg, "/system/a.svg"); err != nil {
+		t.Errorf("checkSVGURL() of file named svg == %v", err)
+	}
+}
@@ -1,11 +1,191 @@
 package oss
 
-import "github.com/ecletus/media"
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"mime/multipart"
+	"os"
+	"time"
+
+	"github.com/ecletus/core"
+	"github.com/ecletus/media"
+	"github.com/ecletus/media/video_info"
+	"github.com/moisespsena-go/aorm"
+)
+
+// VIDEO_INFO_HANDLER is the name of video container metadata handler
+const VIDEO_INFO_HANDLER = "video_info"
+
+// VideoInfoInterface is implemented by videos with container metadata
+type VideoInfoInterface interface {
+	GetInfo() *video_info.Info
+	SetInfo(info *video_info.Info)
+}
 
 type Video struct {
 	OSS
+	// Info is the container metadata of uploaded video, nil if unknown
+	Info *video_info.Info `json:",omitempty"`
+
+	notSqlScan bool
 }
 
 func (Video) FileExts() []string {
 	return media.VideoFormats()
 }
+
+// GetInfo return the container metadata. Returns nil if unknown.
+func (v *Video) GetInfo() *video_info.Info {
+	return v.Info
+}
+
+// SetInfo sets the container metadata
+func (v *Video) SetInfo(info *video_info.Info) {
+	v.Info = info
+}
+
+// GetDuration return the duration, 0 if unknown
+func (v Video) GetDuration() time.Duration {
+	if v.Info == nil {
+		return 0
+	}
+	return v.Info.GetDuration()
+}
+
+// GetWidth return the display width, after the rotation
+func (v Video) GetWidth() int {
+	if v.Info == nil {
+		return 0
+	}
+	w, _ := v.Info.DisplaySize()
+	return w
+}
+
+// GetHeight return the display height, after the rotation
+func (v Video) GetHeight() int {
+	if v.Info == nil {
+		return 0
+	}
+	_, h := v.Info.DisplaySize()
+	return h
+}
+
+// GetAspectRatio return the display width divided by the display height, 0 if unknown
+func (v Video) GetAspectRatio() float64 {
+	if v.Info == nil {
+		return 0
+	}
+	return v.Info.AspectRatio()
+}
+
+// GetCodecs return the video and audio codecs, like "h264" and "aac"
+func (v Video) GetCodecs() (video, audio string) {
+	if v.Info == nil {
+		return
+	}
+	return v.Info.VideoCodec, v.Info.AudioCodec
+}
+
+// GetBitrate return the average bitrate in bits per second
+func (v Video) GetBitrate() int64 {
+	if v.Info == nil {
+		return 0
+	}
+	return v.Info.Bitrate
+}
+
+// GetRotation return the clockwise display rotation in degrees
+func (v Video) GetRotation() int {
+	if v.Info == nil {
+		return 0
+	}
+	return v.Info.Rotation
+}
+
+func (v Video) Value() (driver.Value, error) {
+	return v.DBValue(&v)
+}
+
+func (v *Video) Scan(data interface{}) (err error) {
+	return v.MediaScan(media.NewContext(v), data)
+}
+
+func (v *Video) ContextScan(ctx *core.Context, data interface{}) (err error) {
+	v.notSqlScan = true
+	return media.TranslateError(ctx, v.Set(media.NewContext(v), data))
+}
+
+func (v *Video) Set(ctx *media.Context, data interface{}) (err error) {
+	if !v.isNew {
+		defer func() {
+			if err == nil && v.isNew {
+				v.Info = nil
+			}
+		}()
+	}
+	return v.OSS.Set(ctx, data)
+}
+
+func (v *Video) ScanBytes(ctx *media.Context, data []byte) (err error) {
+	if err = v.OSS.ScanBytes(ctx, data); err != nil {
+		return
+	}
+	if v.HasFile() && !v.Delete {
+		var videoData struct {
+			Info *video_info.Info
+		}
+		// the info is extracted from the stored video, never accepted from forms
+		if err = json.Unmarshal(data, &videoData); err == nil && videoData.Info != nil && !v.notSqlScan {
+			v.Info = videoData.Info
+		}
+	}
+	return
+}
+
+func (v *Video) MediaScan(ctx *media.Context, data interface{}) (err error) {
+	switch values := data.(type) {
+	case []byte:
+		return ctx.Media.ScanBytes(ctx, values)
+	case string:
+		return ctx.Media.ScanBytes(ctx, []byte(values))
+	case *os.File, *multipart.FileHeader:
+		v.Info = nil
+	case []*multipart.FileHeader:
+		if len(values) > 0 {
+			return v.MediaScan(ctx, values[0])
+		}
+		return nil
+	}
+	return v.OSS.MediaScan(ctx, data)
+}
+
+// videoInfoHandler extracts the container metadata of new videos
+type videoInfoHandler struct{}
+
+func (videoInfoHandler) CouldHandle(m media.Media) bool {
+	if m.GetFileType().IsVideo() {
+		if _, ok := m.(VideoInfoInterface); ok {
+			if o, ok := m.(OSSInterface); ok {
+				return o.IsNew()
+			}
+		}
+	}
+	return false
+}
+
+func (h videoInfoHandler) Handle(m media.Media, file multipart.File, option *media.Option) (err error) {
+	return h.HandleContext(context.Background(), m, file, option)
+}
+
+func (videoInfoHandler) HandleContext(ctx context.Context, m media.Media, file multipart.File, option *media.Option) (err error) {
+	// unknown containers does not invalidate the video
+	info, _ := video_info.Parse(file)
+	m.(VideoInfoInterface).SetInfo(info)
+	return nil
+}
+
+func init() {
+	aorm.StructFieldMethodCallbacks.RegisterFieldType(&Video{})
+	media.RegisterMediaHandler(VIDEO_INFO_HANDLER, videoInfoHandler{})
+}
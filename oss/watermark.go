@@ -0,0 +1,166 @@
+package oss
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/disintegration/imaging"
+	"github.com/ecletus/media"
+	"github.com/ecletus/oss"
+	errwrap "github.com/moisespsena-go/error-wrap"
+)
+
+// Watermark is an image drawn over the styles with `Size.Watermark`
+type Watermark struct {
+	// Image is the watermark image. If nil, it is loaded from Media, or from Path of Storage.
+	Image image.Image
+	// Media is the watermark media, like an `Image`
+	Media media.Media
+	// Storage and Path are the watermark file
+	Storage oss.StorageInterface
+	Path    string
+	// Gravity is the position, one of `Size.Anchor` values. Defaults to bottom_right.
+	Gravity string
+	// Margin is the distance from the borders, in pixels
+	Margin int
+	// Opacity is from 0 to 1. If nil, 1.
+	Opacity *float64
+	// Scale is the watermark width relative to the style width, from 0 to 1. If 0, the watermark is not resized.
+	Scale float64
+
+	mu        sync.Mutex
+	loaded    image.Image
+	loadedKey string
+}
+
+var watermarks sync.Map
+
+// RegisterWatermark registers the watermark used by the styles with `Size.Watermark` name
+func RegisterWatermark(name string, wm *Watermark) {
+	watermarks.Store(name, wm)
+}
+
+// GetWatermark return the watermark registered with name
+func GetWatermark(name string) *Watermark {
+	if wm, ok := watermarks.Load(name); ok {
+		return wm.(*Watermark)
+	}
+	return nil
+}
+
+// source return the key of watermark file
+func (wm *Watermark) source() string {
+	switch {
+	case wm.Media != nil && !wm.Media.IsZero():
+		return "media:" + wm.Media.URL()
+	case wm.Storage != nil && wm.Path != "":
+		return "storage:" + wm.Path
+	}
+	return ""
+}
+
+// Load return the watermark image, loading it once per source: the Media URL or the Path. A file replaced
+// keeping its URL or Path is loaded again only after `Reset`.
+func (wm *Watermark) Load(ctx context.Context) (img image.Image, err error) {
+	if wm.Image != nil {
+		return wm.Image, nil
+	}
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	key := wm.source()
+	if wm.loaded != nil && wm.loadedKey == key {
+		return wm.loaded, nil
+	}
+
+	var file *os.File
+	switch {
+	case key == "":
+		return nil, fmt.Errorf("watermark without image")
+	case wm.Media != nil && !wm.Media.IsZero():
+		file, err = media.Retrieve(ctx, wm.Media, wm.Media.URL())
+	default:
+		file, err = wm.Storage.Get(wm.Path)
+	}
+	if err != nil {
+		return nil, errwrap.Wrap(err, "Watermark retrieve")
+	}
+	defer file.Close()
+	if img, err = imaging.Decode(file); err != nil {
+		return nil, errwrap.Wrap(err, "Watermark decode")
+	}
+	wm.loaded, wm.loadedKey = img, key
+	return
+}
+
+// Reset drops the loaded watermark image, so it is loaded again
+func (wm *Watermark) Reset() {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	wm.loaded, wm.loadedKey = nil, ""
+}
+
+// Apply draws the watermark over dst
+func (wm *Watermark) Apply(ctx context.Context, dst image.Image) (image.Image, error) {
+	mark, err := wm.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gravity := strings.ToLower(wm.Gravity)
+	if gravity == "" {
+		gravity = "bottom_right"
+	}
+	anchor, ok := anchors[gravity]
+	if !ok {
+		return nil, fmt.Errorf("invalid watermark gravity %q", wm.Gravity)
+	}
+
+	bounds := dst.Bounds()
+	if wm.Scale > 0 {
+		mark = imaging.Resize(mark, int(math.Max(1, math.Round(float64(bounds.Dx())*wm.Scale))), 0, imaging.Lanczos)
+	}
+	var (
+		mb  = mark.Bounds()
+		pos = anchorPoint(anchor, bounds.Dx(), bounds.Dy(), mb.Dx(), mb.Dy())
+	)
+	switch anchor {
+	case imaging.TopLeft, imaging.Left, imaging.BottomLeft:
+		pos.X += wm.Margin
+	case imaging.TopRight, imaging.Right, imaging.BottomRight:
+		pos.X -= wm.Margin
+	}
+	switch anchor {
+	case imaging.TopLeft, imaging.Top, imaging.TopRight:
+		pos.Y += wm.Margin
+	case imaging.BottomLeft, imaging.Bottom, imaging.BottomRight:
+		pos.Y -= wm.Margin
+	}
+
+	opacity := 1.0
+	if wm.Opacity != nil {
+		if opacity = *wm.Opacity; opacity < 0 || opacity > 1 {
+			return nil, fmt.Errorf("invalid watermark opacity %v", opacity)
+		}
+	}
+	return imaging.Overlay(dst, mark, pos.Add(bounds.Min), opacity), nil
+}
+
+// watermark draws the watermark of size over img. The original is never watermarked.
+func (cropper *ImageCropper) watermark(key string, img image.Image, size *Size) (image.Image, error) {
+	if size == nil || size.Watermark == "" || key == IMAGE_STYLE_ORIGNAL {
+		return img, nil
+	}
+	wm := GetWatermark(size.Watermark)
+	if wm == nil {
+		return nil, fmt.Errorf("watermark %q of style %q not registered", size.Watermark, key)
+	}
+	result, err := wm.Apply(cropper.ctx, img)
+	if err != nil {
+		return nil, errwrap.Wrap(err, "Watermark %q of style %q", size.Watermark, key)
+	}
+	return result, nil
+}
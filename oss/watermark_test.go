@@ -0,0 +1,43 @@
+package oss
+
+import (
+	"context"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestWatermarkApply(t *testing.T) {
+	var (
+		dst     = imaging.New(100, 50, color.White)
+		opacity = 0.5
+		wm      = &Watermark{Image: imaging.New(10, 10, color.Black), Margin: 5, Scale: 0.2, Opacity: &opacity}
+	)
+	img, err := wm.Apply(context.Background(), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// scaled to 20x20, at bottom right with margin 5: from (75, 25) to (95, 45)
+	if r, _, _, _ := img.At(85, 35).RGBA(); r>>8 < 120 || r>>8 > 135 {
+		t.Errorf("watermark pixel == %v", img.At(85, 35))
+	}
+	for _, p := range [][2]int{{74, 35}, {96, 35}, {85, 24}, {85, 46}} {
+		if r, _, _, _ := img.At(p[0], p[1]).RGBA(); r>>8 != 255 {
+			t.Errorf("pixel %v == %v", p, img.At(p[0], p[1]))
+		}
+	}
+
+	// an explicit 0 is transparent, not the default
+	opacity = 0
+	if img, err = wm.Apply(context.Background(), dst); err != nil {
+		t.Fatal(err)
+	}
+	if r, _, _, _ := img.At(85, 35).RGBA(); r>>8 != 255 {
+		t.Errorf("transparent watermark pixel == %v", img.At(85, 35))
+	}
+	opacity = 2
+	if _, err = wm.Apply(context.Background(), dst); err == nil {
+		t.Errorf("Apply() of invalid opacity should fail")
+	}
+}
@@ -1,9 +1,13 @@
 package reader_provider
 
 import (
+	"fmt"
 	"io"
+	"mime"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
@@ -29,6 +33,16 @@ type HTTPReaderProvider struct {
 	URL     string
 	Timeout time.Duration
 	Get     func(client *http.Client, url string) (r *http.Response, err error)
+	// PublicOnly accepts only http and https URLs of public addresses. The address is checked on connect,
+	// after the DNS resolution, so the redirects and DNS rebinding to private addresses are blocked too.
+	PublicOnly bool
+	// MaxRedirects is the max number of redirects, 10 if 0. Negative disables the redirects.
+	MaxRedirects int
+	// MaxSize is the max number of bytes read, unlimited if 0. The reader returns ErrTooLarge if exceeded.
+	MaxSize int64
+	// ContentTypes are the accepted media types, all if empty. The types ending with "/", like "image/",
+	// accepts all subtypes.
+	ContentTypes []string
 }
 
 func (p *HTTPReaderProvider) GetReader() (r io.ReadCloser, err error) {
@@ -37,23 +51,35 @@ func (p *HTTPReaderProvider) GetReader() (r io.ReadCloser, err error) {
 		timeout = 5 * time.Second
 	}
 
+	if p.PublicOnly {
+		if err = checkScheme(p.URL); err != nil {
+			return
+		}
+	}
+
 	var (
+		dialer = &net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: timeout,
+		}
 		netTransport = &http.Transport{
-			DialContext: (&net.Dialer{
-				Timeout:   timeout,
-				KeepAlive: timeout,
-			}).DialContext,
+			DialContext:         dialer.DialContext,
 			TLSHandshakeTimeout: timeout,
 		}
 		netClient = &http.Client{
-			Timeout:   timeout,
-			Transport: netTransport,
+			Timeout:       timeout,
+			Transport:     netTransport,
+			CheckRedirect: p.checkRedirect,
 		}
 
 		response *http.Response
 		get      = p.Get
 	)
 
+	if p.PublicOnly {
+		dialer.Control = publicOnlyControl
+	}
+
 	if get == nil {
 		get = func(client *http.Client, url string) (r *http.Response, err error) {
 			return netClient.Get(url)
@@ -62,14 +88,94 @@ func (p *HTTPReaderProvider) GetReader() (r io.ReadCloser, err error) {
 	if response, err = get(netClient, p.URL); err != nil {
 		return
 	}
-	return &HTTPReader{response.Body, netClient}, nil
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		response.Body.Close()
+		return nil, &StatusError{p.URL, response.StatusCode}
+	}
+	if err = p.checkResponse(response); err != nil {
+		response.Body.Close()
+		return
+	}
+	body := response.Body
+	if p.MaxSize > 0 {
+		body = &maxSizeReader{body, p.MaxSize}
+	}
+	return &HTTPReader{body, netClient, response}, nil
+}
+
+func (p *HTTPReaderProvider) checkRedirect(req *http.Request, via []*http.Request) error {
+	max := p.MaxRedirects
+	if max == 0 {
+		max = 10
+	}
+	if len(via) > max {
+		return fmt.Errorf("stopped after %d redirects", len(via)-1)
+	}
+	if p.PublicOnly {
+		return checkScheme(req.URL.String())
+	}
+	return nil
+}
+
+// checkResponse checks the content type and content length of response
+func (p *HTTPReaderProvider) checkResponse(response *http.Response) error {
+	if p.MaxSize > 0 && response.ContentLength > p.MaxSize {
+		return ErrTooLarge
+	}
+	if len(p.ContentTypes) == 0 {
+		return nil
+	}
+	typ, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	for _, accepted := range p.ContentTypes {
+		if typ == accepted || (strings.HasSuffix(accepted, "/") && strings.HasPrefix(typ, accepted)) {
+			return nil
+		}
+	}
+	return &ContentTypeError{p.URL, typ}
+}
+
+func checkScheme(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	return nil
+}
+
+// StatusError is returned by HTTPReaderProvider for responses without success status
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("GET %s: unexpected status %d", err.URL, err.StatusCode)
+}
+
+// ContentTypeError is returned by HTTPReaderProvider for responses without accepted content type
+type ContentTypeError struct {
+	URL         string
+	ContentType string
+}
+
+func (err *ContentTypeError) Error() string {
+	return fmt.Sprintf("GET %s: unaccepted content type %q", err.URL, err.ContentType)
 }
 
 type HTTPReader struct {
 	io.ReadCloser
-	client *http.Client
+	client   *http.Client
+	response *http.Response
 }
 
 func (r *HTTPReader) Client() *http.Client {
 	return r.client
 }
+
+// Response return the HTTP response. The body must be read by reader, that honours MaxSize.
+func (r *HTTPReader) Response() *http.Response {
+	return r.response
+}
@@ -0,0 +1,96 @@
+package reader_provider
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	for ip, public := range map[string]bool{
+		"8.8.8.8":         true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+		"::ffff:10.0.0.1": false,
+		"64:ff9b::a00:1":  false,
+	} {
+		if got := IsPublicIP(net.ParseIP(ip)); got != public {
+			t.Errorf("%s: expected %v", ip, public)
+		}
+	}
+}
+
+func TestHTTPReaderProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(strings.Repeat("x", 100)))
+		case "/html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<html></html>"))
+		case "/redirect":
+			http.Redirect(w, r, "/image", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	read := func(p *HTTPReaderProvider) (data []byte, err error) {
+		r, err := p.GetReader()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+
+	if data, err := read(&HTTPReaderProvider{URL: server.URL + "/redirect", ContentTypes: []string{"image/"}, MaxSize: 100}); err != nil || len(data) != 100 {
+		t.Errorf("expected 100 bytes, got %d, %v", len(data), err)
+	}
+
+	var ct *ContentTypeError
+	if _, err := read(&HTTPReaderProvider{URL: server.URL + "/html", ContentTypes: []string{"image/"}}); !errors.As(err, &ct) || ct.ContentType != "text/html" {
+		t.Errorf("expected content type error, got %v", err)
+	}
+
+	if _, err := read(&HTTPReaderProvider{URL: server.URL + "/image", MaxSize: 99}); err != ErrTooLarge {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+
+	// without content length
+	p := &HTTPReaderProvider{URL: server.URL + "/image", MaxSize: 50, Get: func(client *http.Client, url string) (*http.Response, error) {
+		res, err := client.Get(url)
+		if err == nil {
+			res.ContentLength = -1
+		}
+		return res, err
+	}}
+	if _, err := read(p); err != ErrTooLarge {
+		t.Errorf("expected ErrTooLarge on read, got %v", err)
+	}
+
+	if _, err := read(&HTTPReaderProvider{URL: server.URL + "/redirect", MaxRedirects: -1}); err == nil {
+		t.Error("expected redirect error")
+	}
+
+	if _, err := read(&HTTPReaderProvider{URL: server.URL + "/image", PublicOnly: true}); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("expected ErrPrivateAddress, got %v", err)
+	}
+
+	if _, err := read(&HTTPReaderProvider{URL: "file:///etc/passwd", PublicOnly: true}); err == nil {
+		t.Error("expected scheme error")
+	}
+}
@@ -0,0 +1,81 @@
+package reader_provider
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+var (
+	ErrTooLarge       = errors.New("reader_provider: content too large")
+	ErrPrivateAddress = errors.New("reader_provider: connection to non public address")
+)
+
+// nonPublicNetworks are the reserved networks not covered by the net.IP methods
+var nonPublicNetworks = func() (networks []*net.IPNet) {
+	for _, cidr := range []string{
+		"0.0.0.0/8",       // this network
+		"100.64.0.0/10",   // carrier grade NAT
+		"192.0.0.0/24",    // IETF protocol assignments
+		"192.0.2.0/24",    // documentation
+		"198.18.0.0/15",   // benchmarking
+		"198.51.100.0/24", // documentation
+		"203.0.113.0/24",  // documentation
+		"240.0.0.0/4",     // reserved and broadcast
+		"64:ff9b::/96",    // NAT64, could map to private IPv4
+		"64:ff9b:1::/48",  // local NAT64
+		"2001:db8::/32",   // documentation
+	} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return
+}()
+
+// IsPublicIP return if ip is a public unicast address: not loopback, private, link local, multicast,
+// unspecified or reserved
+func IsPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// publicOnlyControl is the net.Dialer control that blocks the connections to non public addresses
+func publicOnlyControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !IsPublicIP(net.ParseIP(host)) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// maxSizeReader returns ErrTooLarge if more than remaining bytes are read
+type maxSizeReader struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (r *maxSizeReader) Read(p []byte) (n int, err error) {
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err = r.ReadCloser.Read(p)
+	if r.remaining -= int64(n); r.remaining < 0 {
+		return n + int(r.remaining), ErrTooLarge
+	}
+	return
+}
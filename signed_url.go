@@ -0,0 +1,197 @@
+package media
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ecletus/core"
+	"github.com/ecletus/core/helpers"
+	"github.com/ecletus/oss"
+)
+
+// Signed URL query params
+const (
+	SIGNED_URL_EXPIRES   = "expires"
+	SIGNED_URL_STYLE     = "style"
+	SIGNED_URL_STYLES    = "styles"
+	SIGNED_URL_SIGNATURE = "signature"
+)
+
+var (
+	ErrSignatureInvalid = errors.New("invalid media URL signature")
+	ErrSignatureExpired = errors.New("media URL signature expired")
+	ErrStyleNotAllowed  = errors.New("media style not allowed by signature")
+	ErrNoSiteSecret     = errors.New("media URL secret of site not registered")
+)
+
+var siteSecrets sync.Map
+
+// RegisterSiteSecret registers the secret used to sign the media URLs of site
+func RegisterSiteSecret(siteName string, secret []byte) {
+	siteSecrets.Store(siteName, secret)
+}
+
+// GetSiteSecret return the secret used to sign the media URLs of site
+func GetSiteSecret(siteName string) ([]byte, error) {
+	if secret, ok := siteSecrets.Load(siteName); ok {
+		return secret.([]byte), nil
+	}
+	return nil, ErrNoSiteSecret
+}
+
+// SignOptions are the restrictions of a signed URL
+type SignOptions struct {
+	// Expires is the expiration time of the signature
+	Expires time.Time
+	// Styles are the styles accessible with the signature, the original file is accessible only if URL_STYLE_ORIGINAL
+	// is listed. If empty, the original and all styles are accessible.
+	Styles []string
+}
+
+func signature(secret []byte, pth string, expires int64, styles, style string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(path.Clean("/" + pth)))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	mac.Write([]byte{0})
+	mac.Write([]byte(styles))
+	mac.Write([]byte{0})
+	mac.Write([]byte(style))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignURL signs pth, the stored url of style, or of original file if style is blank. See `StorageURL`.
+func SignURL(secret []byte, pth, style string, opt SignOptions) string {
+	var (
+		styles = strings.Join(opt.Styles, ",")
+		query  = url.Values{}
+	)
+	query.Set(SIGNED_URL_EXPIRES, strconv.FormatInt(opt.Expires.Unix(), 10))
+	if styles != "" {
+		query.Set(SIGNED_URL_STYLES, styles)
+	}
+	if style != "" {
+		query.Set(SIGNED_URL_STYLE, style)
+	}
+	query.Set(SIGNED_URL_SIGNATURE, signature(secret, pth, opt.Expires.Unix(), styles, style))
+	return pth + "?" + query.Encode()
+}
+
+// VerifySignedURL verifies the signature of the requested pth and return its style, blank for the original file
+func VerifySignedURL(secret []byte, pth string, query url.Values) (style string, err error) {
+	expires, err := strconv.ParseInt(query.Get(SIGNED_URL_EXPIRES), 10, 64)
+	if err != nil {
+		return "", ErrSignatureInvalid
+	}
+
+	var styles = query.Get(SIGNED_URL_STYLES)
+	style = query.Get(SIGNED_URL_STYLE)
+
+	expected := signature(secret, pth, expires, styles, style)
+	if !hmac.Equal([]byte(expected), []byte(query.Get(SIGNED_URL_SIGNATURE))) {
+		return "", ErrSignatureInvalid
+	}
+	if time.Now().Unix() > expires {
+		return "", ErrSignatureExpired
+	}
+	if styles != "" {
+		allowed := style
+		if allowed == "" {
+			allowed = URL_STYLE_ORIGINAL
+		}
+		for _, s := range strings.Split(styles, ",") {
+			if s == allowed {
+				return
+			}
+		}
+		return "", ErrStyleNotAllowed
+	}
+	return
+}
+
+// SignedURL return the signed url of stored style of media, using the secret of media site
+func SignedURL(m Media, style string, opt SignOptions) (string, error) {
+	if m.IsZero() {
+		return "", nil
+	}
+	if m.Site() == nil {
+		return "", ErrNoSiteSecret
+	}
+	secret, err := GetSiteSecret(m.Site().Name())
+	if err != nil {
+		return "", err
+	}
+	return SignURL(secret, StorageURL(m, style), style, opt), nil
+}
+
+// FullSignedURL is like `SignedURL`, with the storage endpoint
+func FullSignedURL(ctx *core.Context, m Media, style string, opt SignOptions) (url string, err error) {
+	if url, err = SignedURL(m, style, opt); err != nil || url == "" {
+		return
+	}
+	if url = helpers.GetStorageEndpointFromContext(ctx, m.Storage()) + url; strings.HasPrefix(url, "/") {
+		return
+	}
+	return MediaURL(url), nil
+}
+
+// SignedURLHandler serves the files of Storage requested by signed urls
+type SignedURLHandler struct {
+	Storage oss.StorageInterface
+	// SiteName is the site of secret
+	SiteName string
+	// StripPrefix is removed from request path before verify it
+	StripPrefix string
+}
+
+func (h *SignedURLHandler) verify(r *http.Request) (pth string, status int) {
+	secret, err := GetSiteSecret(h.SiteName)
+	if err != nil {
+		return "", http.StatusInternalServerError
+	}
+	pth = strings.TrimPrefix(r.URL.Path, h.StripPrefix)
+	if _, err = VerifySignedURL(secret, pth, r.URL.Query()); err != nil {
+		return "", http.StatusForbidden
+	}
+	return pth, http.StatusOK
+}
+
+func (h *SignedURLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pth, status := h.verify(r)
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	file, err := h.Storage.Get(pth)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+	var modTime time.Time
+	if stat, err := file.Stat(); err == nil {
+		modTime = stat.ModTime()
+	}
+	w.Header().Set("Cache-Control", "private")
+	http.ServeContent(w, r, path.Base(pth), modTime, file)
+}
+
+// Middleware returns a handler that calls next only if the request has a valid signature
+func (h *SignedURLHandler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, status := h.verify(r); status != http.StatusOK {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,89 @@
+package media
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedURL(t *testing.T) {
+	var (
+		secret = []byte("secret")
+		opt    = SignOptions{Expires: time.Now().Add(time.Hour), Styles: []string{"thumb"}}
+	)
+
+	verify := func(signed string) (string, error) {
+		u, err := url.Parse(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return VerifySignedURL(secret, u.Path, u.Query())
+	}
+
+	if _, err := verify(SignURL(secret, "/system/a/b.jpg", "", opt)); err != ErrStyleNotAllowed {
+		t.Errorf("original error == %v, want %v", err, ErrStyleNotAllowed)
+	}
+	if style, err := verify(SignURL(secret, "/system/a/b.thumb.jpg", "thumb", opt)); err != nil || style != "thumb" {
+		t.Errorf("thumb == %q, %v", style, err)
+	}
+	if _, err := verify(SignURL(secret, "/system/a/b.big.jpg", "big", opt)); err != ErrStyleNotAllowed {
+		t.Errorf("big style error == %v, want %v", err, ErrStyleNotAllowed)
+	}
+	if _, err := verify(strings.Replace(SignURL(secret, "/system/a/b.thumb.jpg", "thumb", opt), "styles=thumb", "styles=big", 1)); err != ErrSignatureInvalid {
+		t.Errorf("changed styles error == %v, want %v", err, ErrSignatureInvalid)
+	}
+
+	opt.Styles = []string{"thumb", URL_STYLE_ORIGINAL}
+	if style, err := verify(SignURL(secret, "/system/a/b.jpg", "", opt)); err != nil || style != "" {
+		t.Errorf("original == %q, %v", style, err)
+	}
+	opt.Styles = nil
+	if style, err := verify(SignURL(secret, "/system/a/b.big.jpg", "big", opt)); err != nil || style != "big" {
+		t.Errorf("big without styles restriction == %q, %v", style, err)
+	}
+	// the signature of style isn't valid for other style
+	if _, err := verify(strings.Replace(SignURL(secret, "/system/a/b.big.jpg", "big", opt), "style=big", "style=thumb", 1)); err != ErrSignatureInvalid {
+		t.Errorf("changed style error == %v, want %v", err, ErrSignatureInvalid)
+	}
+	if _, err := verify(strings.Replace(SignURL(secret, "/system/a/b.jpg", "", opt), "/b.jpg", "/c.jpg", 1)); err != ErrSignatureInvalid {
+		t.Errorf("other path error == %v, want %v", err, ErrSignatureInvalid)
+	}
+	opt.Expires = time.Now().Add(-time.Second)
+	if _, err := verify(SignURL(secret, "/system/a/b.jpg", "", opt)); err != ErrSignatureExpired {
+		t.Errorf("expired error == %v, want %v", err, ErrSignatureExpired)
+	}
+}
+
+// pngStylesMedia is a WebP media which styles are PNG
+type pngStylesMedia struct {
+	Base
+}
+
+func (m pngStylesMedia) StorageURL(style string) string {
+	if style == "" {
+		return m.Url
+	}
+	return strings.TrimSuffix(MediaStyleURL(m.Url, style), ".webp") + ".png"
+}
+
+func TestSignedURLOfStorageURL(t *testing.T) {
+	var (
+		secret = []byte("secret")
+		m      = &pngStylesMedia{Base{Url: "/system/a/b.webp"}}
+		opt    = SignOptions{Expires: time.Now().Add(time.Hour), Styles: []string{"thumb"}}
+	)
+	u, err := url.Parse(SignURL(secret, StorageURL(m, "thumb"), "thumb", opt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/system/a/b.thumb.png" {
+		t.Errorf("path == %q, want the stored style", u.Path)
+	}
+	if style, err := VerifySignedURL(secret, u.Path, u.Query()); err != nil || style != "thumb" {
+		t.Errorf("VerifySignedURL() == %q, %v", style, err)
+	}
+	if _, err := VerifySignedURL(secret, "/system/a/b.thumb.webp", u.Query()); err != ErrSignatureInvalid {
+		t.Errorf("other path error == %v, want %v", err, ErrSignatureInvalid)
+	}
+}
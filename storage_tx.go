@@ -0,0 +1,345 @@
+package media
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/moisespsena-go/aorm"
+	errwrap "github.com/moisespsena-go/error-wrap"
+)
+
+// STAGING_DIR is the directory of objects stored by uncommitted transactions
+var STAGING_DIR = "/system/.staging"
+
+var (
+	E_STORAGE_TX       = PKG + ":storage_tx"
+	E_STORAGE_TX_CHECK = PKG + ":storage_tx_check"
+	E_STORAGE_TX_BEGIN = PKG + ":storage_tx_begin"
+	DB_STORAGE_TX      = PKG + ".storage_tx"
+)
+
+// ErrStorageTxCallbacks is returned by the storage of medias saved without the storage transaction callbacks,
+// that would never move the staged files into place
+var ErrStorageTxCallbacks = errors.New("media: the storage transaction callbacks aren't registered, call media.RegisterCallbacks")
+
+type storageTxContextKey struct{}
+
+type stagedObject struct {
+	media   Media
+	url     string
+	staging string
+}
+
+type deferredRemoval struct {
+	media Media
+	url   string
+}
+
+// StorageTx stages the storage writes and defers the storage removals of a DB transaction.
+// On commit, the staged objects are moved into place and the removals are done.
+// On rollback, the staged objects are removed.
+type StorageTx struct {
+	mu       sync.Mutex
+	id       string
+	staged   []*stagedObject
+	removals []*deferredRemoval
+	done     bool
+	// committing is set by the first commit, a partially committed transaction can't be rolled back
+	committing bool
+	// owner is the scope that finishes the transaction automatically
+	owner *aorm.Scope
+	// sqlTx is the DB transaction began by owner, shared by the scopes of nested operations
+	sqlTx interface{}
+	// direct is set for the DB transactions began outside of the callbacks, without `BeginStorageTx`: the objects
+	// are stored and removed directly, like without transaction
+	direct bool
+	// err is returned by the storage operations, like ErrStorageTxCallbacks
+	err error
+}
+
+// NewStorageTx creates a new storage transaction
+func NewStorageTx() *StorageTx {
+	var b [16]byte
+	rand.Read(b[:])
+	return &StorageTx{id: hex.EncodeToString(b[:])}
+}
+
+// StagingURL return the temporary url where url is stored until commit
+func (tx *StorageTx) StagingURL(url string) string {
+	return path.Join(STAGING_DIR, tx.id, url)
+}
+
+// Store stores reader into the staging url of url. The object staged before for url is removed.
+func (tx *StorageTx) Store(ctx context.Context, media Media, url string, reader io.Reader) (err error) {
+	if tx.err != nil {
+		return tx.err
+	}
+	if tx.direct {
+		return storeNow(ctx, media, url, reader)
+	}
+	tx.mu.Lock()
+	var earlier *stagedObject
+	for i, obj := range tx.staged {
+		if obj.url == url {
+			earlier = obj
+			tx.staged = append(tx.staged[:i], tx.staged[i+1:]...)
+			break
+		}
+	}
+	tx.mu.Unlock()
+
+	if earlier != nil {
+		if _, err = removeNow(ctx, earlier.media, earlier.staging); err != nil {
+			return errwrap.Wrap(err, "Remove staged %q", url)
+		}
+	}
+	staging := tx.StagingURL(url)
+	if err = storeNow(ctx, media, staging, reader); err != nil {
+		return
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.staged = append(tx.staged, &stagedObject{media, url, staging})
+	return
+}
+
+// Remove defers the removal of url until commit. The urls staged by tx are replaced by the staged objects,
+// not removed, and found is true. For other urls found is false, the removal is done by commit.
+func (tx *StorageTx) Remove(media Media, url string) (found bool, err error) {
+	if tx.err != nil {
+		return false, tx.err
+	}
+	if tx.direct {
+		return removeNow(context.Background(), media, url)
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	for _, obj := range tx.staged {
+		if obj.url == url {
+			found = true
+			break
+		}
+	}
+	tx.removals = append(tx.removals, &deferredRemoval{media, url})
+	return
+}
+
+// Commit moves the staged objects into place and removes the deferred removals. On failure, the other objects
+// are still committed and the error reports the failed urls, which are kept for a new call of Commit.
+func (tx *StorageTx) Commit(ctx context.Context) (err error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return
+	}
+	tx.committing = true
+
+	var (
+		staged   = map[string]bool{}
+		failed   []string
+		firstErr error
+		pending  []*stagedObject
+		removals []*deferredRemoval
+	)
+	fail := func(url string, err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+		failed = append(failed, url)
+	}
+	for _, obj := range tx.staged {
+		staged[obj.url] = true
+		if err = moveObject(ctx, obj.media, obj.staging, obj.url); err != nil {
+			fail(obj.url, err)
+			pending = append(pending, obj)
+		}
+	}
+	for _, r := range tx.removals {
+		// replaced by a new object
+		if staged[r.url] {
+			continue
+		}
+		if _, err = removeNow(ctx, r.media, r.url); err != nil {
+			fail(r.url, err)
+			removals = append(removals, r)
+		}
+	}
+	tx.staged, tx.removals = pending, removals
+	if firstErr != nil {
+		return errwrap.Wrap(firstErr, "Commit %s", strings.Join(failed, ", "))
+	}
+	tx.done = true
+	return nil
+}
+
+// Rollback removes the staged objects and discards the deferred removals. A transaction partially committed
+// can't be rolled back.
+func (tx *StorageTx) Rollback(ctx context.Context) (err error) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return
+	}
+	if tx.committing {
+		return errors.New("media: rollback of partially committed storage transaction")
+	}
+	tx.done = true
+	for _, obj := range tx.staged {
+		if _, err = removeNow(ctx, obj.media, obj.staging); err != nil {
+			return errwrap.Wrap(err, "Remove staged %q", obj.url)
+		}
+	}
+	return
+}
+
+// Finish commits tx if err is nil, otherwise rollbacks tx
+func (tx *StorageTx) Finish(ctx context.Context, err error) error {
+	if err != nil {
+		return tx.Rollback(ctx)
+	}
+	return tx.Commit(ctx)
+}
+
+func moveObject(ctx context.Context, media Media, from, to string) (err error) {
+	file, err := Retrieve(ctx, media, from)
+	if err != nil {
+		return
+	}
+	err = storeNow(ctx, media, to, file)
+	file.Close()
+	if err != nil {
+		return
+	}
+	_, err = removeNow(ctx, media, from)
+	return
+}
+
+// WithStorageTx returns ctx with tx, so `Store` and `Remove` are done in tx
+func WithStorageTx(ctx context.Context, tx *StorageTx) context.Context {
+	if tx == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, storageTxContextKey{}, tx)
+}
+
+// StorageTxFromContext return the storage transaction of ctx
+func StorageTxFromContext(ctx context.Context) *StorageTx {
+	tx, _ := ctx.Value(storageTxContextKey{}).(*StorageTx)
+	return tx
+}
+
+// BeginStorageTx sets a new storage transaction into db. Use it when db is an outer transaction,
+// then call `Finish` after the DB transaction commits or rollbacks.
+func BeginStorageTx(db *aorm.DB) (*aorm.DB, *StorageTx) {
+	tx := NewStorageTx()
+	return db.Set(DB_STORAGE_TX, tx), tx
+}
+
+// StorageTxOf return the storage transaction of scope, set by the storage transaction callbacks. Without the
+// callbacks, the storage operations of returned transaction fails with ErrStorageTxCallbacks.
+func StorageTxOf(scope *aorm.Scope) *StorageTx {
+	if v, ok := scope.Get(DB_STORAGE_TX); ok {
+		if tx, ok := v.(*StorageTx); ok && tx != nil {
+			return tx
+		}
+	}
+	tx := NewStorageTx()
+	tx.err = ErrStorageTxCallbacks
+	scope.Set(DB_STORAGE_TX, tx)
+	return tx
+}
+
+// ScopeContext return the context of scope with its storage transaction
+func ScopeContext(scope *aorm.Scope) context.Context {
+	return WithStorageTx(ContextOf(scope), StorageTxOf(scope))
+}
+
+// IsStagingURL return if url is an object of uncommitted transaction
+func IsStagingURL(url string) bool {
+	return strings.HasPrefix(url, STAGING_DIR+"/")
+}
+
+// sqlTxs are the storage transactions of DB transactions began by the scopes
+var sqlTxs sync.Map
+
+func isSQLTx(db interface{}) bool {
+	_, ok := db.(interface {
+		Commit() error
+		Rollback() error
+	})
+	return ok
+}
+
+// checkStorageTx runs before the scope begins its DB transaction, and sets the storage transaction finished by
+// the scope. Inside a DB transaction began by other scope, like the saving of associations, the storage
+// transaction of that scope is used. Inside a DB transaction began outside of the callbacks, without
+// `BeginStorageTx`, the objects are stored and removed directly: there is no callback of its commit.
+func checkStorageTx(scope *aorm.Scope) {
+	if _, ok := scope.Get(DB_STORAGE_TX); ok {
+		return
+	}
+	sqlDB := scope.SQLDB()
+	if isSQLTx(sqlDB) {
+		if tx, ok := sqlTxs.Load(sqlDB); ok {
+			scope.Set(DB_STORAGE_TX, tx)
+			return
+		}
+	}
+	tx := NewStorageTx()
+	tx.owner = scope
+	tx.direct = isSQLTx(sqlDB)
+	scope.Set(DB_STORAGE_TX, tx)
+}
+
+// beginStorageTx runs after the scope begins its DB transaction, so the nested scopes share its storage transaction
+func beginStorageTx(scope *aorm.Scope) {
+	sqlDB := scope.SQLDB()
+	if !isSQLTx(sqlDB) {
+		return
+	}
+	if tx := StorageTxOf(scope); tx.owner == scope && !tx.direct && tx.sqlTx == nil {
+		tx.sqlTx = sqlDB
+		sqlTxs.Store(sqlDB, tx)
+	}
+}
+
+func finishStorageTx(scope *aorm.Scope) {
+	v, ok := scope.Get(DB_STORAGE_TX)
+	if !ok {
+		return
+	}
+	tx, _ := v.(*StorageTx)
+	// the settings are copied into scopes of nested operations, only the scope that began tx finishes it.
+	// Transactions began by `BeginStorageTx` are finished by the caller.
+	if tx == nil || tx.owner != scope {
+		return
+	}
+	if tx.sqlTx != nil {
+		sqlTxs.Delete(tx.sqlTx)
+	}
+	var dbErr error
+	if scope.HasError() {
+		dbErr = scope.DB().Error
+	}
+	if err := tx.Finish(ContextOf(scope), dbErr); err != nil {
+		scope.Err(errwrap.Wrap(err, "Storage transaction"))
+	}
+}
+
+func registerStorageTxCallbacks(db *aorm.DB) {
+	db.Callback().Create().Before("aorm:begin_transaction").Register(E_STORAGE_TX_CHECK, checkStorageTx)
+	db.Callback().Update().Before("aorm:begin_transaction").Register(E_STORAGE_TX_CHECK, checkStorageTx)
+	db.Callback().Delete().Before("aorm:begin_transaction").Register(E_STORAGE_TX_CHECK, checkStorageTx)
+	db.Callback().Create().After("aorm:begin_transaction").Register(E_STORAGE_TX_BEGIN, beginStorageTx)
+	db.Callback().Update().After("aorm:begin_transaction").Register(E_STORAGE_TX_BEGIN, beginStorageTx)
+	db.Callback().Delete().After("aorm:begin_transaction").Register(E_STORAGE_TX_BEGIN, beginStorageTx)
+	db.Callback().Create().After("aorm:commit_or_rollback_transaction").Register(E_STORAGE_TX, finishStorageTx)
+	db.Callback().Update().After("aorm:commit_or_rollback_transaction").Register(E_STORAGE_TX, finishStorageTx)
+	db.Callback().Delete().After("aorm:commit_or_rollback_transaction").Register(E_STORAGE_TX, finishStorageTx)
+}
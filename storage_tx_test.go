@@ -0,0 +1,207 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// memMedia is a media which storage is kept in memory
+type memMedia struct {
+	Media
+	files     map[string]string
+	failStore map[string]bool
+}
+
+func newMemMedia() *memMedia {
+	return &memMedia{files: map[string]string{}, failStore: map[string]bool{}}
+}
+
+func (m *memMedia) Store(url string, reader io.Reader) error {
+	if m.failStore[url] {
+		return errors.New("store failed")
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	m.files[url] = string(data)
+	return nil
+}
+
+func (m *memMedia) Retrieve(url string) (*os.File, error) {
+	data, ok := m.files[url]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	file, err := ioutil.TempFile("", "media")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(file.Name())
+	file.WriteString(data)
+	file.Seek(0, io.SeekStart)
+	return file, nil
+}
+
+func (m *memMedia) Remove(url string) (found bool, err error) {
+	_, found = m.files[url]
+	delete(m.files, url)
+	return
+}
+
+func TestStorageTxCommit(t *testing.T) {
+	var (
+		ctx = context.Background()
+		m   = newMemMedia()
+		tx  = NewStorageTx()
+	)
+	m.files["/old.jpg"] = "old"
+	m.files["/replaced.jpg"] = "replaced"
+
+	if err := tx.Store(ctx, m, "/new.jpg", strings.NewReader("new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Store(ctx, m, "/replaced.jpg", strings.NewReader("replacement")); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := tx.Remove(m, "/old.jpg"); found || err != nil {
+		t.Errorf("Remove() of committed object == %v, %v", found, err)
+	}
+	if found, err := tx.Remove(m, "/replaced.jpg"); !found || err != nil {
+		t.Errorf("Remove() of staged object == %v, %v", found, err)
+	}
+	if _, ok := m.files["/new.jpg"]; ok || m.files[tx.StagingURL("/new.jpg")] != "new" {
+		t.Errorf("new object should be staged until commit: %v", m.files)
+	}
+	if _, ok := m.files["/old.jpg"]; !ok {
+		t.Errorf("removal should be deferred until commit")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"/new.jpg": "new", "/replaced.jpg": "replacement"}
+	if len(m.files) != len(want) {
+		t.Errorf("files after commit == %v, want %v", m.files, want)
+	}
+	for url, data := range want {
+		if m.files[url] != data {
+			t.Errorf("files[%q] == %q, want %q", url, m.files[url], data)
+		}
+	}
+}
+
+func TestStorageTxRollback(t *testing.T) {
+	var (
+		ctx = context.Background()
+		m   = newMemMedia()
+		tx  = NewStorageTx()
+	)
+	m.files["/old.jpg"] = "old"
+	tx.Store(ctx, m, "/new.jpg", strings.NewReader("new"))
+	tx.Remove(m, "/old.jpg")
+	if err := tx.Finish(ctx, errors.New("db error")); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.files) != 1 || m.files["/old.jpg"] != "old" {
+		t.Errorf("files after rollback == %v", m.files)
+	}
+	if err := tx.Commit(ctx); err != nil || len(m.files) != 1 {
+		t.Errorf("commit after rollback should do nothing: %v, %v", err, m.files)
+	}
+}
+
+func TestStorageTxStoreOverwrite(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		first  = newMemMedia()
+		second = newMemMedia()
+		tx     = NewStorageTx()
+	)
+	tx.Store(ctx, first, "/a.jpg", strings.NewReader("first"))
+	if err := tx.Store(ctx, second, "/a.jpg", strings.NewReader("second")); err != nil {
+		t.Fatal(err)
+	}
+	if len(first.files) != 0 {
+		t.Errorf("earlier staged object should be removed: %v", first.files)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(second.files) != 1 || second.files["/a.jpg"] != "second" {
+		t.Errorf("files after commit == %v", second.files)
+	}
+}
+
+func TestStorageTxPartialCommit(t *testing.T) {
+	var (
+		ctx = context.Background()
+		m   = newMemMedia()
+		tx  = NewStorageTx()
+	)
+	m.files["/old.jpg"] = "old"
+	tx.Store(ctx, m, "/a.jpg", strings.NewReader("a"))
+	tx.Store(ctx, m, "/b.jpg", strings.NewReader("b"))
+	tx.Remove(m, "/old.jpg")
+	m.failStore["/b.jpg"] = true
+
+	err := tx.Commit(ctx)
+	if err == nil || !strings.Contains(err.Error(), "/b.jpg") {
+		t.Fatalf("Commit() == %v, want error of /b.jpg", err)
+	}
+	if m.files["/a.jpg"] != "a" || m.files[tx.StagingURL("/b.jpg")] != "b" {
+		t.Errorf("other objects should be committed and the failed kept staged: %v", m.files)
+	}
+	if _, ok := m.files["/old.jpg"]; ok {
+		t.Errorf("removals should be done")
+	}
+	if err = tx.Rollback(ctx); err == nil {
+		t.Errorf("rollback of partially committed transaction should fail")
+	}
+
+	delete(m.failStore, "/b.jpg")
+	if err = tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.files) != 2 || m.files["/b.jpg"] != "b" {
+		t.Errorf("files after retry == %v", m.files)
+	}
+}
+
+func TestStorageTxError(t *testing.T) {
+	var (
+		ctx = WithStorageTx(context.Background(), &StorageTx{err: ErrStorageTxCallbacks})
+		m   = newMemMedia()
+	)
+	if err := Store(ctx, m, "/a.jpg", strings.NewReader("a")); err != ErrStorageTxCallbacks {
+		t.Errorf("Store() == %v, want ErrStorageTxCallbacks", err)
+	}
+	if _, err := Remove(ctx, m, "/a.jpg"); err != ErrStorageTxCallbacks {
+		t.Errorf("Remove() == %v, want ErrStorageTxCallbacks", err)
+	}
+	if len(m.files) != 0 {
+		t.Errorf("files == %v", m.files)
+	}
+}
+
+func TestStorageTxDirect(t *testing.T) {
+	var (
+		ctx = WithStorageTx(context.Background(), &StorageTx{direct: true})
+		m   = newMemMedia()
+	)
+	m.files["/old.jpg"] = "old"
+	if err := Store(ctx, m, "/a.jpg", strings.NewReader("a")); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := Remove(ctx, m, "/old.jpg"); !found || err != nil {
+		t.Errorf("Remove() == %v, %v", found, err)
+	}
+	if len(m.files) != 1 || m.files["/a.jpg"] != "a" {
+		t.Errorf("objects should be stored and removed directly: %v", m.files)
+	}
+}
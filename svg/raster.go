@@ -0,0 +1,66 @@
+package svg
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+// MaxRasterSize is the max width and height of rasterized images
+var MaxRasterSize = 4096
+
+// Icon is a parsed SVG, for rasterization
+type Icon struct {
+	icon *oksvg.SvgIcon
+}
+
+// Parse parses the SVG or gzipped SVG of r. The unsupported elements are ignored.
+func Parse(r io.Reader) (*Icon, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1F, 0x8B}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("svg: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+	icon, err := oksvg.ReadIconStream(r, oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, fmt.Errorf("svg: %v", err)
+	}
+	return &Icon{icon}, nil
+}
+
+// Size return the size of view box
+func (i *Icon) Size() (width, height float64) {
+	return i.icon.ViewBox.W, i.icon.ViewBox.H
+}
+
+// Rasterize return the image of icon scaled to cover width and height, keeping the aspect ratio.
+// The image is limited to `MaxRasterSize`.
+func (i *Icon) Rasterize(width, height int) *image.RGBA {
+	vw, vh := i.Size()
+	if vw <= 0 || vh <= 0 {
+		vw, vh = float64(width), float64(height)
+	}
+	k := math.Max(float64(width)/vw, float64(height)/vh)
+	if max := float64(MaxRasterSize); vw*k > max || vh*k > max {
+		k = math.Min(max/vw, max/vh)
+	}
+	w, h := int(math.Max(1, math.Round(vw*k))), int(math.Max(1, math.Round(vh*k)))
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	i.icon.SetTarget(0, 0, float64(w), float64(h))
+	i.icon.Draw(rasterx.NewDasher(w, h, rasterx.NewScannerGV(w, h, img, img.Bounds())), 1)
+	return img
+}
@@ -0,0 +1,29 @@
+package svg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRasterize(t *testing.T) {
+	icon, err := Parse(strings.NewReader(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 20 10">
+<rect x="0" y="0" width="10" height="10" fill="#ff0000"/>
+</svg>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := icon.Size(); w != 20 || h != 10 {
+		t.Fatalf("size == %vx%v", w, h)
+	}
+
+	img := icon.Rasterize(100, 100)
+	if img.Bounds().Dx() != 200 || img.Bounds().Dy() != 100 {
+		t.Fatalf("bounds == %v", img.Bounds())
+	}
+	if c := img.RGBAAt(50, 50); c.R != 255 || c.A != 255 {
+		t.Errorf("left color == %v", c)
+	}
+	if c := img.RGBAAt(150, 50); c.A != 0 {
+		t.Errorf("right color == %v", c)
+	}
+}
@@ -0,0 +1,281 @@
+// Package svg sanitizes SVG images, removing the contents that runs scripts or loads external resources.
+package svg
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrNotSVG   = errors.New("svg: root element isn't svg")
+	ErrEmpty    = errors.New("svg: no root element")
+	ErrTooLarge = errors.New("svg: decompressed svgz is too large")
+)
+
+// MaxDecompressedSize is the max size of decompressed svgz
+var MaxDecompressedSize int64 = 32 << 20
+
+// limitedReader reads up to n bytes, and fails with ErrTooLarge if r has more
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (n int, err error) {
+	if l.n < 0 {
+		return 0, ErrTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err = l.r.Read(p)
+	if l.n -= int64(n); l.n < 0 {
+		return n + int(l.n), ErrTooLarge
+	}
+	return
+}
+
+// DangerousElements are the elements removed with its children
+var DangerousElements = map[string]bool{
+	"script":        true,
+	"foreignobject": true,
+	"iframe":        true,
+	"embed":         true,
+	"object":        true,
+	"audio":         true,
+	"video":         true,
+	"canvas":        true,
+	"handler":       true,
+	"listener":      true,
+	"base":          true,
+	"link":          true,
+	"meta":          true,
+}
+
+var animationElements = map[string]bool{
+	"set":              true,
+	"animate":          true,
+	"animatecolor":     true,
+	"animatemotion":    true,
+	"animatetransform": true,
+}
+
+var (
+	safeDataURIRegexp = regexp.MustCompile(`^data:image/(png|jpe?g|gif|webp)[;,]`)
+	cssURLRegexp      = regexp.MustCompile(`url\(\s*(['"]?)([^'")]*)`)
+	spacesRegexp      = regexp.MustCompile(`[\x00-\x20]+`)
+)
+
+// safeReference return if ref is a local fragment or an embedded raster image
+func safeReference(ref string) bool {
+	ref = strings.ToLower(spacesRegexp.ReplaceAllString(ref, ""))
+	return ref == "" || strings.HasPrefix(ref, "#") || safeDataURIRegexp.MatchString(ref)
+}
+
+// unsafeValue return if value has script URIs, CSS expressions or imports, or external urls
+func unsafeValue(value string) bool {
+	v := strings.ToLower(spacesRegexp.ReplaceAllString(value, ""))
+	for _, s := range []string{"javascript:", "vbscript:", "expression(", "@import", "-moz-binding", "behavior:"} {
+		if strings.Contains(v, s) {
+			return true
+		}
+	}
+	for _, m := range cssURLRegexp.FindAllStringSubmatch(value, -1) {
+		if !safeReference(m[2]) {
+			return true
+		}
+	}
+	return false
+}
+
+func localName(name xml.Name) string {
+	return strings.ToLower(name.Local)
+}
+
+func qualifiedName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+// safeAttr return if the attribute is kept
+func safeAttr(attr xml.Attr) bool {
+	switch local := localName(attr.Name); {
+	case strings.HasPrefix(local, "on"):
+		return false
+	case local == "href" || local == "src":
+		return safeReference(attr.Value)
+	}
+	return !unsafeValue(attr.Value)
+}
+
+// safeElement return if the element is kept
+func safeElement(el xml.StartElement) bool {
+	name := localName(el.Name)
+	if DangerousElements[name] {
+		return false
+	}
+	if animationElements[name] {
+		// animations could set event handlers and links
+		for _, attr := range el.Attr {
+			if localName(attr.Name) == "attributename" {
+				target := strings.ToLower(strings.TrimSpace(attr.Value))
+				if i := strings.IndexByte(target, ':'); i >= 0 {
+					target = target[i+1:]
+				}
+				if strings.HasPrefix(target, "on") || target == "href" || target == "src" || target == "style" {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func writeEscaped(w *bufio.Writer, s string) error {
+	return xml.EscapeText(w, []byte(s))
+}
+
+// Sanitize writes the SVG of r to w without scripts, event handler attributes, foreign objects, external
+// references, comments and doctype. Gzipped SVG (svgz) is written gzipped. Returns error if r isn't a
+// well formed SVG.
+func Sanitize(w io.Writer, r io.Reader) (err error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1F, 0x8B}) {
+		var (
+			zr *gzip.Reader
+			zw = gzip.NewWriter(w)
+		)
+		if zr, err = gzip.NewReader(br); err != nil {
+			return fmt.Errorf("svg: %v", err)
+		}
+		defer zr.Close()
+		lr := &limitedReader{zr, MaxDecompressedSize}
+		if err = sanitize(zw, lr); lr.n < 0 {
+			return ErrTooLarge
+		} else if err != nil {
+			return
+		}
+		return zw.Close()
+	}
+	return sanitize(w, br)
+}
+
+func sanitize(dst io.Writer, r io.Reader) (err error) {
+	var (
+		d     = xml.NewDecoder(r)
+		w     = bufio.NewWriter(dst)
+		stack []xml.Name
+		// skip is the depth of removed element, 0 if not removing
+		skip int
+		root bool
+		// inStyle is the buffer of style element text
+		inStyle *bytes.Buffer
+	)
+	d.Strict = true
+
+	for {
+		var token xml.Token
+		if token, err = d.RawToken(); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("svg: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 {
+				if root {
+					return errors.New("svg: multiple root elements")
+				}
+				if localName(t.Name) != "svg" {
+					return ErrNotSVG
+				}
+				root = true
+			}
+			stack = append(stack, t.Name)
+			if skip > 0 {
+				skip++
+				continue
+			}
+			if !safeElement(t) {
+				skip = 1
+				continue
+			}
+			w.WriteString("<" + qualifiedName(t.Name))
+			for _, attr := range t.Attr {
+				if safeAttr(attr) {
+					w.WriteString(" " + qualifiedName(attr.Name) + `="`)
+					writeEscaped(w, attr.Value)
+					w.WriteString(`"`)
+				}
+			}
+			w.WriteString(">")
+			if localName(t.Name) == "style" {
+				inStyle = &bytes.Buffer{}
+			}
+		case xml.EndElement:
+			if len(stack) == 0 || stack[len(stack)-1] != t.Name {
+				return fmt.Errorf("svg: unexpected end element </%s> on line %d", qualifiedName(t.Name), lineOf(d))
+			}
+			stack = stack[:len(stack)-1]
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if inStyle != nil {
+				if !unsafeValue(inStyle.String()) {
+					writeEscaped(w, inStyle.String())
+				}
+				inStyle = nil
+			}
+			w.WriteString("</" + qualifiedName(t.Name) + ">")
+		case xml.CharData:
+			switch {
+			case len(stack) == 0:
+				if len(bytes.TrimSpace(t)) > 0 {
+					return fmt.Errorf("svg: text outside of root element on line %d", lineOf(d))
+				}
+			case skip > 0:
+			case inStyle != nil:
+				inStyle.Write(t)
+			default:
+				writeEscaped(w, string(t))
+			}
+		case xml.ProcInst:
+			if t.Target == "xml" && len(stack) == 0 && !root {
+				w.WriteString("<?xml " + string(t.Inst) + "?>")
+			}
+		}
+		// comments and directives (like DOCTYPE with entities) are removed
+	}
+	if !root {
+		return ErrEmpty
+	}
+	if len(stack) > 0 {
+		return fmt.Errorf("svg: unclosed element <%s>", qualifiedName(stack[len(stack)-1]))
+	}
+	return w.Flush()
+}
+
+func lineOf(d *xml.Decoder) int {
+	line, _ := d.InputPos()
+	return line
+}
+
+// SanitizeBytes return the sanitized SVG of data
+func SanitizeBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := Sanitize(&buf, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
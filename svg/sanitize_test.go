@@ -0,0 +1,101 @@
+package svg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	const input = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN" "http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd">
+<!-- comment -->
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 10 10" onload="alert(1)">
+	<script type="text/javascript">alert(2)</script>
+	<defs><linearGradient id="g"><stop offset="0" stop-color="red"/></linearGradient></defs>
+	<rect width="10" height="10" fill="url(#g)" onclick="alert(3)" style="fill: url(http://evil/x.svg#a)"/>
+	<a xlink:href="javascript:alert(4)"><circle r="2" /></a>
+	<use href="#g"/>
+	<use xlink:href="http://evil/sprite.svg#icon"/>
+	<image href="data:image/png;base64,AAAA"/>
+	<image href="data:image/svg+xml;base64,AAAA"/>
+	<foreignObject><div xmlns="http://www.w3.org/1999/xhtml"><script>alert(5)</script></div></foreignObject>
+	<set attributeName="onmouseover" to="alert(6)"/>
+	<animate attributeName="opacity" from="0" to="1"/>
+	<style>@import url(http://evil/x.css);</style>
+	<style>rect { fill: blue }</style>
+	<text>a &lt; b</text>
+</svg>`
+	out, err := SanitizeBytes([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := string(out)
+	for _, unsafe := range []string{"alert", "script", "onload", "onclick", "javascript", "evil", "foreignObject", "svg+xml", "DOCTYPE", "comment", "<set"} {
+		if strings.Contains(result, unsafe) {
+			t.Errorf("sanitized SVG contains %q:\n%s", unsafe, result)
+		}
+	}
+	for _, safe := range []string{`<?xml version="1.0" encoding="UTF-8"?>`, `fill="url(#g)"`, `<use href="#g">`, `data:image/png;base64,AAAA`,
+		`<animate attributeName="opacity"`, `rect { fill: blue }`, `a &lt; b`, `xmlns:xlink="http://www.w3.org/1999/xlink"`, `<circle r="2"></circle>`} {
+		if !strings.Contains(result, safe) {
+			t.Errorf("sanitized SVG without %q:\n%s", safe, result)
+		}
+	}
+
+	// the result is a valid SVG
+	if _, err = SanitizeBytes(out); err != nil {
+		t.Errorf("sanitized SVG is invalid: %v", err)
+	}
+}
+
+func TestSanitizeInvalid(t *testing.T) {
+	for name, input := range map[string]string{
+		"not svg":    `<html><body></body></html>`,
+		"empty":      ``,
+		"unclosed":   `<svg><g></svg>`,
+		"unbalanced": `<svg><g></svg></g>`,
+		"entity":     `<!DOCTYPE svg [<!ENTITY x "y">]><svg>&x;</svg>`,
+		"two roots":  `<svg></svg><svg></svg>`,
+		"text":       `<svg></svg>text`,
+	} {
+		if _, err := SanitizeBytes([]byte(input)); err == nil {
+			t.Errorf("%s: invalid SVG accepted", name)
+		}
+	}
+}
+
+func TestSanitizeGzip(t *testing.T) {
+	var in bytes.Buffer
+	zw := gzip.NewWriter(&in)
+	zw.Write([]byte(`<svg onload="alert(1)"><rect/></svg>`))
+	zw.Close()
+
+	out, err := SanitizeBytes(in.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(zr)
+	if string(data) != `<svg><rect></rect></svg>` {
+		t.Errorf("sanitized svgz == %q", data)
+	}
+}
+
+func TestSanitizeGzipTooLarge(t *testing.T) {
+	defer func(max int64) { MaxDecompressedSize = max }(MaxDecompressedSize)
+	MaxDecompressedSize = 1024
+
+	var in bytes.Buffer
+	zw := gzip.NewWriter(&in)
+	zw.Write([]byte(`<svg>` + strings.Repeat(`<rect/>`, 1000) + `</svg>`))
+	zw.Close()
+	if _, err := SanitizeBytes(in.Bytes()); err != ErrTooLarge {
+		t.Errorf("SanitizeBytes() of large svgz == %v, want %v", err, ErrTooLarge)
+	}
+}
@@ -0,0 +1,280 @@
+package media
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/ecletus/core"
+	"github.com/ecletus/core/utils"
+	"github.com/gosimple/slug"
+	"github.com/jinzhu/inflection"
+	"github.com/moisespsena-go/aorm"
+)
+
+// OPT_URL is the URL template of field: `media:"url:/system/{{class}}/{{year}}/{{month}}/{{uuid}}.{{extension}}"`
+const OPT_URL = FIELD_TAG_NAME + ".url"
+
+// URL_STYLE_ORIGINAL is the value of `{{style}}` when rendering the stored URL
+const URL_STYLE_ORIGINAL = "original"
+
+// URL_STYLE_PLACEHOLDER is the value of `{{style}}` when rendering the URL of styles, replaced by the style name
+// in `StyleURL`
+const URL_STYLE_PLACEHOLDER = "{{style}}"
+
+// URLTemplateError is the error of an invalid URL template
+type URLTemplateError struct {
+	Template string
+	Err      error
+}
+
+func (e *URLTemplateError) Error() string {
+	return fmt.Sprintf("media URL template %q: %v", e.Template, e.Err)
+}
+
+// URLTemplateContext is the data used to render the URL template placeholders
+type URLTemplateContext struct {
+	Scope    *aorm.Scope
+	Field    *aorm.Field
+	Site     *core.Site
+	Option   *Option
+	FileName string
+	SHA256   string
+	// Style is the value of `{{style}}`, defaults to URL_STYLE_ORIGINAL
+	Style string
+	// Time is the value of `{{year}}`, `{{month}}` and `{{day}}`, defaults to now
+	Time time.Time
+
+	uuid string
+}
+
+func (c *URLTemplateContext) getUUID() string {
+	if c.uuid == "" {
+		var b [16]byte
+		rand.Read(b[:])
+		b[6] = (b[6] & 0x0f) | 0x40
+		b[8] = (b[8] & 0x3f) | 0x80
+		c.uuid = fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	}
+	return c.uuid
+}
+
+func (c *URLTemplateContext) funcMap() template.FuncMap {
+	var (
+		filename     = c.FileName
+		hash         = func() string { return strings.Replace(c.Time.Format("20060102150506.000000000"), ".", "", -1) }
+		slugFileName = func() string {
+			return slug.Make(strings.TrimSuffix(path.Base(filename), path.Ext(filename)))
+		}
+		contentHash = func() (string, error) {
+			if c.SHA256 == "" {
+				return "", errors.New("content hash not computed")
+			}
+			return c.SHA256, nil
+		}
+	)
+	return template.FuncMap{
+		"class":       func() string { return inflection.Plural(utils.ToParamString(c.Scope.Struct().Type.Name())) },
+		"primary_key": func() string { return fmt.Sprintf("%v", c.Scope.PrimaryKey()) },
+		"primary_key_path": func() string {
+			var b = base64.RawURLEncoding.EncodeToString(c.Scope.Instance().ID().Bytes())
+			var parts = []string{}
+			for i := 0; len(b) > (2+i) && len(parts) < 3; i++ {
+				parts = append(parts, b[0:2+i])
+				b = b[2+i:]
+			}
+			if len(b) > 0 {
+				parts = append(parts, b)
+			}
+			return strings.Join(parts, "/")
+		},
+		"column":   func() string { return strings.ToLower(c.Field.Name) },
+		"filename": func() string { return filename },
+		"filename_slug": func() string {
+			return urlReplacer.ReplaceAllString(slugFileName()+path.Ext(filename), "-")
+		},
+		"basename": func() string { return strings.TrimSuffix(path.Base(filename), path.Ext(filename)) },
+		"hash":     hash,
+		"filename_with_hash": func() string {
+			return urlReplacer.ReplaceAllString(fmt.Sprintf("%s.%v%v", slugFileName(), hash(), path.Ext(filename)), "-")
+		},
+		"extension": func() string { return strings.TrimPrefix(path.Ext(filename), ".") },
+		"sha256":    contentHash,
+		"content_hash_path": func() (string, error) {
+			sum, err := contentHash()
+			if err != nil {
+				return "", err
+			}
+			return ContentHashPath(sum), nil
+		},
+		"site": func() (string, error) {
+			if c.Site == nil {
+				return "", errors.New("site not defined")
+			}
+			return c.Site.Name(), nil
+		},
+		"year":  func() string { return c.Time.Format("2006") },
+		"month": func() string { return c.Time.Format("01") },
+		"day":   func() string { return c.Time.Format("02") },
+		"uuid":  c.getUUID,
+		"style": func() string { return c.Style },
+		"field_option": func(name string) string {
+			if c.Option == nil {
+				return ""
+			}
+			value := c.Option.Get(name)
+			if value == "" && !strings.Contains(name, ".") {
+				value = c.Option.Get(FIELD_TAG_NAME + "." + name)
+			}
+			return value
+		},
+		"field": func(name string) (string, error) {
+			field, ok := c.Scope.FieldByName(name)
+			if !ok {
+				return "", fmt.Errorf("field %q not found", name)
+			}
+			return slug.Make(fmt.Sprint(field.Field.Interface())), nil
+		},
+	}
+}
+
+var urlTemplates sync.Map
+
+// ParseURLTemplate parses and validates the URL template. Parsed templates are cached.
+func ParseURLTemplate(text string) (*template.Template, error) {
+	if tmpl, ok := urlTemplates.Load(text); ok {
+		return tmpl.(*template.Template), nil
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, &URLTemplateError{text, errors.New("empty template")}
+	}
+	tmpl, err := template.New("url").Funcs((&URLTemplateContext{}).funcMap()).Parse(text)
+	if err != nil {
+		return nil, &URLTemplateError{text, err}
+	}
+	urlTemplates.Store(text, tmpl)
+	return tmpl, nil
+}
+
+// RenderURLTemplate renders the URL template
+func RenderURLTemplate(text string, ctx *URLTemplateContext) (url string, err error) {
+	tmpl, err := ParseURLTemplate(text)
+	if err != nil {
+		return
+	}
+	if tmpl, err = tmpl.Clone(); err != nil {
+		return
+	}
+	if ctx.Style == "" {
+		ctx.Style = URL_STYLE_ORIGINAL
+	}
+	if ctx.Time.IsZero() {
+		ctx.Time = time.Now()
+	}
+	var (
+		result = bytes.NewBufferString("")
+		data   interface{}
+	)
+	if ctx.Scope != nil {
+		data = ctx.Scope.Value
+	}
+	if err = tmpl.Funcs(ctx.funcMap()).Execute(result, data); err != nil {
+		return "", &URLTemplateError{text, err}
+	}
+	if url = result.String(); url == "" {
+		return "", &URLTemplateError{text, errors.New("empty URL")}
+	}
+	return
+}
+
+// RenderStyleURLTemplate renders the URL template, and the URL of styles if the template has the `{{style}}`
+// placeholder, with the same values of placeholders
+func RenderStyleURLTemplate(text string, ctx *URLTemplateContext) (url, styleURL string, err error) {
+	if url, err = RenderURLTemplate(text, ctx); err != nil || !strings.Contains(text, "style") {
+		return
+	}
+	styleCtx := *ctx
+	styleCtx.Style = URL_STYLE_PLACEHOLDER
+	if styleURL, err = RenderURLTemplate(text, &styleCtx); err != nil || styleURL == url {
+		styleURL = ""
+	}
+	return
+}
+
+// StyleURLGetter is implemented by medias rendering the URL of styles from the `{{style}}` placeholder
+type StyleURLGetter interface {
+	GetStyleURL(scope *aorm.Scope, field *aorm.Field, templater URLTemplater) (url, styleURL string, err error)
+}
+
+// ValidateURLTemplate validates the URL template of templater, the outer media. The `Init` of OSS medias calls it.
+func (b *Base) ValidateURLTemplate(templater URLTemplater) error {
+	_, b.urlTemplateErr = ParseURLTemplate(templater.GetURLTemplate(b.fieldOption))
+	return b.urlTemplateErr
+}
+
+// GetURLTemplateError return the URL template error found by `ValidateURLTemplate`
+func (b *Base) GetURLTemplateError() error {
+	return b.urlTemplateErr
+}
+
+// GetURL get default URL for a model based on its options. The template of templater is validated when rendered.
+func (b Base) GetURL(scope *aorm.Scope, field *aorm.Field, templater URLTemplater) (url string, err error) {
+	url, _, err = b.GetStyleURL(scope, field, templater)
+	return
+}
+
+// GetStyleURL get default URL, and the URL of styles if the template has the `{{style}}` placeholder
+func (b Base) GetStyleURL(scope *aorm.Scope, field *aorm.Field, templater URLTemplater) (url, styleURL string, err error) {
+	return RenderStyleURLTemplate(templater.GetURLTemplate(b.fieldOption), &URLTemplateContext{
+		Scope:    scope,
+		Field:    field,
+		Site:     b.site,
+		Option:   b.fieldOption,
+		FileName: b.GetFileName(),
+		SHA256:   b.SHA256,
+	})
+}
+
+// PreviewURL renders the URL of the record field without store anything.
+// If fileName is blank, uses the current file name of field. If style is given, returns the URL of style,
+// derived from the URL like `URL(style)`.
+func PreviewURL(db *aorm.DB, record interface{}, fieldName, fileName string, style ...string) (url string, err error) {
+	scope := db.NewScope(record)
+	field, ok := scope.FieldByName(fieldName)
+	if !ok {
+		return "", fmt.Errorf("field %q not found", fieldName)
+	}
+	m, ok := field.Field.Addr().Interface().(Media)
+	if !ok {
+		return "", fmt.Errorf("field %q isn't a media", fieldName)
+	}
+	m.Init(core.GetSiteFromDB(db), field)
+	if fileName == "" {
+		fileName = m.GetFileName()
+	}
+	ctx := &URLTemplateContext{
+		Scope:    scope,
+		Field:    field,
+		Site:     m.Site(),
+		Option:   m.FieldOption(),
+		FileName: fileName,
+	}
+	if ca, ok := m.(ContentAddresser); ok {
+		ctx.SHA256 = ca.GetSHA256()
+	}
+	var styleURL string
+	if url, styleURL, err = RenderStyleURLTemplate(m.GetURLTemplate(m.FieldOption()), ctx); err != nil {
+		return
+	}
+	if len(style) > 0 && style[0] != "" {
+		url = StyleURL(url, styleURL, style[0])
+	}
+	return
+}
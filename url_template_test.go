@@ -0,0 +1,109 @@
+package media
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderURLTemplate(t *testing.T) {
+	var (
+		sum = "ab12cd34ef"
+		tm  = time.Date(2020, 3, 7, 0, 0, 0, 0, time.UTC)
+	)
+	cases := map[string]string{
+		"/{{filename}}":                        "/My Photo.JPG",
+		"/{{basename}}.{{extension}}":          "/My Photo.JPG",
+		"/{{filename_slug}}":                   "/my-photo.JPG",
+		"/{{year}}/{{month}}/{{day}}/a":        "/2020/03/07/a",
+		"/{{style}}/{{sha256}}":                "/original/ab12cd34ef",
+		"/{{content_hash_path}}.{{extension}}": "/ab/12/ab12cd34ef.JPG",
+		`/{{field_option "storage"}}/a`:        "/private/a",
+		`/{{field_option "media.storage"}}/a`:  "/private/a",
+		`/{{field_option "missing"}}/a`:        "//a",
+	}
+	for text, want := range cases {
+		url, err := RenderURLTemplate(text, &URLTemplateContext{
+			FileName: "My Photo.JPG",
+			SHA256:   sum,
+			Time:     tm,
+			Option:   &Option{"MEDIA.STORAGE": "private"},
+		})
+		if err != nil || url != want {
+			t.Errorf("RenderURLTemplate(%q) == %q, %v, want %q", text, url, err, want)
+		}
+	}
+
+	url, err := RenderURLTemplate("/{{uuid}}/{{uuid}}", &URLTemplateContext{})
+	if err != nil || !regexp.MustCompile(`^/([0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12})/([^/]+)$`).MatchString(url) ||
+		url[1:37] != url[38:] {
+		t.Errorf("uuid placeholder == %q, %v", url, err)
+	}
+}
+
+func TestRenderStyleURLTemplate(t *testing.T) {
+	url, styleURL, err := RenderStyleURLTemplate("/{{style}}/{{uuid}}-{{hash}}.{{extension}}", &URLTemplateContext{FileName: "a.png"})
+	if err != nil || !strings.HasPrefix(url, "/original/") || styleURL != "/{{style}}"+strings.TrimPrefix(url, "/original") {
+		t.Fatalf("RenderStyleURLTemplate() == %q, %q, %v", url, styleURL, err)
+	}
+	if got, want := StyleURL(url, styleURL, "thumb"), "/thumb"+strings.TrimPrefix(url, "/original"); got != want {
+		t.Errorf("StyleURL() == %q, want %q", got, want)
+	}
+	// the style URL of other URL isn't used
+	if got := StyleURL("/other/a.png", styleURL, "thumb"); got != "/other/a.thumb.png" {
+		t.Errorf("StyleURL() of other URL == %q", got)
+	}
+
+	if url, styleURL, err = RenderStyleURLTemplate("/{{filename}}", &URLTemplateContext{FileName: "a.png"}); err != nil || url != "/a.png" || styleURL != "" {
+		t.Errorf("RenderStyleURLTemplate() without style == %q, %q, %v", url, styleURL, err)
+	}
+	if got := StyleURL(url, styleURL, "thumb"); got != "/a.thumb.png" {
+		t.Errorf("StyleURL() without style URL == %q", got)
+	}
+}
+
+func TestURLTemplateErrors(t *testing.T) {
+	for _, text := range []string{"", " ", "/{{filename", "/{{unknown}}"} {
+		if _, err := ParseURLTemplate(text); err == nil {
+			t.Errorf("ParseURLTemplate(%q) should fail", text)
+		} else if _, ok := err.(*URLTemplateError); !ok {
+			t.Errorf("ParseURLTemplate(%q) error %T isn't URLTemplateError", text, err)
+		}
+	}
+	for _, text := range []string{"/{{sha256}}", "/{{content_hash_path}}", "/{{site}}/a", `{{if false}}x{{end}}`} {
+		if _, err := RenderURLTemplate(text, &URLTemplateContext{}); err == nil {
+			t.Errorf("RenderURLTemplate(%q) should fail", text)
+		} else if _, ok := err.(*URLTemplateError); !ok {
+			t.Errorf("RenderURLTemplate(%q) error %T isn't URLTemplateError", text, err)
+		}
+	}
+}
+
+type templaterMedia struct {
+	Base
+	template string
+}
+
+func (m templaterMedia) GetURLTemplate(*Option) string {
+	return m.template
+}
+
+func TestBaseGetURL(t *testing.T) {
+	var (
+		m   = templaterMedia{Base: Base{FileName: "a.png"}, template: "/outer/{{basename}}.{{extension}}"}
+		url string
+		err error
+	)
+	// the template of outer media is used, not of Base
+	if url, err = m.GetURL(nil, nil, m); err != nil || url != "/outer/a.png" {
+		t.Errorf("GetURL() == %q, %v", url, err)
+	}
+	m.template = "/{{filename"
+	if _, err = m.GetURL(nil, nil, m); err == nil {
+		t.Errorf("GetURL() of invalid template should fail")
+	}
+	if err = m.ValidateURLTemplate(m); err == nil || m.GetURLTemplateError() != err {
+		t.Errorf("ValidateURLTemplate() == %v", err)
+	}
+}
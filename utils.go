@@ -20,6 +20,8 @@ func GetImageFormat(url string) (*imaging.Format, error) {
 		".tiff": imaging.TIFF,
 		".bmp":  imaging.BMP,
 		".gif":  imaging.GIF,
+		// encoded as PNG
+		".webp": imaging.PNG,
 	}
 
 	ext := strings.ToLower(regexp.MustCompile(`(\?.*?$)`).ReplaceAllString(filepath.Ext(url), ""))
@@ -29,6 +31,23 @@ func GetImageFormat(url string) (*imaging.Format, error) {
 	return nil, imaging.ErrUnsupportedFormat
 }
 
+// ImageFormatExt return the file extension, without dot, of image format
+func ImageFormatExt(format imaging.Format) string {
+	switch format {
+	case imaging.JPEG:
+		return "jpg"
+	case imaging.PNG:
+		return "png"
+	case imaging.GIF:
+		return "gif"
+	case imaging.TIFF:
+		return "tif"
+	case imaging.BMP:
+		return "bmp"
+	}
+	return ""
+}
+
 // IsImageFormat check filename is image or not
 func IsImageFormat(name string) bool {
 	_, err := GetImageFormat(name)
@@ -93,4 +112,13 @@ func MediaURL(base string, parts ...string) string {
 func MediaStyleURL(url, style string) string {
 	ext := path.Ext(url)
 	return fmt.Sprintf("%v.%v%v", strings.TrimSuffix(url, ext), style, ext)
+}
+
+// StyleURL return the URL of style from styleURL, rendered with the `{{style}}` placeholder, or derived from url
+// by `MediaStyleURL`. styleURL is used only if it's the URL of styles of url.
+func StyleURL(url, styleURL, style string) string {
+	if styleURL != "" && strings.Replace(styleURL, URL_STYLE_PLACEHOLDER, URL_STYLE_ORIGINAL, -1) == url {
+		return strings.Replace(styleURL, URL_STYLE_PLACEHOLDER, style, -1)
+	}
+	return MediaStyleURL(url, style)
 }
\ No newline at end of file
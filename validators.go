@@ -0,0 +1,493 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ecletus/core"
+	"github.com/ecletus/media/metadata"
+	"github.com/ecletus/media/svg"
+	"github.com/ecletus/media/video_info"
+)
+
+// Validation error codes. The messages are translated by `I18NGROUP + ".errors." + code`.
+const (
+	ERR_MAX_SIZE       = "max_size"
+	ERR_MIN_SIZE       = "min_size"
+	ERR_TYPE           = "type"
+	ERR_EXT            = "ext"
+	ERR_EXT_MISMATCH   = "ext_mismatch"
+	ERR_NOT_IMAGE      = "not_image"
+	ERR_MIN_WIDTH      = "min_width"
+	ERR_MAX_WIDTH      = "max_width"
+	ERR_MIN_HEIGHT     = "min_height"
+	ERR_MAX_HEIGHT     = "max_height"
+	ERR_ASPECT         = "aspect"
+	ERR_SVG            = "svg"
+	ERR_NOT_VIDEO      = "not_video"
+	ERR_MAX_RESOLUTION = "max_resolution"
+)
+
+var validationMessages = map[string]string{
+	ERR_MAX_SIZE:       "Very large file. The expected maximum size is {{max}}, but obtained {{size}}.",
+	ERR_MIN_SIZE:       "Very small file. The expected minimum size is {{min}}, but obtained {{size}}.",
+	ERR_TYPE:           "Invalid file type {{type}}.",
+	ERR_EXT:            "Invalid file extension {{ext}}.",
+	ERR_EXT_MISMATCH:   "The file content ({{type}}) does not match the extension {{ext}}.",
+	ERR_NOT_IMAGE:      "The file isn't a valid image.",
+	ERR_MIN_WIDTH:      "The image width must be at least {{min}}px, but obtained {{width}}px.",
+	ERR_MAX_WIDTH:      "The image width must be at most {{max}}px, but obtained {{width}}px.",
+	ERR_MIN_HEIGHT:     "The image height must be at least {{min}}px, but obtained {{height}}px.",
+	ERR_MAX_HEIGHT:     "The image height must be at most {{max}}px, but obtained {{height}}px.",
+	ERR_ASPECT:         "The image aspect ratio must be {{aspect}}, but obtained {{width}}x{{height}}.",
+	ERR_SVG:            "The SVG file is invalid: {{error}}.",
+	ERR_NOT_VIDEO:      "The file isn't a supported video.",
+	ERR_MAX_RESOLUTION: "The resolution must be at most {{max}}, but obtained {{width}}x{{height}}.",
+}
+
+// ValidationError is an upload validation error
+type ValidationError struct {
+	Code   string
+	Params map[string]interface{}
+	// Message is the translated message set by `TranslateError`
+	Message string
+}
+
+// NewValidationError creates a new validation error. pairs are param name and value pairs.
+func NewValidationError(code string, pairs ...interface{}) *ValidationError {
+	err := &ValidationError{Code: code, Params: map[string]interface{}{}}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		err.Params[fmt.Sprint(pairs[i])] = pairs[i+1]
+	}
+	return err
+}
+
+// Format replaces the `{{param}}` placeholders of message
+func (e *ValidationError) Format(message string) string {
+	for name, value := range e.Params {
+		message = strings.Replace(message, "{{"+name+"}}", fmt.Sprint(value), -1)
+	}
+	return message
+}
+
+func (e *ValidationError) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return e.defaultMessage()
+}
+
+func (e *ValidationError) defaultMessage() string {
+	if message, ok := validationMessages[e.Code]; ok {
+		return e.Format(message)
+	}
+	return e.Format(e.Code)
+}
+
+// Translate return the translated message
+func (e *ValidationError) Translate(ctx *core.Context) string {
+	return e.Format(ctx.Ts(I18NGROUP+".errors."+e.Code, e.defaultMessage()))
+}
+
+// TranslateError sets the translated message of the validation error of err
+func TranslateError(ctx *core.Context, err error) error {
+	var ve *ValidationError
+	if ctx != nil && errors.As(err, &ve) {
+		ve.Message = ve.Translate(ctx)
+	}
+	return err
+}
+
+// Upload is the uploaded file being validated
+type Upload struct {
+	Media    Media
+	FileName string
+	Size     uint64
+	FileType FileType
+	// Data is the *os.File or FileHeader
+	Data interface{}
+
+	config       *image.Config
+	configErr    error
+	videoInfo    *video_info.Info
+	videoInfoErr error
+}
+
+// Ext return the normalized file name extension
+func (u *Upload) Ext() string {
+	return normalizeExt(filepath.Ext(u.FileName))
+}
+
+// Open return a reader of uploaded file from start, without change the offset of *os.File.
+// The closer is nil if there is nothing to close.
+func (u *Upload) Open() (r io.Reader, closer io.Closer, err error) {
+	switch t := u.Data.(type) {
+	case *os.File:
+		return io.NewSectionReader(t, 0, math.MaxInt64), nil, nil
+	case FileHeader:
+		var f io.ReadCloser
+		if f, err = t.Open(); err != nil {
+			return
+		}
+		return f, f, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported upload data %T", u.Data)
+}
+
+// ImageConfig return the dimensions of the uploaded image, after the EXIF orientation
+func (u *Upload) ImageConfig() (image.Config, error) {
+	if u.config == nil && u.configErr == nil {
+		var (
+			r      io.Reader
+			closer io.Closer
+		)
+		if r, closer, u.configErr = u.Open(); u.configErr != nil {
+			return image.Config{}, u.configErr
+		}
+		var (
+			config image.Config
+			head   bytes.Buffer
+			md, _  = metadata.Parse(io.TeeReader(r, &head))
+		)
+		if config, _, u.configErr = image.DecodeConfig(io.MultiReader(&head, r)); u.configErr == nil {
+			if md != nil && md.Orientation >= 5 {
+				// rotated by 90 degrees
+				config.Width, config.Height = config.Height, config.Width
+			}
+			u.config = &config
+		}
+		if closer != nil {
+			closer.Close()
+		}
+	}
+	if u.configErr != nil {
+		return image.Config{}, u.configErr
+	}
+	return *u.config, nil
+}
+
+// VideoInfo return the container metadata of the uploaded video
+func (u *Upload) VideoInfo() (*video_info.Info, error) {
+	if u.videoInfo == nil && u.videoInfoErr == nil {
+		r, closer, err := u.Open()
+		if err != nil {
+			return nil, err
+		}
+		if rs, ok := r.(io.ReadSeeker); ok {
+			u.videoInfo, u.videoInfoErr = video_info.Parse(rs)
+		} else {
+			u.videoInfoErr = fmt.Errorf("unseekable upload data %T", u.Data)
+		}
+		if closer != nil {
+			closer.Close()
+		}
+	}
+	return u.videoInfo, u.videoInfoErr
+}
+
+// Validator validates uploads
+type Validator interface {
+	Validate(upload *Upload) error
+}
+
+// ValidatorFunc is a function Validator
+type ValidatorFunc func(upload *Upload) error
+
+func (f ValidatorFunc) Validate(upload *Upload) error {
+	return f(upload)
+}
+
+// ValidatorFactory creates the validator from the field tag option value
+type ValidatorFactory func(value string) (Validator, error)
+
+var (
+	validatorsMu sync.RWMutex
+	validators   = map[string]ValidatorFactory{}
+)
+
+// RegisterValidator registers the validator enabled by the `media:"name:value"` field tag option
+func RegisterValidator(name string, factory ValidatorFactory) {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	validators[strings.ToLower(name)] = factory
+}
+
+// Validators return the validators of media: the SVG validator, the AcceptTypes, AcceptExts and MaxSize
+// implementations followed by the validators enabled by field tag. The `types`, `exts` and `max_size` tag
+// options overrides the respective interface.
+func Validators(m Media) (result []Validator, err error) {
+	result = append(result, SVGValidator())
+
+	opt := m.FieldOption()
+	tagged := func(name string) bool {
+		return opt != nil && opt.Get(FIELD_TAG_NAME+"."+name) != ""
+	}
+
+	if t, ok := m.(AcceptTypes); ok && !tagged("types") {
+		result = append(result, TypesValidator(t.FileTypes()...))
+	}
+	if e, ok := m.(AcceptExts); ok && !tagged("exts") {
+		result = append(result, ExtsValidator(e.FileExts()...))
+	}
+	if ms, ok := m.(MaxSize); ok && !tagged("max_size") {
+		result = append(result, MaxSizeValidator(ms.MaxSize()))
+	}
+
+	if opt == nil {
+		return
+	}
+
+	validatorsMu.RLock()
+	defer validatorsMu.RUnlock()
+	var names []string
+	for name := range validators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if value := opt.Get(FIELD_TAG_NAME + "." + name); value != "" {
+			var v Validator
+			if v, err = validators[name](value); err != nil {
+				return nil, fmt.Errorf("media tag %q: %v", name, err)
+			}
+			result = append(result, v)
+		}
+	}
+	return
+}
+
+// SVGValidator validates the SVG uploads are well formed, so could be sanitized when stored
+func SVGValidator() Validator {
+	return ValidatorFunc(func(u *Upload) error {
+		if !u.FileType.IsSVG() {
+			return nil
+		}
+		r, closer, err := u.Open()
+		if err != nil {
+			return err
+		}
+		if closer != nil {
+			defer closer.Close()
+		}
+		if err = svg.Sanitize(ioutil.Discard, r); err != nil {
+			return NewValidationError(ERR_SVG, "error", strings.TrimPrefix(err.Error(), "svg: "))
+		}
+		return nil
+	})
+}
+
+// MaxSizeValidator validates the upload size is less or equal to max
+func MaxSizeValidator(max uint64) Validator {
+	return ValidatorFunc(func(u *Upload) error {
+		if u.Size > max {
+			return NewValidationError(ERR_MAX_SIZE, "max", humanize.Bytes(max), "size", humanize.Bytes(u.Size))
+		}
+		return nil
+	})
+}
+
+// MinSizeValidator validates the upload size is greater or equal to min
+func MinSizeValidator(min uint64) Validator {
+	return ValidatorFunc(func(u *Upload) error {
+		if u.Size < min {
+			return NewValidationError(ERR_MIN_SIZE, "min", humanize.Bytes(min), "size", humanize.Bytes(u.Size))
+		}
+		return nil
+	})
+}
+
+// TypesValidator validates the detected content type is one of types
+func TypesValidator(types ...string) Validator {
+	return ValidatorFunc(func(u *Upload) error {
+		for _, typ := range types {
+			if typ == u.FileType.MIME {
+				return nil
+			}
+		}
+		return NewValidationError(ERR_TYPE, "type", u.FileType.MIME, "types", strings.Join(types, ", "))
+	})
+}
+
+// ExtsValidator validates the detected content matches one of exts
+func ExtsValidator(exts ...string) Validator {
+	return ValidatorFunc(func(u *Upload) error {
+		for _, ext := range exts {
+			if u.FileType.HasExt(ext) {
+				return nil
+			}
+		}
+		ext := u.Ext()
+		for _, e := range exts {
+			if normalizeExt(e) == ext {
+				return NewValidationError(ERR_EXT_MISMATCH, "type", u.FileType.MIME, "ext", ext)
+			}
+		}
+		return NewValidationError(ERR_EXT, "ext", ext, "exts", strings.Join(exts, ", "))
+	})
+}
+
+// DimensionValidator validates an image dimension. code is one of ERR_MIN_WIDTH, ERR_MAX_WIDTH,
+// ERR_MIN_HEIGHT or ERR_MAX_HEIGHT.
+func DimensionValidator(code string, limit int) Validator {
+	return ValidatorFunc(func(u *Upload) error {
+		config, err := u.ImageConfig()
+		if err != nil {
+			return NewValidationError(ERR_NOT_IMAGE)
+		}
+		var (
+			value int
+			param = "width"
+			bound = "min"
+		)
+		switch code {
+		case ERR_MIN_WIDTH, ERR_MAX_WIDTH:
+			value = config.Width
+		default:
+			value, param = config.Height, "height"
+		}
+		if code == ERR_MAX_WIDTH || code == ERR_MAX_HEIGHT {
+			if value <= limit {
+				return nil
+			}
+			bound = "max"
+		} else if value >= limit {
+			return nil
+		}
+		return NewValidationError(code, bound, limit, param, value)
+	})
+}
+
+// AspectValidator validates the image aspect ratio is width/height, with 1% of tolerance
+func AspectValidator(width, height int) Validator {
+	return ValidatorFunc(func(u *Upload) error {
+		config, err := u.ImageConfig()
+		if err != nil || config.Height == 0 {
+			return NewValidationError(ERR_NOT_IMAGE)
+		}
+		want := float64(width) / float64(height)
+		got := float64(config.Width) / float64(config.Height)
+		if math.Abs(got-want)/want > 0.01 {
+			return NewValidationError(ERR_ASPECT, "aspect", fmt.Sprintf("%d/%d", width, height),
+				"width", config.Width, "height", config.Height)
+		}
+		return nil
+	})
+}
+
+// MaxResolutionValidator validates the resolution of images and videos is at most width x height, in any
+// orientation: the 1920x1080 limit accepts 1080x1920 portrait videos too
+func MaxResolutionValidator(width, height int) Validator {
+	if width < height {
+		width, height = height, width
+	}
+	return ValidatorFunc(func(u *Upload) error {
+		var w, h int
+		switch {
+		case u.FileType.IsVideo():
+			info, err := u.VideoInfo()
+			if err != nil || info.Width == 0 || info.Height == 0 {
+				return NewValidationError(ERR_NOT_VIDEO)
+			}
+			w, h = info.DisplaySize()
+		case u.FileType.IsImage():
+			config, err := u.ImageConfig()
+			if err != nil {
+				return NewValidationError(ERR_NOT_IMAGE)
+			}
+			w, h = config.Width, config.Height
+		default:
+			return nil
+		}
+		long, short := w, h
+		if long < short {
+			long, short = short, long
+		}
+		if long > width || short > height {
+			return NewValidationError(ERR_MAX_RESOLUTION, "max", fmt.Sprintf("%dx%d", width, height), "width", w, "height", h)
+		}
+		return nil
+	})
+}
+
+func splitList(value string) (items []string) {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+func dimensionFactory(code string) ValidatorFactory {
+	return func(value string) (Validator, error) {
+		limit, err := strconv.Atoi(strings.TrimSuffix(value, "px"))
+		if err != nil {
+			return nil, err
+		}
+		return DimensionValidator(code, limit), nil
+	}
+}
+
+func init() {
+	RegisterValidator("max_size", func(value string) (Validator, error) {
+		size, err := humanize.ParseBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		return MaxSizeValidator(size), nil
+	})
+	RegisterValidator("min_size", func(value string) (Validator, error) {
+		size, err := humanize.ParseBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		return MinSizeValidator(size), nil
+	})
+	RegisterValidator("types", func(value string) (Validator, error) {
+		return TypesValidator(splitList(value)...), nil
+	})
+	RegisterValidator("exts", func(value string) (Validator, error) {
+		return ExtsValidator(splitList(value)...), nil
+	})
+	RegisterValidator("min_width", dimensionFactory(ERR_MIN_WIDTH))
+	RegisterValidator("max_width", dimensionFactory(ERR_MAX_WIDTH))
+	RegisterValidator("min_height", dimensionFactory(ERR_MIN_HEIGHT))
+	RegisterValidator("max_height", dimensionFactory(ERR_MAX_HEIGHT))
+	RegisterValidator("aspect", func(value string) (Validator, error) {
+		parts := strings.Split(value, "/")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid aspect %q, expected WIDTH/HEIGHT", value)
+		}
+		width, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, err
+		}
+		height, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		if width <= 0 || height <= 0 {
+			return nil, fmt.Errorf("invalid aspect %q", value)
+		}
+		return AspectValidator(width, height), nil
+	})
+	RegisterValidator("max_resolution", func(value string) (Validator, error) {
+		var width, height int
+		if _, err := fmt.Sscanf(strings.ToLower(value), "%dx%d", &width, &height); err != nil || width <= 0 || height <= 0 {
+			return nil, fmt.Errorf("invalid resolution %q, expected WIDTHxHEIGHT", value)
+		}
+		return MaxResolutionValidator(width, height), nil
+	})
+}
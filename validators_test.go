@@ -0,0 +1,149 @@
+package media
+
+import (
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestExtsValidator(t *testing.T) {
+	png := FileType{MIME: "image/png", Ext: "png"}
+	cases := []struct {
+		name string
+		typ  FileType
+		code string
+	}{
+		{"a.png", png, ""},
+		{"noext", png, ""},
+		{"noext", FileType{MIME: "application/pdf", Ext: "pdf"}, ERR_EXT},
+		{"a.jpg", FileType{MIME: "image/gif", Ext: "gif"}, ERR_EXT_MISMATCH},
+	}
+	v := ExtsValidator("jpg", "png")
+	for _, c := range cases {
+		err := v.Validate(&Upload{FileName: c.name, FileType: c.typ})
+		if c.code == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.name, err)
+			}
+			continue
+		}
+		if ve, ok := err.(*ValidationError); !ok || ve.Code != c.code {
+			t.Errorf("%s: error == %v, want code %q", c.name, err, c.code)
+		}
+	}
+}
+
+func TestValidationErrorFormat(t *testing.T) {
+	err := NewValidationError(ERR_MAX_SIZE, "max", "5 MB", "size", "6 MB")
+	if got, want := err.Error(), "Very large file. The expected maximum size is 5 MB, but obtained 6 MB."; got != want {
+		t.Errorf("Error() == %q, want %q", got, want)
+	}
+}
+
+func TestValidatorFactories(t *testing.T) {
+	for name, value := range map[string]string{"max_size": "5MB", "aspect": "16/9", "min_width": "800", "max_resolution": "1920x1080"} {
+		if _, err := validators[name](value); err != nil {
+			t.Errorf("%s:%s: %v", name, value, err)
+		}
+	}
+	for name, value := range map[string]string{"max_size": "big", "aspect": "16", "min_width": "wide", "max_resolution": "4k"} {
+		if _, err := validators[name](value); err == nil {
+			t.Errorf("%s:%s should fail", name, value)
+		}
+	}
+}
+
+func TestSVGValidator(t *testing.T) {
+	svgType := FileType{MIME: "image/svg+xml", Ext: "svg"}
+	for content, code := range map[string]string{
+		`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`: "",
+		`<svg><g></svg>`: ERR_SVG,
+		`<html></html>`:  ERR_SVG,
+	} {
+		f, err := ioutil.TempFile("", "upload*.svg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(content)
+		err = SVGValidator().Validate(&Upload{FileName: "a.svg", FileType: svgType, Data: f})
+		f.Close()
+		os.Remove(f.Name())
+		if code == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", content, err)
+			}
+			continue
+		}
+		if ve, ok := err.(*ValidationError); !ok || ve.Code != code {
+			t.Errorf("%s: error == %v, want code %q", content, err, code)
+		}
+	}
+}
+
+func TestMaxResolutionValidator(t *testing.T) {
+	pngType := FileType{MIME: "image/png", Ext: "png"}
+	v := MaxResolutionValidator(1920, 1080)
+	for _, c := range []struct {
+		width, height int
+		code          string
+	}{
+		{1920, 1080, ""},
+		{1080, 1920, ""},
+		{3840, 2160, ERR_MAX_RESOLUTION},
+		{2000, 1000, ERR_MAX_RESOLUTION},
+	} {
+		f, err := ioutil.TempFile("", "upload*.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		png.Encode(f, image.NewGray(image.Rect(0, 0, c.width, c.height)))
+		err = v.Validate(&Upload{FileName: "a.png", FileType: pngType, Data: f})
+		f.Close()
+		os.Remove(f.Name())
+		if c.code == "" {
+			if err != nil {
+				t.Errorf("%dx%d: unexpected error %v", c.width, c.height, err)
+			}
+			continue
+		}
+		if ve, ok := err.(*ValidationError); !ok || ve.Code != c.code {
+			t.Errorf("%dx%d: error == %v, want code %q", c.width, c.height, err, c.code)
+		}
+	}
+}
+
+type optionMedia struct {
+	Media
+	option *Option
+}
+
+func (m optionMedia) FieldOption() *Option {
+	return m.option
+}
+
+func TestBaseValidateFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "upload*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	f.WriteString("hello world")
+
+	var (
+		b      = &Base{FileName: "a.txt", FileSize: 2000, FileHeader: &fileWrapper{f}}
+		tagged = optionMedia{option: &Option{"MEDIA.MAX_SIZE": "1KB"}}
+	)
+	if err = b.ValidateFile(optionMedia{}); err != nil {
+		t.Errorf("ValidateFile() without field option == %v", err)
+	}
+	if ve, ok := b.ValidateFile(tagged).(*ValidationError); !ok || ve.Code != ERR_MAX_SIZE {
+		t.Errorf("ValidateFile() == %v, want code %q", ve, ERR_MAX_SIZE)
+	}
+	b.validated = true
+	if err = b.ValidateFile(tagged); err != nil {
+		t.Errorf("ValidateFile() of validated file == %v", err)
+	}
+}
@@ -0,0 +1,268 @@
+package video_info
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strings"
+)
+
+// maxBoxSize is the max size of the boxes read to memory
+const maxBoxSize = 64 << 20
+
+// fourCCCodecs are the codec names of ISO-BMFF sample entries
+var fourCCCodecs = map[string]string{
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "hevc",
+	"hev1": "hevc",
+	"vp08": "vp8",
+	"vp09": "vp9",
+	"av01": "av1",
+	"mp4v": "mpeg4",
+	"apch": "prores",
+	"apcn": "prores",
+	"apcs": "prores",
+	"apco": "prores",
+	"ap4h": "prores",
+	"mp4a": "aac",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	"opus": "opus",
+	"flac": "flac",
+	".mp3": "mp3",
+	"alac": "alac",
+	"lpcm": "pcm",
+	"sowt": "pcm",
+	"twos": "pcm",
+}
+
+func fourCCCodec(fourcc string) string {
+	if name, ok := fourCCCodecs[strings.ToLower(fourcc)]; ok {
+		return name
+	}
+	return strings.TrimSpace(fourcc)
+}
+
+type box struct {
+	typ  string
+	data []byte
+}
+
+// readBoxHeader return the type and the data size of the box at the current position of r
+func readBoxHeader(r io.Reader, remaining int64) (typ string, size int64, err error) {
+	var h [8]byte
+	if _, err = io.ReadFull(r, h[:]); err != nil {
+		return
+	}
+	size, typ = int64(binary.BigEndian.Uint32(h[:4])), string(h[4:])
+	switch size {
+	case 0:
+		size = remaining
+	case 1:
+		var large [8]byte
+		if _, err = io.ReadFull(r, large[:]); err != nil {
+			return
+		}
+		if size = int64(binary.BigEndian.Uint64(large[:])); size < 16 {
+			return "", 0, errors.New("video_info: invalid box size")
+		}
+		return typ, size - 16, nil
+	}
+	if size < 8 || size > remaining {
+		return "", 0, errors.New("video_info: invalid box size")
+	}
+	return typ, size - 8, nil
+}
+
+// children return the boxes of data
+func children(data []byte) (boxes []box) {
+	for len(data) >= 8 {
+		size, offset := uint64(binary.BigEndian.Uint32(data[:4])), uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return
+			}
+			size, offset = binary.BigEndian.Uint64(data[8:16]), 16
+		}
+		if size < offset || size > uint64(len(data)) {
+			return
+		}
+		boxes = append(boxes, box{string(data[4:8]), data[offset:size]})
+		data = data[size:]
+	}
+	return
+}
+
+func child(data []byte, path ...string) []byte {
+	for _, typ := range path {
+		var found bool
+		for _, b := range children(data) {
+			if b.typ == typ {
+				data, found = b.data, true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return data
+}
+
+// fullBoxFields return the version of full box and the data after the version and flags
+func fullBoxFields(data []byte) (version byte, fields []byte, ok bool) {
+	if len(data) < 4 {
+		return
+	}
+	return data[0], data[4:], true
+}
+
+// timing return the timescale and duration of mvhd or mdhd box
+func timing(data []byte) (timescale uint32, duration uint64, ok bool) {
+	version, fields, ok := fullBoxFields(data)
+	if !ok {
+		return
+	}
+	if version == 1 {
+		if len(fields) < 28 {
+			return 0, 0, false
+		}
+		return binary.BigEndian.Uint32(fields[16:20]), binary.BigEndian.Uint64(fields[20:28]), true
+	}
+	if len(fields) < 16 {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint32(fields[8:12]), uint64(binary.BigEndian.Uint32(fields[12:16])), true
+}
+
+// parseBMFF reads the moov box of MP4 and MOV files, that could be after of media data
+func parseBMFF(r io.ReadSeeker, size int64) (info *Info, err error) {
+	info = &Info{Container: "mp4"}
+	var (
+		pos  int64
+		moov []byte
+	)
+	for pos < size && moov == nil {
+		var (
+			typ      string
+			dataSize int64
+		)
+		if typ, dataSize, err = readBoxHeader(r, size-pos); err != nil {
+			return nil, err
+		}
+		headerSize, _ := r.Seek(0, io.SeekCurrent)
+		headerSize -= pos
+		switch typ {
+		case "ftyp":
+			if dataSize >= 4 {
+				var brand [4]byte
+				if _, err = io.ReadFull(r, brand[:]); err != nil {
+					return nil, err
+				}
+				if string(brand[:]) == "qt  " {
+					info.Container = "mov"
+				}
+			}
+		case "moov":
+			if dataSize > maxBoxSize {
+				return nil, errors.New("video_info: moov box is too large")
+			}
+			moov = make([]byte, dataSize)
+			if _, err = io.ReadFull(r, moov); err != nil {
+				return nil, err
+			}
+		}
+		pos += headerSize + dataSize
+		if _, err = r.Seek(pos, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	if moov == nil {
+		return nil, errors.New("video_info: moov box not found")
+	}
+
+	if timescale, duration, ok := timing(child(moov, "mvhd")); ok && timescale > 0 {
+		info.Duration = roundDuration(float64(duration) / float64(timescale))
+	}
+
+	for _, b := range children(moov) {
+		if b.typ != "trak" {
+			continue
+		}
+		var handler string
+		if hdlr := child(b.data, "mdia", "hdlr"); len(hdlr) >= 12 {
+			handler = string(hdlr[8:12])
+		}
+		stsd := child(b.data, "mdia", "minf", "stbl", "stsd")
+		var format string
+		var entry []byte
+		if _, fields, ok := fullBoxFields(stsd); ok && len(fields) >= 4 {
+			if entries := children(fields[4:]); len(entries) > 0 {
+				format, entry = entries[0].typ, entries[0].data
+			}
+		}
+
+		switch handler {
+		case "vide":
+			if info.VideoCodec != "" {
+				continue
+			}
+			info.VideoCodec = fourCCCodec(format)
+			info.Width, info.Height, info.Rotation = trackHeader(child(b.data, "tkhd"))
+			if (info.Width == 0 || info.Height == 0) && len(entry) >= 28 {
+				// visual sample entry
+				info.Width, info.Height = int(binary.BigEndian.Uint16(entry[24:26])), int(binary.BigEndian.Uint16(entry[26:28]))
+			}
+			if info.Duration == 0 {
+				if timescale, duration, ok := timing(child(b.data, "mdia", "mdhd")); ok && timescale > 0 {
+					info.Duration = roundDuration(float64(duration) / float64(timescale))
+				}
+			}
+		case "soun":
+			if info.AudioCodec == "" {
+				info.AudioCodec = fourCCCodec(format)
+			}
+		}
+	}
+	return info, nil
+}
+
+// trackHeader return the dimensions before the rotation and the rotation of tkhd box
+func trackHeader(data []byte) (width, height, rotation int) {
+	version, fields, ok := fullBoxFields(data)
+	if !ok {
+		return
+	}
+	// creation and modification times, track ID, reserved and duration
+	offset := 20
+	if version == 1 {
+		offset = 32
+	}
+	// reserved, layer, alternate group, volume and reserved
+	offset += 16
+	if len(fields) < offset+44 {
+		return
+	}
+	var matrix [4]int32
+	for i, at := range []int{0, 4, 12, 16} {
+		matrix[i] = int32(binary.BigEndian.Uint32(fields[offset+at:]))
+	}
+	var (
+		a, b = float64(matrix[0]) / 65536, float64(matrix[1]) / 65536
+		w    = float64(binary.BigEndian.Uint32(fields[offset+36:])) / 65536
+		h    = float64(binary.BigEndian.Uint32(fields[offset+40:])) / 65536
+	)
+	rotation = (int(math.Round(math.Atan2(b, a)*180/math.Pi/90))*90 + 360) % 360
+	// the dimensions are applied before the matrix
+	width, height = int(math.Round(w)), int(math.Round(h))
+	return
+}
+
+func roundDuration(seconds float64) float64 {
+	return math.Round(seconds*1000) / 1000
+}
@@ -0,0 +1,87 @@
+// Package video_info reads the duration, dimensions, codecs, bitrate and rotation of MP4, MOV (ISO-BMFF)
+// and WebM, MKV (Matroska) videos from the container headers, without decoding the streams.
+package video_info
+
+import (
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// ErrUnsupported is returned for files of unknown container
+var ErrUnsupported = errors.New("video_info: unsupported container")
+
+// Info is the video container metadata
+type Info struct {
+	// Container is one of "mp4", "mov", "webm" or "mkv"
+	Container string
+	// Duration in seconds
+	Duration float64 `json:",omitempty"`
+	// Width and Height are the stored dimensions of the video track, before the rotation
+	Width  int `json:",omitempty"`
+	Height int `json:",omitempty"`
+	// VideoCodec and AudioCodec are like "h264", "hevc", "vp9", "av1", "aac" and "opus"
+	VideoCodec string `json:",omitempty"`
+	AudioCodec string `json:",omitempty"`
+	// Bitrate is the average bitrate in bits per second
+	Bitrate int64 `json:",omitempty"`
+	// Rotation is the clockwise display rotation in degrees: 0, 90, 180 or 270
+	Rotation int `json:",omitempty"`
+}
+
+// GetDuration return the duration
+func (info *Info) GetDuration() time.Duration {
+	return time.Duration(info.Duration * float64(time.Second))
+}
+
+// DisplaySize return the dimensions after the rotation
+func (info *Info) DisplaySize() (width, height int) {
+	if info.Rotation == 90 || info.Rotation == 270 {
+		return info.Height, info.Width
+	}
+	return info.Width, info.Height
+}
+
+// AspectRatio return the display width divided by the display height, or 0 if unknown
+func (info *Info) AspectRatio() float64 {
+	w, h := info.DisplaySize()
+	if w <= 0 || h <= 0 {
+		return 0
+	}
+	return float64(w) / float64(h)
+}
+
+// Parse reads the info of video of r
+func Parse(r io.ReadSeeker) (info *Info, err error) {
+	var size int64
+	if size, err = r.Seek(0, io.SeekEnd); err != nil {
+		return
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	var head [12]byte
+	if _, err = io.ReadFull(r, head[:]); err != nil {
+		return nil, ErrUnsupported
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	switch {
+	case string(head[4:8]) == "ftyp" || string(head[4:8]) == "moov" || string(head[4:8]) == "mdat" ||
+		string(head[4:8]) == "free" || string(head[4:8]) == "wide":
+		info, err = parseBMFF(r, size)
+	case head[0] == 0x1A && head[1] == 0x45 && head[2] == 0xDF && head[3] == 0xA3:
+		info, err = parseMatroska(r, size)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.Bitrate == 0 && info.Duration > 0 {
+		info.Bitrate = int64(math.Round(float64(size) * 8 / info.Duration))
+	}
+	return
+}
@@ -0,0 +1,139 @@
+package video_info
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func mp4Box(typ string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	b := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(b, uint32(8+len(data)))
+	copy(b[4:], typ)
+	return append(b, data...)
+}
+
+func u32(values ...uint32) []byte {
+	b := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(b[i*4:], v)
+	}
+	return b
+}
+
+func testMP4(brand string, matrix [4]int32) []byte {
+	tkhd := bytes.Join([][]byte{
+		u32(0, 0, 0, 1, 0, 0), // version and flags, times, track ID, reserved and duration
+		make([]byte, 16),
+		u32(uint32(matrix[0]), uint32(matrix[1]), 0, uint32(matrix[2]), uint32(matrix[3]), 0, 0, 0, 0x40000000),
+		u32(1920<<16, 1080<<16),
+	}, nil)
+	track := func(handler, format string, header []byte) []byte {
+		return mp4Box("trak", header, mp4Box("mdia",
+			mp4Box("hdlr", u32(0, 0), []byte(handler), make([]byte, 12)),
+			mp4Box("minf", mp4Box("stbl", mp4Box("stsd", u32(0, 1), mp4Box(format, make([]byte, 28)))))))
+	}
+	return bytes.Join([][]byte{
+		mp4Box("ftyp", []byte(brand), u32(0)),
+		// the media data before the movie box
+		mp4Box("mdat", make([]byte, 1000)),
+		mp4Box("moov",
+			mp4Box("mvhd", u32(0, 0, 0, 1000, 12500), make([]byte, 80)),
+			track("vide", "avc1", mp4Box("tkhd", tkhd)),
+			track("soun", "mp4a", nil)),
+	}, nil)
+}
+
+func TestParseMP4(t *testing.T) {
+	data := testMP4("isom", [4]int32{0, 0x10000, -0x10000, 0})
+	info, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Info{
+		Container:  "mp4",
+		Duration:   12.5,
+		Width:      1920,
+		Height:     1080,
+		VideoCodec: "h264",
+		AudioCodec: "aac",
+		Bitrate:    int64(math.Round(float64(len(data)) * 8 / 12.5)),
+		Rotation:   90,
+	}
+	if *info != expected {
+		t.Errorf("expected %+v, got %+v", expected, *info)
+	}
+	if w, h := info.DisplaySize(); w != 1080 || h != 1920 {
+		t.Errorf("expected display size 1080x1920, got %dx%d", w, h)
+	}
+	if info.GetDuration().Milliseconds() != 12500 {
+		t.Errorf("expected duration 12.5s, got %v", info.GetDuration())
+	}
+}
+
+func TestParseMOV(t *testing.T) {
+	info, err := Parse(bytes.NewReader(testMP4("qt  ", [4]int32{-0x10000, 0, 0, -0x10000})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Container != "mov" || info.Rotation != 180 {
+		t.Errorf("expected mov rotated 180, got %+v", *info)
+	}
+	if ratio := info.AspectRatio(); math.Abs(ratio-16.0/9) > 1e-9 {
+		t.Errorf("expected aspect ratio 16:9, got %v", ratio)
+	}
+}
+
+func ebml(id uint32, payload ...[]byte) []byte {
+	var b []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if v := byte(id >> uint(shift)); v != 0 || len(b) > 0 {
+			b = append(b, v)
+		}
+	}
+	data := bytes.Join(payload, nil)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(data)))
+	size[0] = 0x01
+	return append(append(b, size...), data...)
+}
+
+func TestParseWebM(t *testing.T) {
+	duration := make([]byte, 8)
+	binary.BigEndian.PutUint64(duration, math.Float64bits(5000))
+	data := bytes.Join([][]byte{
+		ebml(ebmlHeader, ebml(ebmlDocType, []byte("webm"))),
+		// segment of unknown size
+		{0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+		ebml(mkvInfo, ebml(mkvTimecodeScale, []byte{0x0F, 0x42, 0x40}), ebml(mkvDuration, duration)),
+		ebml(mkvTracks,
+			ebml(mkvTrackEntry, ebml(mkvTrackType, []byte{1}), ebml(mkvCodecID, []byte("V_VP9")),
+				ebml(mkvVideo, ebml(mkvPixelWidth, []byte{0x0F, 0x00}), ebml(mkvPixelHeight, []byte{0x08, 0x70}))),
+			ebml(mkvTrackEntry, ebml(mkvTrackType, []byte{2}), ebml(mkvCodecID, []byte("A_OPUS")))),
+		ebml(mkvCluster, make([]byte, 100)),
+	}, nil)
+	info, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Info{
+		Container:  "webm",
+		Duration:   5,
+		Width:      3840,
+		Height:     2160,
+		VideoCodec: "vp9",
+		AudioCodec: "opus",
+		Bitrate:    int64(math.Round(float64(len(data)) * 8 / 5)),
+	}
+	if *info != expected {
+		t.Errorf("expected %+v, got %+v", expected, *info)
+	}
+}
+
+func TestParseUnsupported(t *testing.T) {
+	if _, err := Parse(bytes.NewReader([]byte("GIF89a, not a video"))); err != ErrUnsupported {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,291 @@
+package video_info
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strings"
+)
+
+// Matroska element IDs
+const (
+	ebmlHeader       = 0x1A45DFA3
+	ebmlDocType      = 0x4282
+	mkvSegment       = 0x18538067
+	mkvInfo          = 0x1549A966
+	mkvTimecodeScale = 0x2AD7B1
+	mkvDuration      = 0x4489
+	mkvTracks        = 0x1654AE6B
+	mkvTrackEntry    = 0xAE
+	mkvTrackType     = 0x83
+	mkvCodecID       = 0x86
+	mkvVideo         = 0xE0
+	mkvPixelWidth    = 0xB0
+	mkvPixelHeight   = 0xBA
+	mkvProjection    = 0x7670
+	mkvProjRoll      = 0x7675
+	mkvCluster       = 0x1F43B675
+)
+
+// unknownSize is the size of elements with unknown size, like live streams segments
+const unknownSize = -1
+
+// matroskaCodecs are the codec names of Matroska codec IDs prefixes
+var matroskaCodecs = []struct{ prefix, name string }{
+	{"V_MPEG4/ISO/AVC", "h264"},
+	{"V_MPEGH/ISO/HEVC", "hevc"},
+	{"V_MPEG4/", "mpeg4"},
+	{"V_VP8", "vp8"},
+	{"V_VP9", "vp9"},
+	{"V_AV1", "av1"},
+	{"V_THEORA", "theora"},
+	{"V_PRORES", "prores"},
+	{"A_AAC", "aac"},
+	{"A_OPUS", "opus"},
+	{"A_VORBIS", "vorbis"},
+	{"A_MPEG/L3", "mp3"},
+	{"A_AC3", "ac3"},
+	{"A_EAC3", "eac3"},
+	{"A_FLAC", "flac"},
+	{"A_PCM/", "pcm"},
+}
+
+func matroskaCodec(id string) string {
+	for _, c := range matroskaCodecs {
+		if strings.HasPrefix(id, c.prefix) {
+			return c.name
+		}
+	}
+	return id
+}
+
+// readVint return the variable size integer of r. The marker bit is kept for IDs.
+func readVint(r io.Reader, keepMarker bool) (value int64, length int, err error) {
+	var b [8]byte
+	if _, err = io.ReadFull(r, b[:1]); err != nil {
+		return
+	}
+	for length = 1; length <= 8; length++ {
+		if b[0]&(0x80>>uint(length-1)) != 0 {
+			break
+		}
+	}
+	if length > 8 {
+		return 0, 0, errors.New("video_info: invalid EBML variable size integer")
+	}
+	if _, err = io.ReadFull(r, b[1:length]); err != nil {
+		return
+	}
+	allOnes := true
+	if !keepMarker {
+		b[0] &= 0xFF >> uint(length)
+		allOnes = b[0] == 0xFF>>uint(length)
+	}
+	for i := 0; i < length; i++ {
+		if i > 0 && b[i] != 0xFF {
+			allOnes = false
+		}
+		value = value<<8 | int64(b[i])
+	}
+	if !keepMarker && allOnes {
+		return unknownSize, length, nil
+	}
+	return
+}
+
+type ebmlElement struct {
+	id   int64
+	size int64
+}
+
+// readElement return the element header at the current position of r
+func readElement(r io.Reader) (el ebmlElement, headerSize int, err error) {
+	var n int
+	if el.id, headerSize, err = readVint(r, true); err != nil {
+		return
+	}
+	if el.size, n, err = readVint(r, false); err != nil {
+		return
+	}
+	headerSize += n
+	return
+}
+
+func readData(r io.Reader, size int64) (data []byte, err error) {
+	if size < 0 || size > maxBoxSize {
+		return nil, errors.New("video_info: invalid EBML element size")
+	}
+	data = make([]byte, size)
+	_, err = io.ReadFull(r, data)
+	return
+}
+
+func ebmlUint(data []byte) (v uint64) {
+	for _, b := range data {
+		v = v<<8 | uint64(b)
+	}
+	return
+}
+
+func ebmlFloat(data []byte) float64 {
+	switch len(data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data))
+	}
+	return 0
+}
+
+func ebmlString(data []byte) string {
+	return strings.TrimRight(string(data), "\x00")
+}
+
+// ebmlChildren calls f with the child elements of data
+func ebmlChildren(data []byte, f func(id int64, data []byte)) {
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		el, _, err := readElement(r)
+		if err != nil || el.size < 0 || el.size > int64(r.Len()) {
+			return
+		}
+		child := make([]byte, el.size)
+		io.ReadFull(r, child)
+		f(el.id, child)
+	}
+}
+
+// parseMatroska reads the header, the segment info and the tracks of WebM and MKV files
+func parseMatroska(r io.ReadSeeker, size int64) (info *Info, err error) {
+	info = &Info{Container: "mkv"}
+	var (
+		el       ebmlElement
+		n        int
+		data     []byte
+		pos      int64
+		scale    uint64 = 1000000
+		duration float64
+	)
+	if el, n, err = readElement(r); err != nil || el.id != ebmlHeader {
+		return nil, ErrUnsupported
+	}
+	if data, err = readData(r, el.size); err != nil {
+		return nil, err
+	}
+	ebmlChildren(data, func(id int64, data []byte) {
+		if id == ebmlDocType && ebmlString(data) == "webm" {
+			info.Container = "webm"
+		}
+	})
+	pos = int64(n) + el.size
+
+	// the segment
+	if el, n, err = readElement(r); err != nil {
+		return nil, err
+	}
+	if el.id != mkvSegment {
+		return nil, errors.New("video_info: Matroska segment not found")
+	}
+	pos += int64(n)
+	end := size
+	if el.size != unknownSize && pos+el.size < end {
+		end = pos + el.size
+	}
+
+	var foundInfo, foundTracks bool
+	for pos < end && !(foundInfo && foundTracks) {
+		if el, n, err = readElement(r); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, err
+		}
+		pos += int64(n)
+		if el.id == mkvCluster || el.size == unknownSize {
+			// the media data
+			break
+		}
+		switch el.id {
+		case mkvInfo:
+			if data, err = readData(r, el.size); err != nil {
+				return nil, err
+			}
+			foundInfo = true
+			ebmlChildren(data, func(id int64, data []byte) {
+				switch id {
+				case mkvTimecodeScale:
+					if v := ebmlUint(data); v > 0 {
+						scale = v
+					}
+				case mkvDuration:
+					duration = ebmlFloat(data)
+				}
+			})
+		case mkvTracks:
+			if data, err = readData(r, el.size); err != nil {
+				return nil, err
+			}
+			foundTracks = true
+			ebmlChildren(data, func(id int64, data []byte) {
+				if id == mkvTrackEntry {
+					matroskaTrack(info, data)
+				}
+			})
+		}
+		pos += el.size
+		if _, err = r.Seek(pos, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	if !foundTracks {
+		return nil, errors.New("video_info: Matroska tracks not found")
+	}
+	info.Duration = roundDuration(duration * float64(scale) / 1e9)
+	return info, nil
+}
+
+func matroskaTrack(info *Info, data []byte) {
+	var (
+		typ   uint64
+		codec string
+		w, h  int
+		roll  float64
+	)
+	ebmlChildren(data, func(id int64, data []byte) {
+		switch id {
+		case mkvTrackType:
+			typ = ebmlUint(data)
+		case mkvCodecID:
+			codec = matroskaCodec(ebmlString(data))
+		case mkvVideo:
+			ebmlChildren(data, func(id int64, data []byte) {
+				switch id {
+				case mkvPixelWidth:
+					w = int(ebmlUint(data))
+				case mkvPixelHeight:
+					h = int(ebmlUint(data))
+				case mkvProjection:
+					ebmlChildren(data, func(id int64, data []byte) {
+						if id == mkvProjRoll {
+							roll = ebmlFloat(data)
+						}
+					})
+				}
+			})
+		}
+	})
+	switch typ {
+	case 1:
+		if info.VideoCodec == "" {
+			info.VideoCodec, info.Width, info.Height = codec, w, h
+			// the roll is counter-clockwise
+			info.Rotation = (int(math.Round(-roll/90))*90%360 + 360) % 360
+		}
+	case 2:
+		if info.AudioCodec == "" {
+			info.AudioCodec = codec
+		}
+	}
+}
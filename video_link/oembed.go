@@ -0,0 +1,85 @@
+package video_link
+
+import (
+	"encoding/json"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ecletus/media/reader_provider"
+	errwrap "github.com/moisespsena-go/error-wrap"
+)
+
+// MaxOEmbedSize is the max size of oEmbed responses
+var MaxOEmbedSize int64 = 1 << 20
+
+// NewReaderProvider return the reader provider of oEmbed endpoint URL
+var NewReaderProvider = func(url string) reader_provider.ReaderProvider {
+	return &reader_provider.HTTPReaderProvider{URL: url}
+}
+
+// oEmbedInt is an integer informed as JSON number or string, like "480"
+type oEmbedInt int
+
+func (i *oEmbedInt) UnmarshalJSON(data []byte) error {
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		var s string
+		if json.Unmarshal(data, &s) != nil {
+			// ignores invalid values, like null
+			return nil
+		}
+		n = json.Number(s)
+	}
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err == nil {
+		*i = oEmbedInt(f)
+	}
+	return nil
+}
+
+type oEmbedResponse struct {
+	Title           string    `json:"title"`
+	AuthorName      string    `json:"author_name"`
+	ThumbnailURL    string    `json:"thumbnail_url"`
+	ThumbnailWidth  oEmbedInt `json:"thumbnail_width"`
+	ThumbnailHeight oEmbedInt `json:"thumbnail_height"`
+	Width           oEmbedInt `json:"width"`
+	Height          oEmbedInt `json:"height"`
+	Duration        oEmbedInt `json:"duration"`
+	HTML            string    `json:"html"`
+}
+
+// fetchOEmbed sets the metadata of video from the oEmbed endpoint response
+func fetchOEmbed(endpoint string, video *Video) (err error) {
+	var r io.ReadCloser
+	if r, err = NewReaderProvider(endpoint).GetReader(); err != nil {
+		return errwrap.Wrap(err, "oEmbed of %q", video.Link)
+	}
+	defer r.Close()
+	var res oEmbedResponse
+	if err = json.NewDecoder(io.LimitReader(r, MaxOEmbedSize)).Decode(&res); err != nil {
+		return errwrap.Wrap(err, "oEmbed of %q", video.Link)
+	}
+	video.Title, video.AuthorName = res.Title, res.AuthorName
+	if httpURL(res.ThumbnailURL) {
+		video.ThumbnailURL = res.ThumbnailURL
+		video.ThumbnailWidth, video.ThumbnailHeight = int(res.ThumbnailWidth), int(res.ThumbnailHeight)
+	}
+	video.Width, video.Height, video.Duration = int(res.Width), int(res.Height), int(res.Duration)
+	if video.EmbedURL == "" {
+		// the player of other schemes, like javascript:, is ignored
+		if m := iframeSrcRegexp.FindStringSubmatch(res.HTML); m != nil {
+			src := html.UnescapeString(m[1])
+			if strings.HasPrefix(src, "//") {
+				src = "https:" + src
+			}
+			if httpURL(src) {
+				video.EmbedURL = src
+			}
+		}
+	}
+	video.Fetched = true
+	return nil
+}
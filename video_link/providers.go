@@ -0,0 +1,187 @@
+package video_link
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	YOUTUBE_OEMBED_ENDPOINT = "https://www.youtube.com/oembed"
+	VIMEO_OEMBED_ENDPOINT   = "https://vimeo.com/api/oembed.json"
+)
+
+var (
+	youtubeIDRegexp  = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	vimeoIDRegexp    = regexp.MustCompile(`^[0-9]+$`)
+	vimeoHashRegexp  = regexp.MustCompile(`^[0-9a-f]+$`)
+	iframeSrcRegexp  = regexp.MustCompile(`(?i)<iframe[^>]+src=["']([^"']+)["']`)
+	youtubeHosts     = map[string]bool{"youtube.com": true, "m.youtube.com": true, "music.youtube.com": true, "youtube-nocookie.com": true}
+	vimeoHosts       = map[string]bool{"vimeo.com": true, "player.vimeo.com": true}
+	youtubePathNames = map[string]bool{"embed": true, "v": true, "shorts": true, "live": true}
+)
+
+func hostOf(u *url.URL) string {
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+func oEmbedURL(endpoint string, link string) string {
+	sep := "?"
+	if strings.Contains(endpoint, "?") {
+		sep = "&"
+	}
+	return endpoint + sep + "format=json&url=" + url.QueryEscape(link)
+}
+
+// YouTube is the provider of youtube.com and youtu.be links
+type YouTube struct {
+	// OEmbedEndpoint is the oEmbed endpoint, `YOUTUBE_OEMBED_ENDPOINT` if blank
+	OEmbedEndpoint string
+}
+
+func (*YouTube) Name() string {
+	return "youtube"
+}
+
+func (*YouTube) Parse(link *url.URL) *Video {
+	var (
+		host = hostOf(link)
+		id   string
+	)
+	parts := strings.Split(strings.Trim(link.Path, "/"), "/")
+	switch {
+	case host == "youtu.be":
+		id = parts[0]
+	case !youtubeHosts[host]:
+		return nil
+	case parts[0] == "watch":
+		id = link.Query().Get("v")
+	case youtubePathNames[parts[0]] && len(parts) > 1:
+		id = parts[1]
+	}
+	if !youtubeIDRegexp.MatchString(id) {
+		return nil
+	}
+	return &Video{
+		ID:           id,
+		URL:          "https://www.youtube.com/watch?v=" + id,
+		EmbedURL:     "https://www.youtube.com/embed/" + id,
+		ThumbnailURL: "https://i.ytimg.com/vi/" + id + "/hqdefault.jpg",
+	}
+}
+
+func (p *YouTube) OEmbedURL(video *Video) string {
+	endpoint := p.OEmbedEndpoint
+	if endpoint == "" {
+		endpoint = YOUTUBE_OEMBED_ENDPOINT
+	}
+	return oEmbedURL(endpoint, video.URL)
+}
+
+// Vimeo is the provider of vimeo.com links, including the unlisted videos with hash
+type Vimeo struct {
+	// OEmbedEndpoint is the oEmbed endpoint, `VIMEO_OEMBED_ENDPOINT` if blank
+	OEmbedEndpoint string
+}
+
+func (*Vimeo) Name() string {
+	return "vimeo"
+}
+
+func (*Vimeo) Parse(link *url.URL) *Video {
+	if !vimeoHosts[hostOf(link)] {
+		return nil
+	}
+	var (
+		id, hash string
+		parts    = strings.Split(strings.Trim(link.Path, "/"), "/")
+	)
+	// the ID is the last numeric part: /ID, /channels/NAME/ID, /groups/NAME/videos/ID, /video/ID, /ID/HASH
+	for i, part := range parts {
+		if vimeoIDRegexp.MatchString(part) {
+			id, hash = part, ""
+			if i+1 < len(parts) && vimeoHashRegexp.MatchString(parts[i+1]) {
+				hash = parts[i+1]
+			}
+		}
+	}
+	if id == "" {
+		return nil
+	}
+	if h := link.Query().Get("h"); hash == "" && vimeoHashRegexp.MatchString(h) {
+		hash = h
+	}
+	video := &Video{
+		ID:       id,
+		URL:      "https://vimeo.com/" + id,
+		EmbedURL: "https://player.vimeo.com/video/" + id,
+	}
+	if hash != "" {
+		video.URL += "/" + hash
+		video.EmbedURL += "?h=" + hash
+	}
+	return video
+}
+
+func (p *Vimeo) OEmbedURL(video *Video) string {
+	endpoint := p.OEmbedEndpoint
+	if endpoint == "" {
+		endpoint = VIMEO_OEMBED_ENDPOINT
+	}
+	return oEmbedURL(endpoint, video.URL)
+}
+
+// OEmbed is a generic oEmbed provider. The embed URL is the iframe source of oEmbed HTML.
+type OEmbed struct {
+	ProviderName string
+	// Schemes are the link patterns, like "https://*.dailymotion.com/video/*". The "*" matches any text of a path
+	// part, and the trailing "*" matches the rest of link.
+	Schemes []string
+	// Endpoint is the oEmbed endpoint URL
+	Endpoint string
+}
+
+func (p *OEmbed) Name() string {
+	return p.ProviderName
+}
+
+func (p *OEmbed) Parse(link *url.URL) *Video {
+	s := link.String()
+	for _, scheme := range p.Schemes {
+		if matchScheme(scheme, s) {
+			return &Video{URL: s}
+		}
+	}
+	return nil
+}
+
+func (p *OEmbed) OEmbedURL(video *Video) string {
+	return oEmbedURL(p.Endpoint, video.URL)
+}
+
+// matchScheme return if link matches the oEmbed scheme, with "http" and "https" as equivalent
+func matchScheme(scheme, link string) bool {
+	trim := func(s string) string {
+		return strings.TrimPrefix(strings.TrimPrefix(s, "https://"), "http://")
+	}
+	// "*" never matches "/" with path.Match, so the scheme is matched part by part
+	scheme, link = trim(scheme), trim(link)
+	if i := strings.IndexAny(link, "?#"); i >= 0 && !strings.ContainsAny(scheme, "?#") {
+		link = link[:i]
+	}
+	schemeParts, linkParts := strings.Split(scheme, "/"), strings.Split(link, "/")
+	if len(linkParts) < len(schemeParts) {
+		return false
+	}
+	for i, part := range schemeParts {
+		last := i == len(schemeParts)-1
+		if last && part == "*" {
+			return true
+		}
+		if ok, _ := path.Match(part, linkParts[i]); !ok {
+			return false
+		}
+	}
+	return len(linkParts) == len(schemeParts)
+}
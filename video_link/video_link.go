@@ -0,0 +1,244 @@
+// Package video_link recognizes the links of video services, like YouTube and Vimeo, normalizing them to
+// canonical IDs and embed URLs, and fetches its title, thumbnail and dimensions by oEmbed.
+package video_link
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrInvalidLink     = errors.New("video_link: invalid link")
+	ErrUnknownProvider = errors.New("video_link: unknown provider")
+)
+
+// Video is the video of link, with the oEmbed metadata if fetched
+type Video struct {
+	// Provider is the provider name, like "youtube"
+	Provider string
+	// ID is the video ID on provider, blank for generic oEmbed providers
+	ID string `json:",omitempty"`
+	// Link is the parsed link
+	Link string
+	// URL is the canonical URL of video page
+	URL string
+	// EmbedURL is the URL of player, for iframes
+	EmbedURL string `json:",omitempty"`
+
+	Title           string `json:",omitempty"`
+	AuthorName      string `json:",omitempty"`
+	ThumbnailURL    string `json:",omitempty"`
+	ThumbnailWidth  int    `json:",omitempty"`
+	ThumbnailHeight int    `json:",omitempty"`
+	// Width and Height are the player dimensions
+	Width  int `json:",omitempty"`
+	Height int `json:",omitempty"`
+	// Duration in seconds, if informed by provider
+	Duration int `json:",omitempty"`
+	// Fetched is true if the oEmbed metadata was fetched
+	Fetched bool `json:",omitempty"`
+}
+
+// AspectRatio return the player width divided by height, or 16/9 if unknown
+func (v *Video) AspectRatio() float64 {
+	if v.Width <= 0 || v.Height <= 0 {
+		return 16.0 / 9
+	}
+	return float64(v.Width) / float64(v.Height)
+}
+
+// Value stores the video as JSON
+func (v Video) Value() (driver.Value, error) {
+	if v.Link == "" {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// Scan reads the video of JSON
+func (v *Video) Scan(src interface{}) error {
+	*v = Video{}
+	switch t := src.(type) {
+	case nil:
+		return nil
+	case string:
+		if t == "" {
+			return nil
+		}
+		return json.Unmarshal([]byte(t), v)
+	case []byte:
+		if len(t) == 0 {
+			return nil
+		}
+		return json.Unmarshal(t, v)
+	}
+	return fmt.Errorf("video_link: unsupported scan type %T", src)
+}
+
+// Provider recognizes the links of a video service
+type Provider interface {
+	// Name return the unique name of provider
+	Name() string
+	// Parse return the video of link without metadata. Returns nil if link isn't of provider.
+	Parse(link *url.URL) *Video
+	// OEmbedURL return the oEmbed endpoint URL of video. Returns blank if provider has no oEmbed.
+	OEmbedURL(video *Video) string
+}
+
+// Registry is an ordered set of providers, the first matching provider parses the link
+type Registry struct {
+	mu        sync.RWMutex
+	providers []Provider
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{}
+	for _, p := range providers {
+		r.Register(p)
+	}
+	return r
+}
+
+// DefaultRegistry is the registry used by `Register`, `Parse` and `Fetch`
+var DefaultRegistry = NewRegistry(&YouTube{}, &Vimeo{})
+
+// Register add provider, replacing the provider with the same name
+func (r *Registry) Register(provider Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, p := range r.providers {
+		if p.Name() == provider.Name() {
+			r.providers[i] = provider
+			return
+		}
+	}
+	r.providers = append(r.providers, provider)
+}
+
+// Unregister remove provider
+func (r *Registry) Unregister(name string) (ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, p := range r.providers {
+		if p.Name() == name {
+			r.providers = append(r.providers[:i:i], r.providers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Get return the provider
+func (r *Registry) Get(name string) Provider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, p := range r.providers {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Parse return the video of link, without metadata
+func (r *Registry) Parse(link string) (video *Video, err error) {
+	_, video, err = r.parse(link)
+	return
+}
+
+// httpURL return if s is an absolute http or https URL
+func httpURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Host != "" && (u.Scheme == "http" || u.Scheme == "https")
+}
+
+// normalizeLink return link without spaces and with scheme
+func normalizeLink(link string) string {
+	link = strings.TrimSpace(link)
+	if link != "" && !strings.Contains(link, "://") {
+		link = "https://" + link
+	}
+	return link
+}
+
+func (r *Registry) parse(link string) (Provider, *Video, error) {
+	link = normalizeLink(link)
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, nil, ErrInvalidLink
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, p := range r.providers {
+		if video := p.Parse(u); video != nil {
+			video.Provider, video.Link = p.Name(), link
+			return p, video, nil
+		}
+	}
+	return nil, nil, ErrUnknownProvider
+}
+
+// Fetch return the video of link with the oEmbed metadata
+func (r *Registry) Fetch(link string) (video *Video, err error) {
+	var p Provider
+	if p, video, err = r.parse(link); err != nil {
+		return
+	}
+	if endpoint := p.OEmbedURL(video); endpoint != "" {
+		if err = fetchOEmbed(endpoint, video); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// Refresh return the video of link with the metadata of video if it was fetched from link, otherwise fetches
+// link. Used to cache the video metadata. The video is untrusted: the ID, URL and embed URL are always parsed
+// from link, only the title, author, thumbnail, dimensions and duration are kept. The links of providers which
+// embed URL is known only by oEmbed are fetched again.
+func (r *Registry) Refresh(video *Video, link string) (*Video, error) {
+	if video == nil || !video.Fetched || video.Link != normalizeLink(link) {
+		return r.Fetch(link)
+	}
+	parsed, err := r.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.EmbedURL == "" {
+		return r.Fetch(link)
+	}
+	parsed.Title, parsed.AuthorName = video.Title, video.AuthorName
+	if httpURL(video.ThumbnailURL) {
+		parsed.ThumbnailURL, parsed.ThumbnailWidth, parsed.ThumbnailHeight = video.ThumbnailURL, video.ThumbnailWidth, video.ThumbnailHeight
+	}
+	parsed.Width, parsed.Height, parsed.Duration = video.Width, video.Height, video.Duration
+	parsed.Fetched = true
+	return parsed, nil
+}
+
+// Register add provider to default registry
+func Register(provider Provider) {
+	DefaultRegistry.Register(provider)
+}
+
+// Parse return the video of link by default registry, without metadata
+func Parse(link string) (*Video, error) {
+	return DefaultRegistry.Parse(link)
+}
+
+// Fetch return the video of link by default registry, with the oEmbed metadata
+func Fetch(link string) (*Video, error) {
+	return DefaultRegistry.Fetch(link)
+}
+
+// Refresh return the video of link with the metadata of video if it was fetched from link, otherwise fetches link
+// by default registry
+func Refresh(video *Video, link string) (*Video, error) {
+	return DefaultRegistry.Refresh(video, link)
+}
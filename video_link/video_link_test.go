@@ -0,0 +1,138 @@
+package video_link
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for link, expected := range map[string]Video{
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=10s": {Provider: "youtube", ID: "dQw4w9WgXcQ",
+			EmbedURL: "https://www.youtube.com/embed/dQw4w9WgXcQ"},
+		"youtu.be/dQw4w9WgXcQ":                               {Provider: "youtube", ID: "dQw4w9WgXcQ"},
+		"https://m.youtube.com/shorts/dQw4w9WgXcQ":           {Provider: "youtube", ID: "dQw4w9WgXcQ"},
+		"https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ": {Provider: "youtube", ID: "dQw4w9WgXcQ"},
+		"https://vimeo.com/76979871":                         {Provider: "vimeo", ID: "76979871", URL: "https://vimeo.com/76979871"},
+		"https://vimeo.com/channels/staffpicks/76979871":     {Provider: "vimeo", ID: "76979871"},
+		"https://player.vimeo.com/video/76979871?h=8272103f6e": {Provider: "vimeo", ID: "76979871",
+			URL: "https://vimeo.com/76979871/8272103f6e", EmbedURL: "https://player.vimeo.com/video/76979871?h=8272103f6e"},
+	} {
+		video, err := Parse(link)
+		if err != nil {
+			t.Errorf("%s: %v", link, err)
+			continue
+		}
+		if video.Provider != expected.Provider || video.ID != expected.ID ||
+			(expected.URL != "" && video.URL != expected.URL) ||
+			(expected.EmbedURL != "" && video.EmbedURL != expected.EmbedURL) {
+			t.Errorf("%s: got %+v", link, *video)
+		}
+	}
+
+	for link, expected := range map[string]error{
+		"https://www.youtube.com/watch?v=short": ErrUnknownProvider,
+		"https://example.com/video.mp4":         ErrUnknownProvider,
+		"ftp://vimeo.com/76979871":              ErrInvalidLink,
+	} {
+		if _, err := Parse(link); err != expected {
+			t.Errorf("%s: expected %v, got %v", link, expected, err)
+		}
+	}
+}
+
+func TestFetch(t *testing.T) {
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Query().Get("url")
+		switch r.URL.Path {
+		case "/youtube":
+			w.Write([]byte(`{"title":"Video","author_name":"Author","thumbnail_url":"https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg",
+				"thumbnail_width":480,"thumbnail_height":360,"width":200,"height":113}`))
+		case "/generic":
+			if r.URL.Query().Get("url") == "https://videos.example.com/watch/script" {
+				w.Write([]byte(`{"title":"Script","thumbnail_url":"javascript:alert(1)",
+					"html":"<iframe src=\"javascript:alert(1)\"></iframe>"}`))
+				return
+			}
+			w.Write([]byte(`{"title":"Generic","width":"640","height":"360","duration":42,
+				"html":"<iframe width=\"640\" src=\"https://videos.example.com/embed/x1\"></iframe>"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	registry := NewRegistry(&YouTube{OEmbedEndpoint: server.URL + "/youtube"}, &Vimeo{OEmbedEndpoint: server.URL + "/missing"},
+		&OEmbed{ProviderName: "example", Schemes: []string{"https://*.example.com/watch/*"}, Endpoint: server.URL + "/generic"})
+
+	video, err := registry.Fetch("https://youtu.be/dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requested != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" {
+		t.Errorf("expected canonical URL requested, got %q", requested)
+	}
+	if !video.Fetched || video.Title != "Video" || video.AuthorName != "Author" || video.ThumbnailWidth != 480 ||
+		video.Width != 200 || video.Height != 113 {
+		t.Errorf("unexpected video %+v", *video)
+	}
+	requested = ""
+	if cached, err := registry.Refresh(video, " https://youtu.be/dQw4w9WgXcQ "); err != nil || *cached != *video || requested != "" {
+		t.Errorf("expected cached video, got %v, %v", cached, err)
+	}
+
+	video, err = registry.Fetch("https://videos.example.com/watch/x1?autoplay=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.Provider != "example" || video.Title != "Generic" || video.Width != 640 || video.Duration != 42 ||
+		video.EmbedURL != "https://videos.example.com/embed/x1" {
+		t.Errorf("unexpected video %+v", *video)
+	}
+
+	if _, err = registry.Fetch("https://vimeo.com/76979871"); err == nil {
+		t.Error("expected error of not found oEmbed")
+	}
+
+	requested = ""
+	if video, err = registry.Refresh(video, "https://videos.example.com/watch/x1?autoplay=1"); err != nil || requested == "" {
+		t.Errorf("expected video fetched again without embed URL of provider, got %v, %v", video, err)
+	}
+	if video, err = registry.Fetch("https://videos.example.com/watch/script"); err != nil || video.EmbedURL != "" || video.ThumbnailURL != "" {
+		t.Errorf("expected embed and thumbnail URLs of other schemes ignored, got %+v, %v", video, err)
+	}
+}
+
+func TestRefreshUntrusted(t *testing.T) {
+	link := "https://youtu.be/dQw4w9WgXcQ"
+	cached := &Video{Provider: "vimeo", ID: "x", Link: link, URL: "https://evil.example.com",
+		EmbedURL: "javascript:alert(1)", Title: "Video", ThumbnailURL: "javascript:alert(1)", Width: 200, Height: 113, Fetched: true}
+	video, err := NewRegistry(&YouTube{}).Refresh(cached, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.Provider != "youtube" || video.ID != "dQw4w9WgXcQ" || video.URL != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" ||
+		video.EmbedURL != "https://www.youtube.com/embed/dQw4w9WgXcQ" || video.ThumbnailURL != "https://i.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg" {
+		t.Errorf("expected video parsed from link, got %+v", *video)
+	}
+	if video.Title != "Video" || video.Width != 200 || video.Height != 113 || !video.Fetched {
+		t.Errorf("expected metadata of cached video, got %+v", *video)
+	}
+}
+
+func TestMatchScheme(t *testing.T) {
+	for _, c := range []struct {
+		scheme, link string
+		match        bool
+	}{
+		{"https://*.example.com/video/*", "http://www.example.com/video/x1/title", true},
+		{"https://*.example.com/video/*", "https://www.example.com/user/x1", false},
+		{"https://example.com/*/videos/*", "https://example.com/user/videos/1", true},
+		{"https://example.com/v/*", "https://example.com/v", false},
+	} {
+		if got := matchScheme(c.scheme, c.link); got != c.match {
+			t.Errorf("%s ~ %s: expected %v", c.scheme, c.link, c.match)
+		}
+	}
+}